@@ -0,0 +1,76 @@
+// Package analysis は思考構造の分析プロバイダーを提供する
+package analysis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/thinking"
+)
+
+// 分析プロバイダー名
+const (
+	ProviderRule = "rule"
+	ProviderHTTP = "http"
+)
+
+// ErrUnknownAnalysisType - 未対応の analysis_type
+var ErrUnknownAnalysisType = errors.New("unknown analysis type")
+
+// Request - 分析リクエスト
+type Request struct {
+	Document     *thinking.Document
+	Theme        string
+	AnalysisType string
+}
+
+// Result - 分析結果
+// ルールベースの統計に加え、LLMプロバイダーの場合は Insights を返す
+type Result struct {
+	thinking.Analysis
+	AnalysisType string   `json:"analysis_type"`
+	Provider     string   `json:"provider"`
+	Insights     []string `json:"insights,omitempty"`
+}
+
+// Analyzer - 思考構造を分析するプロバイダー
+type Analyzer interface {
+	Analyze(ctx context.Context, req Request) (*Result, error)
+	Provider() string
+}
+
+// Fingerprint - 同じ内容・テーマ・分析タイプ・プロバイダーの分析を識別するハッシュ
+func Fingerprint(req Request, provider string) (string, error) {
+	content, err := req.Document.Marshal()
+	if err != nil {
+		return "", err
+	}
+
+	theme := req.Theme
+	if theme == "" {
+		theme = req.Document.ThinkingStructure.Theme
+	}
+	analysisType := req.AnalysisType
+	if analysisType == "" {
+		analysisType = TypeComprehensive
+	}
+
+	h := sha256.New()
+	for _, part := range []string{provider, analysisType, theme} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// New - 設定に応じた Analyzer を生成
+func New(cfg config.AIConfig) Analyzer {
+	if cfg.Provider == ProviderHTTP {
+		return NewLLMAnalyzer(cfg)
+	}
+	return NewRuleAnalyzer()
+}
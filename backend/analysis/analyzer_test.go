@@ -0,0 +1,30 @@
+package analysis_test
+
+import (
+	"testing"
+
+	"thinking-blocks-backend/analysis"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	base, err := analysis.Fingerprint(testRequest(t, ""), analysis.ProviderRule)
+	assert.NoError(t, err)
+
+	// 省略時の分析タイプ・テーマは既定値と同じ扱い
+	explicit := testRequest(t, analysis.TypeComprehensive)
+	explicit.Theme = "research"
+	same, _ := analysis.Fingerprint(explicit, analysis.ProviderRule)
+	assert.Equal(t, base, same)
+
+	otherType, _ := analysis.Fingerprint(testRequest(t, analysis.TypeQuick), analysis.ProviderRule)
+	otherProvider, _ := analysis.Fingerprint(testRequest(t, ""), analysis.ProviderHTTP)
+	edited := testRequest(t, "")
+	edited.Document.ThinkingStructure.Blocks[0].Text = "別の問い"
+	otherContent, _ := analysis.Fingerprint(edited, analysis.ProviderRule)
+
+	assert.NotEqual(t, base, otherType)
+	assert.NotEqual(t, base, otherProvider)
+	assert.NotEqual(t, base, otherContent)
+}
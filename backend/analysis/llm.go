@@ -0,0 +1,199 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/thinking"
+)
+
+const systemPrompt = "あなたは思考整理を支援するコーチです。ユーザーの思考ブロック構造を読み、日本語で1行につき1つの助言を返してください。"
+
+// LLMAnalyzer - OpenAI互換のチャットAPIを呼び出す分析
+// 統計・パターンはルールベースで算出し、LLMの応答を Insights として付け加える
+type LLMAnalyzer struct {
+	client       *http.Client
+	endpoint     string
+	apiKey       string
+	model        string
+	maxRetries   int
+	retryBackoff time.Duration
+	rules        *RuleAnalyzer
+}
+
+// NewLLMAnalyzer - LLMの Analyzer を生成
+func NewLLMAnalyzer(cfg config.AIConfig) *LLMAnalyzer {
+	return &LLMAnalyzer{
+		client:       &http.Client{Timeout: cfg.Timeout},
+		endpoint:     cfg.Endpoint,
+		apiKey:       cfg.APIKey,
+		model:        cfg.Model,
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: cfg.RetryBackoff,
+		rules:        NewRuleAnalyzer(),
+	}
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// promptBlock - プロンプトに含めるブロックの情報
+type promptBlock struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Text        string   `json:"text,omitempty"`
+	Connections []string `json:"connections,omitempty"`
+}
+
+// Analyze - ルールベースの結果にLLMの助言を加える
+func (a *LLMAnalyzer) Analyze(ctx context.Context, req Request) (*Result, error) {
+	result, err := a.rules.Analyze(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	strategy, _ := StrategyFor(req.AnalysisType)
+
+	body, err := json.Marshal(chatRequest{
+		Model:    a.model,
+		Messages: buildMessages(strategy, req, &result.Analysis),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := a.complete(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Provider = ProviderHTTP
+	result.Insights = parseInsights(content, strategy.MaxInsights)
+	return result, nil
+}
+
+// Provider - プロバイダー名
+func (a *LLMAnalyzer) Provider() string {
+	return ProviderHTTP
+}
+
+func buildMessages(strategy Strategy, req Request, analysis *thinking.Analysis) []chatMessage {
+	blocks := make([]promptBlock, 0, len(req.Document.Blocks()))
+	for _, b := range req.Document.Blocks() {
+		blocks = append(blocks, promptBlock{ID: b.ID, Type: b.Type, Text: b.Text, Connections: b.Connections})
+	}
+
+	theme := req.Theme
+	if theme == "" {
+		theme = req.Document.ThinkingStructure.Theme
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"theme":    theme,
+		"blocks":   blocks,
+		"stats":    analysis.Stats,
+		"patterns": analysis.Patterns,
+	})
+
+	return []chatMessage{
+		{Role: "system", Content: systemPrompt + "\n" + strategy.Instruction + fmt.Sprintf("\n助言は最大%d個までにしてください。", strategy.MaxInsights)},
+		{Role: "user", Content: string(payload)},
+	}
+}
+
+// complete - チャットAPIを呼び出す。通信エラー・429・5xxは指数バックオフで再試行する
+func (a *LLMAnalyzer) complete(ctx context.Context, body []byte) (string, error) {
+	var lastErr error
+
+	for attempt := 0; attempt <= a.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(a.retryBackoff << (attempt - 1)):
+			}
+		}
+
+		content, retryable, err := a.send(ctx, body)
+		if err == nil {
+			return content, nil
+		}
+		lastErr = err
+		if !retryable || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return "", fmt.Errorf("llm request failed: %w", lastErr)
+}
+
+func (a *LLMAnalyzer) send(ctx context.Context, body []byte) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return "", retryable, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var parsed chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return "", false, fmt.Errorf("invalid response: %w", err)
+	}
+	if len(parsed.Choices) == 0 {
+		return "", false, fmt.Errorf("empty response")
+	}
+
+	return parsed.Choices[0].Message.Content, false, nil
+}
+
+var bulletPattern = regexp.MustCompile(`^(?:[-*・•]|\d+[.)])\s*`)
+
+// parseInsights - 応答を1行1件の助言に分割（箇条書きの記号は取り除く）
+func parseInsights(content string, limit int) []string {
+	insights := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(bulletPattern.ReplaceAllString(strings.TrimSpace(line), ""))
+		if line == "" {
+			continue
+		}
+		insights = append(insights, line)
+		if limit > 0 && len(insights) >= limit {
+			break
+		}
+	}
+	return insights
+}
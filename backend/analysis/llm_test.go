@@ -0,0 +1,176 @@
+package analysis_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"thinking-blocks-backend/analysis"
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/thinking"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRequest(t *testing.T, analysisType string) analysis.Request {
+	t.Helper()
+	doc, appErr := thinking.Parse([]byte(`{"thinking_structure": {"theme": "research", "blocks": [
+		{"id": "a", "type": "thinking_why", "text": "なぜ売上が落ちたのか"},
+		{"id": "b", "type": "thinking_how", "text": "顧客に聞く"},
+		{"id": "c", "type": "thinking_what", "text": "アンケートを作る"}
+	]}}`))
+	if appErr != nil {
+		t.Fatalf("parse: %v", appErr)
+	}
+	return analysis.Request{Document: doc, AnalysisType: analysisType}
+}
+
+func testAIConfig(endpoint string) config.AIConfig {
+	return config.AIConfig{
+		Provider:     analysis.ProviderHTTP,
+		Endpoint:     endpoint,
+		APIKey:       "test-key",
+		Model:        "test-model",
+		Timeout:      time.Second,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}
+}
+
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+}
+
+func chatReply(w http.ResponseWriter, content string) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []interface{}{
+			map[string]interface{}{"message": map[string]string{"role": "assistant", "content": content}},
+		},
+	})
+}
+
+func TestRuleAnalyzer(t *testing.T) {
+	result, err := analysis.New(config.AIConfig{Provider: analysis.ProviderRule}).Analyze(context.Background(), testRequest(t, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, analysis.ProviderRule, result.Provider)
+	assert.Equal(t, analysis.TypeComprehensive, result.AnalysisType)
+	assert.Equal(t, []string{"論理的展開パターン検出"}, result.Patterns)
+	assert.Empty(t, result.Insights)
+
+	_, err = analysis.NewRuleAnalyzer().Analyze(context.Background(), testRequest(t, "astrology"))
+	assert.ErrorIs(t, err, analysis.ErrUnknownAnalysisType)
+}
+
+func TestLLMAnalyzer(t *testing.T) {
+	var received chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		json.NewDecoder(r.Body).Decode(&received)
+		chatReply(w, "1. 顧客の声を観察しましょう\n\n- 振り返りを追加しましょう\n")
+	}))
+	defer server.Close()
+
+	result, err := analysis.New(testAIConfig(server.URL)).Analyze(context.Background(), testRequest(t, analysis.TypeDeep))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, analysis.ProviderHTTP, result.Provider)
+	assert.Equal(t, analysis.TypeDeep, result.AnalysisType)
+	assert.Equal(t, []string{"顧客の声を観察しましょう", "振り返りを追加しましょう"}, result.Insights)
+	// ルールベースの統計も含まれる
+	assert.Equal(t, 3, result.Stats.Total)
+
+	assert.Equal(t, "test-model", received.Model)
+	if assert.Len(t, received.Messages, 2) {
+		deep, _ := analysis.StrategyFor(analysis.TypeDeep)
+		assert.Contains(t, received.Messages[0].Content, deep.Instruction)
+		assert.Contains(t, received.Messages[1].Content, "なぜ売上が落ちたのか")
+		assert.Contains(t, received.Messages[1].Content, `"theme":"research"`)
+	}
+}
+
+func TestLLMAnalyzerStrategyLimitsInsights(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chatReply(w, "一つ目\n二つ目\n三つ目")
+	}))
+	defer server.Close()
+
+	result, err := analysis.New(testAIConfig(server.URL)).Analyze(context.Background(), testRequest(t, analysis.TypeQuick))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"一つ目"}, result.Insights)
+}
+
+func TestLLMAnalyzerRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		chatReply(w, "回復しました")
+	}))
+	defer server.Close()
+
+	result, err := analysis.New(testAIConfig(server.URL)).Analyze(context.Background(), testRequest(t, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"回復しました"}, result.Insights)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestLLMAnalyzerGivesUp(t *testing.T) {
+	cases := []struct {
+		name          string
+		status        int
+		expectedCalls int32
+	}{
+		{"server errors exhaust retries", http.StatusInternalServerError, 3},
+		{"client errors are not retried", http.StatusUnauthorized, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			_, err := analysis.New(testAIConfig(server.URL)).Analyze(context.Background(), testRequest(t, ""))
+			assert.Error(t, err)
+			assert.Equal(t, tc.expectedCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestLLMAnalyzerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := testAIConfig(server.URL)
+	cfg.Timeout = 20 * time.Millisecond
+	cfg.MaxRetries = 1
+
+	start := time.Now()
+	_, err := analysis.New(cfg).Analyze(context.Background(), testRequest(t, ""))
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "llm request failed"))
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,34 @@
+package analysis
+
+import (
+	"context"
+
+	"thinking-blocks-backend/thinking"
+)
+
+// RuleAnalyzer - ルールベースの決定的な分析
+type RuleAnalyzer struct{}
+
+// NewRuleAnalyzer - ルールベースの Analyzer を生成
+func NewRuleAnalyzer() *RuleAnalyzer {
+	return &RuleAnalyzer{}
+}
+
+// Analyze - ブロックの統計・パターン・改善提案を算出
+func (a *RuleAnalyzer) Analyze(ctx context.Context, req Request) (*Result, error) {
+	strategy, ok := StrategyFor(req.AnalysisType)
+	if !ok {
+		return nil, ErrUnknownAnalysisType
+	}
+
+	return &Result{
+		Analysis:     *thinking.Analyze(req.Document, req.Theme),
+		AnalysisType: strategy.Type,
+		Provider:     ProviderRule,
+	}, nil
+}
+
+// Provider - プロバイダー名
+func (a *RuleAnalyzer) Provider() string {
+	return ProviderRule
+}
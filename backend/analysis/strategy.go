@@ -0,0 +1,48 @@
+package analysis
+
+// 分析タイプ（リクエストの analysis_type）
+const (
+	TypeComprehensive = "comprehensive"
+	TypeQuick         = "quick"
+	TypeDeep          = "deep"
+	TypeCritical      = "critical"
+)
+
+// Strategy - 分析タイプごとのプロンプト戦略
+type Strategy struct {
+	Type        string
+	Instruction string
+	MaxInsights int
+}
+
+var strategies = map[string]Strategy{
+	TypeComprehensive: {
+		Type:        TypeComprehensive,
+		Instruction: "思考構造全体を見渡し、論理の流れ・抜けている視点・次に追加すべきブロックについて具体的な助言をしてください。",
+		MaxInsights: 5,
+	},
+	TypeQuick: {
+		Type:        TypeQuick,
+		Instruction: "最も重要な改善点だけを短く指摘してください。",
+		MaxInsights: 1,
+	},
+	TypeDeep: {
+		Type:        TypeDeep,
+		Instruction: "WHYブロックを起点に、さらに掘り下げるための問いを投げかけてください。答えではなく問いを返してください。",
+		MaxInsights: 5,
+	},
+	TypeCritical: {
+		Type:        TypeCritical,
+		Instruction: "前提の飛躍・根拠の不足・反対意見の見落としを批判的に指摘してください。",
+		MaxInsights: 3,
+	},
+}
+
+// StrategyFor - 分析タイプに対応する戦略を返す（空の場合は comprehensive）
+func StrategyFor(analysisType string) (Strategy, bool) {
+	if analysisType == "" {
+		analysisType = TypeComprehensive
+	}
+	s, ok := strategies[analysisType]
+	return s, ok
+}
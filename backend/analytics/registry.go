@@ -0,0 +1,207 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"thinking-blocks-backend/utils"
+)
+
+// FieldType - Data のフィールドの型
+type FieldType string
+
+const (
+	FieldString  FieldType = "string"
+	FieldNumber  FieldType = "number"
+	FieldInteger FieldType = "integer"
+	FieldBoolean FieldType = "boolean"
+	FieldObject  FieldType = "object"
+	FieldArray   FieldType = "array"
+)
+
+// MaxStringLength - 文字列フィールドの既定の最大長
+const MaxStringLength = 1000
+
+// FieldSpec - Data のフィールドの定義
+type FieldSpec struct {
+	Type      FieldType
+	Required  bool
+	Enum      []string // 文字列の場合の許可値
+	MaxLength int      // 文字列の最大長（0の場合は MaxStringLength）
+}
+
+// EventSpec - イベント種別の定義
+// AdditionalFields が false の場合、Fields にないキーを拒否する
+type EventSpec struct {
+	Fields           map[string]FieldSpec
+	AdditionalFields bool
+}
+
+// Registry - 記録を許可するイベント種別
+type Registry struct {
+	specs map[string]EventSpec
+}
+
+// NewRegistry - イベント種別の定義から Registry を生成
+func NewRegistry(specs map[string]EventSpec) *Registry {
+	return &Registry{specs: specs}
+}
+
+// DefaultRegistry - エディタが送信するイベント種別
+func DefaultRegistry() *Registry {
+	blockID := FieldSpec{Type: FieldString, MaxLength: 128}
+	blockType := FieldSpec{Type: FieldString, Required: true, MaxLength: 128}
+
+	return NewRegistry(map[string]EventSpec{
+		"page_view":       {Fields: map[string]FieldSpec{"path": {Type: FieldString}}},
+		"project_created": {},
+		"project_opened":  {},
+		"project_saved":   {Fields: map[string]FieldSpec{"block_count": {Type: FieldInteger}}},
+		"block_created":   {Fields: map[string]FieldSpec{"block_id": blockID, "block_type": blockType}},
+		"block_updated":   {Fields: map[string]FieldSpec{"block_id": blockID}},
+		"block_deleted":   {Fields: map[string]FieldSpec{"block_id": blockID, "block_type": blockType}},
+		"block_moved":     {Fields: map[string]FieldSpec{"block_id": blockID}},
+		"block_connected": {Fields: map[string]FieldSpec{
+			"from": {Type: FieldString, Required: true, MaxLength: 128},
+			"to":   {Type: FieldString, Required: true, MaxLength: 128},
+		}},
+		"analysis_requested": {Fields: map[string]FieldSpec{
+			"analysis_type": {Type: FieldString, Enum: []string{"comprehensive", "quick", "deep", "critical"}},
+		}},
+		"share_link_created": {Fields: map[string]FieldSpec{
+			"permission": {Type: FieldString, Enum: []string{"view", "edit"}},
+		}},
+		"share_link_opened": {},
+	})
+}
+
+// Types - 登録済みのイベント種別（名前順）
+func (r *Registry) Types() []string {
+	return sortedKeys(r.specs)
+}
+
+// Validate - イベント種別と Data を検証
+// prefix はエラーのフィールド名の前に付ける（一括記録の "events[3]." など）
+func (r *Registry) Validate(prefix, eventType string, data json.RawMessage) []utils.FieldError {
+	var errs []utils.FieldError
+	add := func(field, message string) {
+		errs = append(errs, utils.FieldError{Field: prefix + field, Message: message})
+	}
+
+	if eventType == "" {
+		add("event_type", "is required")
+		return errs
+	}
+	spec, ok := r.specs[eventType]
+	if !ok {
+		add("event_type", "is not a registered event type")
+		return errs
+	}
+
+	values := map[string]json.RawMessage{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
+		if err := json.Unmarshal(trimmed, &values); err != nil {
+			add("data", "must be a JSON object")
+			return errs
+		}
+	}
+
+	for _, name := range sortedKeys(spec.Fields) {
+		field := spec.Fields[name]
+		raw, present := values[name]
+		if !present || bytes.Equal(raw, []byte("null")) {
+			if field.Required {
+				add("data."+name, "is required")
+			}
+			continue
+		}
+		if msg := field.check(raw); msg != "" {
+			add("data."+name, msg)
+		}
+	}
+
+	if !spec.AdditionalFields {
+		for _, name := range sortedKeys(values) {
+			if _, known := spec.Fields[name]; !known {
+				add("data."+name, "is not allowed")
+			}
+		}
+	}
+
+	return errs
+}
+
+// check - 値が定義に合っているか。合っていない場合は理由を返す
+func (f FieldSpec) check(raw json.RawMessage) string {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "must be valid JSON"
+	}
+
+	switch f.Type {
+	case FieldString:
+		s, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		maxLength := f.MaxLength
+		if maxLength == 0 {
+			maxLength = MaxStringLength
+		}
+		if utf8.RuneCountInString(s) > maxLength {
+			return fmt.Sprintf("must be at most %d characters", maxLength)
+		}
+		if len(f.Enum) > 0 && !contains(f.Enum, s) {
+			return "must be one of " + strings.Join(f.Enum, ", ")
+		}
+	case FieldNumber:
+		if _, ok := value.(json.Number); !ok {
+			return "must be a number"
+		}
+	case FieldInteger:
+		n, ok := value.(json.Number)
+		if !ok {
+			return "must be an integer"
+		}
+		if _, err := n.Int64(); err != nil {
+			return "must be an integer"
+		}
+	case FieldBoolean:
+		if _, ok := value.(bool); !ok {
+			return "must be a boolean"
+		}
+	case FieldObject:
+		if _, ok := value.(map[string]interface{}); !ok {
+			return "must be an object"
+		}
+	case FieldArray:
+		if _, ok := value.([]interface{}); !ok {
+			return "must be an array"
+		}
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package analytics_test
+
+import (
+	"testing"
+
+	"thinking-blocks-backend/analytics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryValidate(t *testing.T) {
+	registry := analytics.NewRegistry(map[string]analytics.EventSpec{
+		"block_created": {Fields: map[string]analytics.FieldSpec{
+			"block_type": {Type: analytics.FieldString, Required: true, MaxLength: 5},
+			"depth":      {Type: analytics.FieldInteger},
+			"mode":       {Type: analytics.FieldString, Enum: []string{"drag", "key"}},
+		}},
+		"page_view": {AdditionalFields: true},
+	})
+
+	cases := []struct {
+		name      string
+		eventType string
+		data      string
+		fields    []string
+	}{
+		{"valid", "block_created", `{"block_type": "why", "depth": 2, "mode": "drag"}`, nil},
+		{"additional fields allowed", "page_view", `{"anything": [1, 2]}`, nil},
+		{"no data", "page_view", ``, nil},
+		{"missing event type", "", `{}`, []string{"event_type"}},
+		{"unknown event type", "block_exploded", `{}`, []string{"event_type"}},
+		{"data not object", "page_view", `[1]`, []string{"data"}},
+		{"missing required", "block_created", `{}`, []string{"data.block_type"}},
+		{"null required", "block_created", `{"block_type": null}`, []string{"data.block_type"}},
+		{"wrong type", "block_created", `{"block_type": 3, "depth": 1.5}`, []string{"data.block_type", "data.depth"}},
+		{"too long", "block_created", `{"block_type": "thinking"}`, []string{"data.block_type"}},
+		{"not in enum", "block_created", `{"block_type": "why", "mode": "voice"}`, []string{"data.mode"}},
+		{"unknown field", "block_created", `{"block_type": "why", "color": "red"}`, []string{"data.color"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := registry.Validate("events[0].", tc.eventType, []byte(tc.data))
+
+			var fields []string
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			var expected []string
+			for _, f := range tc.fields {
+				expected = append(expected, "events[0]."+f)
+			}
+			assert.Equal(t, expected, fields)
+		})
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	registry := analytics.DefaultRegistry()
+
+	assert.Contains(t, registry.Types(), "block_created")
+	assert.Empty(t, registry.Validate("", "block_created", []byte(`{"block_type": "thinking_why", "block_id": "b1"}`)))
+	assert.NotEmpty(t, registry.Validate("", "analysis_requested", []byte(`{"analysis_type": "astrology"}`)))
+}
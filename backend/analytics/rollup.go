@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const rollupStateID = "daily"
+
+// RollupGrace - 日が変わってから集計するまでの猶予（バッファ経由で遅れて届くイベントを含めるため）
+const RollupGrace = time.Hour
+
+// TruncateDay - UTCの0時に切り捨て
+func TruncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// RolledUpTo - 日次集計が済んでいる範囲（この時刻より前の日は集計済み）。未集計の場合はゼロ値
+func RolledUpTo(db *gorm.DB) (time.Time, error) {
+	var state database.AnalyticsRollupState
+	err := db.Where("id = ?", rollupStateID).First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return state.RolledUpTo.UTC(), nil
+}
+
+// RollupDaily - 未集計の日から、猶予を差し引いた現在時刻の前日までを日次集計する
+// 日ごとにトランザクションで集計と進捗を更新するため、途中で失敗しても再実行できる
+func RollupDaily(db *gorm.DB, now time.Time) (time.Time, error) {
+	start, err := RolledUpTo(db)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if start.IsZero() {
+		var first database.AnalyticsEvent
+		err := db.Order("created_at").First(&first).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return start, nil
+		}
+		if err != nil {
+			return start, err
+		}
+		start = TruncateDay(first.CreatedAt)
+	}
+
+	end := TruncateDay(now.Add(-RollupGrace))
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if err := rollupDay(db, day); err != nil {
+			return day, err
+		}
+	}
+
+	if end.After(start) {
+		return end, nil
+	}
+	return start, nil
+}
+
+func rollupDay(db *gorm.DB, day time.Time) error {
+	next := day.AddDate(0, 0, 1)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rows []database.AnalyticsDailyRollup
+		if err := tx.Model(&database.AnalyticsEvent{}).
+			Select("event_type, COALESCE(project_id, '') AS project_id, COALESCE(user_id, '') AS user_id, COUNT(*) AS count").
+			Where("created_at >= ? AND created_at < ?", day, next).
+			Group("event_type, COALESCE(project_id, ''), COALESCE(user_id, '')").
+			Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("day = ?", day).Delete(&database.AnalyticsDailyRollup{}).Error; err != nil {
+			return err
+		}
+		for i := range rows {
+			rows[i].Day = day
+		}
+		if len(rows) > 0 {
+			if err := tx.CreateInBatches(rows, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rolled_up_to", "updated_at"}),
+		}).Create(&database.AnalyticsRollupState{ID: rollupStateID, RolledUpTo: next}).Error
+	})
+}
+
+// PurgeExpired - 保持期間を過ぎた生イベントを削除
+// 日次集計が済んでいない日のイベントは保持期間を過ぎていても残す
+func PurgeExpired(db *gorm.DB, now time.Time, retention time.Duration) (int64, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	rolledUpTo, err := RolledUpTo(db)
+	if err != nil || rolledUpTo.IsZero() {
+		return 0, err
+	}
+
+	cutoff := now.Add(-retention).UTC()
+	if cutoff.After(rolledUpTo) {
+		cutoff = rolledUpTo
+	}
+
+	result := db.Where("created_at < ?", cutoff).Delete(&database.AnalyticsEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// RunMaintenance - 日次集計と保持期間の削除を定期的に実行（ctx が終了するまで）
+func RunMaintenance(ctx context.Context, db *gorm.DB, cfg config.AnalyticsConfig) {
+	if cfg.MaintenanceInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cfg.MaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now().UTC()
+		if _, err := RollupDaily(db, now); err != nil {
+			log.Printf("Failed to roll up analytics events: %v", err)
+		}
+		if purged, err := PurgeExpired(db, now, cfg.Retention); err != nil {
+			log.Printf("Failed to purge analytics events: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d analytics events older than %s", purged, cfg.Retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
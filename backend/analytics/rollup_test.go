@@ -0,0 +1,99 @@
+package analytics_test
+
+import (
+	"testing"
+	"time"
+
+	"thinking-blocks-backend/analytics"
+	"thinking-blocks-backend/database"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func seedEvents(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	events := []database.AnalyticsEvent{
+		{UserID: "alice", ProjectID: "p1", EventType: "block_created", CreatedAt: time.Date(2025, 10, 27, 9, 0, 0, 0, time.UTC)},
+		{UserID: "alice", ProjectID: "p1", EventType: "block_created", CreatedAt: time.Date(2025, 10, 27, 18, 0, 0, 0, time.UTC)},
+		{UserID: "bob", EventType: "project_opened", CreatedAt: time.Date(2025, 10, 27, 20, 0, 0, 0, time.UTC)},
+		{UserID: "alice", ProjectID: "p1", EventType: "block_created", CreatedAt: time.Date(2025, 10, 29, 12, 0, 0, 0, time.UTC)},
+		{UserID: "carol", ProjectID: "p2", EventType: "block_created", CreatedAt: time.Date(2025, 10, 30, 0, 30, 0, 0, time.UTC)},
+	}
+	if err := db.Create(&events).Error; err != nil {
+		t.Fatalf("failed to seed events: %v", err)
+	}
+}
+
+func TestRollupDaily(t *testing.T) {
+	db := setupTestDB(t)
+	seedEvents(t, db)
+
+	// 10/30 0:30 は猶予期間内のため 10/29 までを集計
+	rolledUpTo, err := analytics.RollupDaily(db, time.Date(2025, 10, 30, 0, 30, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 10, 29, 0, 0, 0, 0, time.UTC), rolledUpTo)
+
+	// 猶予を過ぎると前日まで集計する
+	rolledUpTo, err = analytics.RollupDaily(db, time.Date(2025, 10, 30, 2, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 10, 30, 0, 0, 0, 0, time.UTC), rolledUpTo)
+
+	stored, err := analytics.RolledUpTo(db)
+	assert.NoError(t, err)
+	assert.Equal(t, rolledUpTo, stored)
+
+	var rows []database.AnalyticsDailyRollup
+	db.Order("day, event_type, user_id").Find(&rows)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, "alice", rows[0].UserID)
+		assert.Equal(t, int64(2), rows[0].Count)
+		assert.Equal(t, "project_opened", rows[1].EventType)
+		assert.Equal(t, "", rows[1].ProjectID)
+		assert.Equal(t, time.Date(2025, 10, 29, 0, 0, 0, 0, time.UTC), rows[2].Day.UTC())
+	}
+
+	// 再実行しても重複しない
+	_, err = analytics.RollupDaily(db, time.Date(2025, 10, 30, 3, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	var count int64
+	db.Model(&database.AnalyticsDailyRollup{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestRollupDailyWithoutEvents(t *testing.T) {
+	db := setupTestDB(t)
+
+	rolledUpTo, err := analytics.RollupDaily(db, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, rolledUpTo.IsZero())
+}
+
+func TestPurgeExpired(t *testing.T) {
+	db := setupTestDB(t)
+	seedEvents(t, db)
+	now := time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC)
+
+	// 集計前は保持期間を過ぎていても削除しない
+	purged, err := analytics.PurgeExpired(db, now, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	// 集計済みでも保持期間内のイベントは残す
+	_, err = analytics.RollupDaily(db, time.Date(2025, 10, 30, 2, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	purged, err = analytics.PurgeExpired(db, now, now.Sub(time.Date(2025, 10, 28, 0, 0, 0, 0, time.UTC)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+
+	// 保持期間を過ぎていても未集計の日（10/30）は残す
+	purged, err = analytics.PurgeExpired(db, now, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.Equal(t, int64(1), countEvents(db))
+
+	// 0 は無期限
+	purged, err = analytics.PurgeExpired(db, now, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+}
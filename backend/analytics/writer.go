@@ -0,0 +1,155 @@
+// Package analytics はアナリティクスイベントの非同期書き込みを提供する
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/database"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrBufferFull - バッファが一杯で受け付けられない
+	ErrBufferFull = errors.New("analytics buffer is full")
+	// ErrWriterClosed - 停止済みの Writer への書き込み
+	ErrWriterClosed = errors.New("analytics writer is closed")
+)
+
+// Writer - イベントをバッファに溜め、件数または間隔でまとめてINSERTする
+type Writer struct {
+	db  *gorm.DB
+	cfg config.AnalyticsConfig
+
+	mu      sync.Mutex
+	pending []database.AnalyticsEvent
+	closed  bool
+
+	flushNow chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewWriter - Writer を生成して書き込みループを開始
+// BufferSize を超えるイベントは受け付けず、BatchSize 件溜まるか FlushInterval ごとに書き込む
+func NewWriter(db *gorm.DB, cfg config.AnalyticsConfig) *Writer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.BufferSize < cfg.BatchSize {
+		cfg.BufferSize = cfg.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 2 * time.Second
+	}
+
+	w := &Writer{
+		db:       db,
+		cfg:      cfg,
+		flushNow: make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Enqueue - イベントをバッファに追加
+// 全件入りきらない場合は1件も追加せず ErrBufferFull を返す
+func (w *Writer) Enqueue(events ...database.AnalyticsEvent) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if len(w.pending)+len(events) > w.cfg.BufferSize {
+		return ErrBufferFull
+	}
+
+	// SQLite では created_at を文字列として比較するため、日時は UTC にそろえて保存する
+	now := time.Now().UTC()
+	for _, event := range events {
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = now
+		} else {
+			event.CreatedAt = event.CreatedAt.UTC()
+		}
+		w.pending = append(w.pending, event)
+	}
+
+	if len(w.pending) >= w.cfg.BatchSize {
+		select {
+		case w.flushNow <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush - バッファ内のイベントを同期的に書き込む
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	events := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	if len(events) == 0 {
+		return nil
+	}
+	if err := w.db.CreateInBatches(events, w.cfg.BatchSize).Error; err != nil {
+		return fmt.Errorf("dropped %d events: %w", len(events), err)
+	}
+	return nil
+}
+
+// Close - 受け付けを停止し、残りのイベントを書き込んでから終了
+func (w *Writer) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.flushNow:
+		case <-w.stop:
+			w.flush()
+			return
+		}
+		w.flush()
+	}
+}
+
+// flush - 書き込みに失敗したイベントはログに残して破棄する（バッファを溢れさせないため）
+func (w *Writer) flush() {
+	if err := w.Flush(); err != nil {
+		log.Printf("Failed to write analytics events: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package analytics_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"thinking-blocks-backend/analytics"
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/database"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+func countEvents(db *gorm.DB) int64 {
+	var count int64
+	db.Model(&database.AnalyticsEvent{}).Count(&count)
+	return count
+}
+
+func events(n int) []database.AnalyticsEvent {
+	out := make([]database.AnalyticsEvent, n)
+	for i := range out {
+		out[i] = database.AnalyticsEvent{UserID: "alice", EventType: "block_created"}
+	}
+	return out
+}
+
+func TestWriterFlushesBySize(t *testing.T) {
+	db := setupTestDB(t)
+	w := analytics.NewWriter(db, config.AnalyticsConfig{BufferSize: 100, BatchSize: 5, FlushInterval: time.Hour})
+	defer w.Close(context.Background())
+
+	assert.NoError(t, w.Enqueue(events(4)...))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(0), countEvents(db))
+
+	assert.NoError(t, w.Enqueue(events(1)...))
+	assert.Eventually(t, func() bool { return countEvents(db) == 5 }, time.Second, 5*time.Millisecond)
+}
+
+func TestWriterFlushesByInterval(t *testing.T) {
+	db := setupTestDB(t)
+	w := analytics.NewWriter(db, config.AnalyticsConfig{BufferSize: 100, BatchSize: 50, FlushInterval: 20 * time.Millisecond})
+	defer w.Close(context.Background())
+
+	assert.NoError(t, w.Enqueue(events(3)...))
+	assert.Eventually(t, func() bool { return countEvents(db) == 3 }, time.Second, 5*time.Millisecond)
+}
+
+func TestWriterDrainsOnClose(t *testing.T) {
+	db := setupTestDB(t)
+	w := analytics.NewWriter(db, config.AnalyticsConfig{BufferSize: 100, BatchSize: 50, FlushInterval: time.Hour})
+
+	assert.NoError(t, w.Enqueue(events(7)...))
+	assert.NoError(t, w.Close(context.Background()))
+	assert.Equal(t, int64(7), countEvents(db))
+
+	assert.ErrorIs(t, w.Enqueue(events(1)...), analytics.ErrWriterClosed)
+}
+
+func TestWriterRejectsWhenFull(t *testing.T) {
+	db := setupTestDB(t)
+	w := analytics.NewWriter(db, config.AnalyticsConfig{BufferSize: 10, BatchSize: 10, FlushInterval: time.Hour})
+	defer w.Close(context.Background())
+
+	assert.NoError(t, w.Enqueue(events(8)...))
+	// 入りきらないバッチは1件も追加しない
+	assert.ErrorIs(t, w.Enqueue(events(3)...), analytics.ErrBufferFull)
+	assert.NoError(t, w.Enqueue(events(2)...))
+
+	assert.Eventually(t, func() bool { return countEvents(db) == 10 }, time.Second, 5*time.Millisecond)
+	assert.NoError(t, w.Enqueue(events(3)...))
+}
+
+func TestWriterKeepsEventTime(t *testing.T) {
+	db := setupTestDB(t)
+	w := analytics.NewWriter(db, config.AnalyticsConfig{BufferSize: 10, BatchSize: 10, FlushInterval: time.Hour})
+
+	before := time.Now()
+	assert.NoError(t, w.Enqueue(events(1)...))
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, w.Close(context.Background()))
+
+	var stored database.AnalyticsEvent
+	db.First(&stored)
+	assert.WithinDuration(t, before, stored.CreatedAt, 10*time.Millisecond)
+}
+
+func TestWriterStoresEventTimeInUTC(t *testing.T) {
+	db := setupTestDB(t)
+	w := analytics.NewWriter(db, config.AnalyticsConfig{BufferSize: 10, BatchSize: 10, FlushInterval: time.Hour})
+
+	// 日本時間 10/27 8:00 は UTC では 10/26 23:00
+	event := database.AnalyticsEvent{UserID: "alice", EventType: "block_created", CreatedAt: time.Date(2025, 10, 27, 8, 0, 0, 0, time.FixedZone("JST", 9*60*60))}
+	assert.NoError(t, w.Enqueue(event))
+	assert.NoError(t, w.Close(context.Background()))
+
+	_, err := analytics.RollupDaily(db, time.Date(2025, 10, 28, 2, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	var rows []database.AnalyticsDailyRollup
+	db.Order("day").Find(&rows)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, time.Date(2025, 10, 26, 0, 0, 0, 0, time.UTC), rows[0].Day.UTC())
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"thinking-blocks-backend/analysis"
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/middleware"
+	"thinking-blocks-backend/policy"
+	"thinking-blocks-backend/thinking"
+	"thinking-blocks-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProjectAnalyses - プロジェクトの分析履歴（新しい順）
+func (h *Handler) GetProjectAnalyses(c *gin.Context) {
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionView)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	offset, limit := utils.Paginate(page, pageSize)
+
+	query := h.db.Where("project_id = ?", project.ID)
+	if analysisType := c.Query("analysis_type"); analysisType != "" {
+		query = query.Where("analysis_type = ?", analysisType)
+	}
+
+	var analyses []database.ProjectAnalysis
+	if err := query.Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&analyses).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to fetch analyses"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    analyses,
+		"count":   len(analyses),
+	})
+}
+
+// findStoredAnalysis - 同じ内容の分析結果を検索
+func (h *Handler) findStoredAnalysis(projectID, contentHash string) (*database.ProjectAnalysis, bool) {
+	var stored database.ProjectAnalysis
+	err := h.db.Where("project_id = ? AND content_hash = ?", projectID, contentHash).
+		Order("created_at DESC").
+		First(&stored).Error
+	if err != nil {
+		return nil, false
+	}
+	return &stored, true
+}
+
+// canStoreAnalysis - 分析結果を履歴に残してよいか
+// 閲覧者が任意の内容の分析を履歴に残せないよう、編集権限がない場合は保存済みの内容の分析に限る
+func (h *Handler) canStoreAnalysis(c *gin.Context, project *database.Project, doc *thinking.Document) bool {
+	userID := middleware.CurrentUserID(c)
+	if policy.Can(policy.RoleOf(project, userID, h.findMembership(project.ID, userID)), policy.ActionEdit) {
+		return true
+	}
+
+	stored, appErr := thinking.Parse(project.Content)
+	if appErr != nil {
+		return false
+	}
+	storedContent, err := stored.Marshal()
+	if err != nil {
+		return false
+	}
+	content, err := doc.Marshal()
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(content, storedContent)
+}
+
+// storeAnalysis - 分析結果を履歴に保存（失敗しても分析結果は返す）
+func (h *Handler) storeAnalysis(c *gin.Context, projectID, contentHash string, result *analysis.Result) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Failed to encode analysis: %v", err)
+		return
+	}
+
+	record := database.ProjectAnalysis{
+		ProjectID:    projectID,
+		ContentHash:  contentHash,
+		UserID:       middleware.CurrentUserID(c),
+		AnalysisType: result.AnalysisType,
+		Provider:     result.Provider,
+		TotalBlocks:  result.Stats.Total,
+		MaxDepth:     result.Depth.MaxDepth,
+		AverageDepth: result.Stats.AverageDepth,
+		Result:       raw,
+	}
+	if err := h.db.Create(&record).Error; err != nil {
+		log.Printf("Failed to store analysis: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalysisHistory(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+	router.POST("/api/v1/ai/analyze", handler.AnalyzeThinking)
+	router.GET("/api/v1/projects/:id/analyses", handler.GetProjectAnalyses)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title": "History",
+		"content": map[string]interface{}{
+			"blocks": []interface{}{
+				map[string]interface{}{"id": "a", "type": "thinking_why", "text": "なぜ？"},
+			},
+		},
+	})
+
+	analyze := func(body map[string]interface{}) (int, bool, map[string]interface{}) {
+		body["project_id"] = projectID
+		w := sendJSON(router, "POST", "/api/v1/ai/analyze", ownerToken, body)
+		var response struct {
+			Cached bool                   `json:"cached"`
+			Data   map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Cached, response.Data
+	}
+
+	// content を省略すると保存済みの内容を分析する
+	code, cached, first := analyze(map[string]interface{}{})
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, cached)
+	assert.Equal(t, 1.0, first["stats"].(map[string]interface{})["total"])
+
+	// 同じ内容は保存済みの結果を返す
+	code, cached, second := analyze(map[string]interface{}{})
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, cached)
+	assert.Equal(t, first["timestamp"], second["timestamp"])
+
+	// 内容が変われば再計算する
+	code, cached, third := analyze(map[string]interface{}{
+		"content": map[string]interface{}{
+			"blocks": []interface{}{
+				map[string]interface{}{"id": "a", "type": "thinking_why", "depth": 4},
+				map[string]interface{}{"id": "b", "type": "thinking_why"},
+			},
+		},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, cached)
+	assert.Equal(t, 2.0, third["stats"].(map[string]interface{})["total"])
+
+	w := sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/analyses", ownerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var history struct {
+		Count int `json:"count"`
+		Data  []struct {
+			ContentHash string                 `json:"content_hash"`
+			MaxDepth    int                    `json:"max_depth"`
+			Result      map[string]interface{} `json:"result"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if assert.Equal(t, 2, history.Count) {
+		assert.Equal(t, 4, history.Data[0].MaxDepth)
+		assert.Equal(t, 1, history.Data[1].MaxDepth)
+		assert.NotEqual(t, history.Data[0].ContentHash, history.Data[1].ContentHash)
+		assert.Equal(t, "rule", history.Data[0].Result["provider"])
+	}
+}
+
+func TestAnalysisHistoryRequiresAccess(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+	router.POST("/api/v1/ai/analyze", handler.AnalyzeThinking)
+	router.GET("/api/v1/projects/:id/analyses", handler.GetProjectAnalyses)
+
+	projectID := createTestProject(t, router, issueToken(t, handler, "owner"), map[string]interface{}{
+		"title":   "Private",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+	strangerToken := issueToken(t, handler, "stranger")
+
+	w := sendJSON(router, "POST", "/api/v1/ai/analyze", strangerToken, map[string]interface{}{
+		"project_id": projectID,
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/analyses", strangerToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/analyses", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAnalysisHistoryIgnoresViewerContent(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+	router.POST("/api/v1/ai/analyze", handler.AnalyzeThinking)
+	router.GET("/api/v1/projects/:id/analyses", handler.GetProjectAnalyses)
+	setupMemberRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	content := map[string]interface{}{
+		"blocks": []interface{}{
+			map[string]interface{}{"id": "a", "type": "thinking_why", "text": "なぜ？"},
+		},
+	}
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "History",
+		"content": content,
+	})
+	viewerToken, _ := addMember(t, router, handler, projectID, ownerToken, "viewer", "viewer")
+
+	// 閲覧者が送った保存済みと異なる内容は分析しても履歴に残さない
+	w := sendJSON(router, "POST", "/api/v1/ai/analyze", viewerToken, map[string]interface{}{
+		"project_id": projectID,
+		"content": map[string]interface{}{
+			"blocks": []interface{}{
+				map[string]interface{}{"id": "x", "type": "thinking_how", "text": "捏造"},
+			},
+		},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 保存済みの内容と同じなら閲覧者の分析も残す
+	w = sendJSON(router, "POST", "/api/v1/ai/analyze", viewerToken, map[string]interface{}{
+		"project_id": projectID,
+		"content":    content,
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/analyses", ownerToken, nil)
+	var history struct {
+		Count int `json:"count"`
+		Data  []struct {
+			TotalBlocks int `json:"total_blocks"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &history)
+	if assert.Equal(t, 1, history.Count) {
+		assert.Equal(t, 1, history.Data[0].TotalBlocks)
+	}
+}
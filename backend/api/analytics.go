@@ -0,0 +1,336 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"thinking-blocks-backend/analytics"
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/middleware"
+	"thinking-blocks-backend/policy"
+	"thinking-blocks-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 集計のグループ化
+const (
+	groupByDay       = database.BucketDay
+	groupByWeek      = database.BucketWeek
+	groupByEventType = "event_type"
+)
+
+// MaxBatchEvents - 一括記録で受け付けるイベント数の上限
+const MaxBatchEvents = 1000
+
+// eventInput - 記録するイベント（本文の user_id は受け付けない）
+type eventInput struct {
+	ProjectID string          `json:"project_id"`
+	EventType string          `json:"event_type"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// toEvent - 記録するイベントに変換
+// 認証したユーザー（未認証の場合は空）のイベントとして記録する
+func (in eventInput) toEvent(c *gin.Context) database.AnalyticsEvent {
+	return database.AnalyticsEvent{
+		UserID:    middleware.CurrentUserID(c),
+		ProjectID: in.ProjectID,
+		EventType: in.EventType,
+		Data:      []byte(in.Data),
+	}
+}
+
+// TrackEvent - イベント追跡
+// 書き込みはバッファ経由で非同期に行うため 202 を返す
+func (h *Handler) TrackEvent(c *gin.Context) {
+	var input eventInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	fields := h.eventTypes.Validate("", input.EventType, input.Data)
+	if !h.canTrackProject(c, input.ProjectID, nil) {
+		fields = append(fields, utils.FieldError{Field: "project_id", Message: unknownProjectMessage})
+	}
+	if len(fields) > 0 {
+		respondError(c, utils.NewValidationError("Invalid event", fields))
+		return
+	}
+
+	h.enqueueEvents(c, []database.AnalyticsEvent{input.toEvent(c)})
+}
+
+// TrackEvents - イベントの一括記録
+// 1件でも不正なイベントがあれば全体を拒否する
+func (h *Handler) TrackEvents(c *gin.Context) {
+	var input struct {
+		Events []eventInput `json:"events"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	var fields []utils.FieldError
+	switch {
+	case len(input.Events) == 0:
+		fields = append(fields, utils.FieldError{Field: "events", Message: "must not be empty"})
+	case len(input.Events) > MaxBatchEvents:
+		fields = append(fields, utils.FieldError{Field: "events", Message: fmt.Sprintf("must contain at most %d events", MaxBatchEvents)})
+	}
+
+	events := make([]database.AnalyticsEvent, 0, len(input.Events))
+	visible := map[string]bool{}
+	for i, in := range input.Events {
+		errs := h.eventTypes.Validate(fmt.Sprintf("events[%d].", i), in.EventType, in.Data)
+		if !h.canTrackProject(c, in.ProjectID, visible) {
+			errs = append(errs, utils.FieldError{Field: fmt.Sprintf("events[%d].project_id", i), Message: unknownProjectMessage})
+		}
+		if len(errs) > 0 {
+			fields = append(fields, errs...)
+			continue
+		}
+		events = append(events, in.toEvent(c))
+	}
+
+	if len(fields) > 0 {
+		respondError(c, utils.NewValidationError("Invalid events", fields))
+		return
+	}
+
+	h.enqueueEvents(c, events)
+}
+
+// unknownProjectMessage - 存在しないか閲覧できないプロジェクトのイベント（存在するかどうかは明かさない）
+const unknownProjectMessage = "references a project that does not exist or is not visible"
+
+// canTrackProject - 呼び出し元が閲覧できるプロジェクトのイベントか（project_id が空なら常に記録できる）
+// visible は一括記録で同じプロジェクトを何度も確認しないためのキャッシュ（nil なら使わない）
+func (h *Handler) canTrackProject(c *gin.Context, projectID string, visible map[string]bool) bool {
+	if projectID == "" {
+		return true
+	}
+	if ok, checked := visible[projectID]; checked {
+		return ok
+	}
+
+	ok := false
+	var project database.Project
+	if err := h.db.First(&project, "id = ?", projectID).Error; err == nil {
+		userID := middleware.CurrentUserID(c)
+		ok = policy.Authorize(&project, userID, h.findMembership(project.ID, userID), policy.ActionView) == nil
+	}
+	if visible != nil {
+		visible[projectID] = ok
+	}
+	return ok
+}
+
+// enqueueEvents - イベントをバッファに追加。一杯の場合は 429 を返す
+func (h *Handler) enqueueEvents(c *gin.Context, events []database.AnalyticsEvent) {
+	if err := h.events.Enqueue(events...); err != nil {
+		if errors.Is(err, analytics.ErrBufferFull) {
+			c.Header("Retry-After", "1")
+			respondError(c, utils.NewAppError(http.StatusTooManyRequests, "Too many events", "Analytics buffer is full, retry later"))
+			return
+		}
+		respondError(c, utils.NewAppError(http.StatusServiceUnavailable, "Service unavailable", "Analytics ingestion is shutting down"))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":  true,
+		"accepted": len(events),
+	})
+}
+
+// analyticsGroup - グループごとの集計
+type analyticsGroup struct {
+	Key         string `json:"key"`
+	Count       int64  `json:"count"`
+	UniqueUsers int64  `json:"uniqueUsers"`
+}
+
+// analyticsSummary - 絞り込み全体の集計
+type analyticsSummary struct {
+	TotalEvents    int64 `json:"totalEvents"`
+	UniqueUsers    int64 `json:"uniqueUsers"`
+	UniqueProjects int64 `json:"uniqueProjects"`
+}
+
+// GetAnalytics - 分析データ取得
+// project_id / user_id / event_type / from / to で絞り込み、group_by（day / week / event_type）で集計する
+// 集計するのは呼び出し元が閲覧できるプロジェクトのイベントのみ
+func (h *Handler) GetAnalytics(c *gin.Context) {
+	if _, ok := requireUser(c); !ok {
+		return
+	}
+
+	groupBy := c.DefaultQuery("group_by", groupByDay)
+
+	var fields []utils.FieldError
+	switch groupBy {
+	case groupByDay, groupByWeek, groupByEventType:
+	default:
+		fields = append(fields, utils.FieldError{Field: "group_by", Message: "must be one of day, week, event_type"})
+	}
+
+	from, ok := parseTimeParam(c.Query("from"), false)
+	if !ok {
+		fields = append(fields, utils.FieldError{Field: "from", Message: "must be RFC3339 or YYYY-MM-DD"})
+	}
+	to, ok := parseTimeParam(c.Query("to"), true)
+	if !ok {
+		fields = append(fields, utils.FieldError{Field: "to", Message: "must be RFC3339 or YYYY-MM-DD"})
+	}
+
+	if len(fields) > 0 {
+		respondError(c, utils.NewValidationError("Invalid analytics query", fields))
+		return
+	}
+
+	if projectID := c.Query("project_id"); projectID != "" {
+		if _, ok := h.authorizeProject(c, projectID, policy.ActionView); !ok {
+			return
+		}
+	}
+
+	source, err := h.analyticsSource(c, from, to)
+	if err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to aggregate analytics"))
+		return
+	}
+	events := func() *gorm.DB {
+		return h.db.Table("(?) AS e", source)
+	}
+
+	// 匿名イベント（user_id が空）はユニークユーザーに数えない
+	var summary analyticsSummary
+	if err := events().
+		Select("COALESCE(SUM(count), 0) AS total_events, " +
+			"COUNT(DISTINCT NULLIF(user_id, '')) AS unique_users, " +
+			"COUNT(DISTINCT NULLIF(project_id, '')) AS unique_projects").
+		Scan(&summary).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to aggregate analytics"))
+		return
+	}
+
+	keyExpr := "event_type"
+	order := "count DESC, key"
+	if groupBy != groupByEventType {
+		keyExpr = database.TimeBucket(h.db, "ts", groupBy)
+		order = "key"
+	}
+
+	groups := []analyticsGroup{}
+	if err := events().
+		Select(keyExpr + " AS key, SUM(count) AS count, COUNT(DISTINCT NULLIF(user_id, '')) AS unique_users").
+		Group(keyExpr).
+		Order(order).
+		Scan(&groups).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to aggregate analytics"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"totalEvents":    summary.TotalEvents,
+			"uniqueUsers":    summary.UniqueUsers,
+			"uniqueProjects": summary.UniqueProjects,
+			"groupBy":        groupBy,
+			"stats":          groups,
+		},
+	})
+}
+
+// analyticsSource - 集計対象のイベント（ts, event_type, project_id, user_id, count）
+// 日次集計済みの日は集計テーブル、それ以降は生イベントから読む。集計済みの日の from / to は日単位で扱う
+func (h *Handler) analyticsSource(c *gin.Context, from, to time.Time) (*gorm.DB, error) {
+	rolledUpTo, err := analytics.RolledUpTo(h.db)
+	if err != nil {
+		return nil, err
+	}
+
+	viewable := h.viewableProjects(middleware.CurrentUserID(c))
+	filter := func(query *gorm.DB) *gorm.DB {
+		query = query.Where("project_id IN (?)", viewable)
+		if projectID := c.Query("project_id"); projectID != "" {
+			query = query.Where("project_id = ?", projectID)
+		}
+		if userID := c.Query("user_id"); userID != "" {
+			query = query.Where("user_id = ?", userID)
+		}
+		if eventType := c.Query("event_type"); eventType != "" {
+			query = query.Where("event_type = ?", eventType)
+		}
+		return query
+	}
+
+	raw := filter(h.db.Model(&database.AnalyticsEvent{}).
+		Select("created_at AS ts, event_type, COALESCE(project_id, '') AS project_id, COALESCE(user_id, '') AS user_id, 1 AS count"))
+	if !from.IsZero() {
+		raw = raw.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		raw = raw.Where("created_at < ?", to)
+	}
+	if rolledUpTo.IsZero() {
+		return raw, nil
+	}
+	raw = raw.Where("created_at >= ?", rolledUpTo)
+
+	rollups := filter(h.db.Model(&database.AnalyticsDailyRollup{}).
+		Select("day AS ts, event_type, project_id, user_id, count").
+		Where("day < ?", rolledUpTo))
+	if !from.IsZero() {
+		rollups = rollups.Where("day >= ?", analytics.TruncateDay(from))
+	}
+	if !to.IsZero() {
+		rollups = rollups.Where("day < ?", to)
+	}
+
+	return h.db.Raw("? UNION ALL ?", rollups, raw), nil
+}
+
+// viewableProjects - ユーザーが閲覧できるプロジェクト（自分の・参加している・公開）のIDのサブクエリ
+func (h *Handler) viewableProjects(userID string) *gorm.DB {
+	memberships := h.db.Model(&database.ProjectMember{}).
+		Select("project_id").
+		Where("user_id = ? AND status = ?", userID, database.MemberStatusAccepted)
+	return h.db.Model(&database.Project{}).
+		Select("id").
+		Where("owner_id = ? OR is_public = ? OR id IN (?)", userID, true, memberships)
+}
+
+// parseTimeParam - RFC3339 または YYYY-MM-DD の日時を読み込む
+// 日付のみの終了日は、その日全体を含むよう翌日0時（UTC）にする
+// 保存済みの created_at と比較できるよう、オフセット付きの日時も UTC に変換する
+func parseTimeParam(value string, endOfDay bool) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), true
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
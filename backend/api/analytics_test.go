@@ -0,0 +1,360 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"thinking-blocks-backend/analytics"
+	"thinking-blocks-backend/api"
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type analyticsResponse struct {
+	Data struct {
+		TotalEvents    int    `json:"totalEvents"`
+		UniqueUsers    int    `json:"uniqueUsers"`
+		UniqueProjects int    `json:"uniqueProjects"`
+		GroupBy        string `json:"groupBy"`
+		Stats          []struct {
+			Key         string `json:"key"`
+			Count       int    `json:"count"`
+			UniqueUsers int    `json:"uniqueUsers"`
+		} `json:"stats"`
+	} `json:"data"`
+}
+
+// setupAnalyticsRouter - イベントを記録済みのルーターと、p1・p2 を所有するユーザーのトークンを返す
+func setupAnalyticsRouter(t *testing.T) (*gin.Engine, *gorm.DB, string) {
+	gin.SetMode(gin.TestMode)
+	db, err := setupTestDB()
+	if err != nil {
+		t.Fatalf("failed to set up db: %v", err)
+	}
+
+	projects := []database.Project{
+		{ID: "p1", Title: "Map 1", OwnerID: "analyst"},
+		{ID: "p2", Title: "Map 2", OwnerID: "analyst"},
+	}
+	if err := db.Create(&projects).Error; err != nil {
+		t.Fatalf("failed to seed projects: %v", err)
+	}
+
+	// 2025-10-27 は月曜日
+	events := []database.AnalyticsEvent{
+		{UserID: "alice", ProjectID: "p1", EventType: "block_created", CreatedAt: time.Date(2025, 10, 27, 9, 0, 0, 0, time.UTC)},
+		{UserID: "alice", ProjectID: "p1", EventType: "block_created", CreatedAt: time.Date(2025, 10, 27, 18, 0, 0, 0, time.UTC)},
+		{UserID: "bob", ProjectID: "p1", EventType: "project_opened", CreatedAt: time.Date(2025, 10, 29, 12, 0, 0, 0, time.UTC)},
+		{UserID: "", ProjectID: "p2", EventType: "project_opened", CreatedAt: time.Date(2025, 11, 2, 23, 0, 0, 0, time.UTC)},
+		{UserID: "carol", ProjectID: "p2", EventType: "block_created", CreatedAt: time.Date(2025, 11, 3, 8, 0, 0, 0, time.UTC)},
+	}
+	if err := db.Create(&events).Error; err != nil {
+		t.Fatalf("failed to seed events: %v", err)
+	}
+
+	handler := api.NewHandler(db, nil, testConfig())
+	router := gin.New()
+	router.Use(middleware.Authenticate(handler.Auth()))
+	router.GET("/api/v1/analytics/stats", handler.GetAnalytics)
+	return router, db, issueToken(t, handler, "analyst")
+}
+
+func getAnalytics(t *testing.T, router *gin.Engine, token, query string) analyticsResponse {
+	t.Helper()
+	w := sendJSON(router, "GET", "/api/v1/analytics/stats"+query, token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var response analyticsResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+func TestGetAnalyticsByDay(t *testing.T) {
+	router, _, token := setupAnalyticsRouter(t)
+
+	response := getAnalytics(t, router, token, "")
+	assert.Equal(t, 5, response.Data.TotalEvents)
+	assert.Equal(t, 3, response.Data.UniqueUsers)
+	assert.Equal(t, 2, response.Data.UniqueProjects)
+	assert.Equal(t, "day", response.Data.GroupBy)
+
+	if assert.Len(t, response.Data.Stats, 4) {
+		assert.Equal(t, "2025-10-27", response.Data.Stats[0].Key)
+		assert.Equal(t, 2, response.Data.Stats[0].Count)
+		assert.Equal(t, 1, response.Data.Stats[0].UniqueUsers)
+		assert.Equal(t, "2025-11-03", response.Data.Stats[3].Key)
+	}
+}
+
+func TestGetAnalyticsByWeek(t *testing.T) {
+	router, _, token := setupAnalyticsRouter(t)
+
+	response := getAnalytics(t, router, token, "?group_by=week")
+	if assert.Len(t, response.Data.Stats, 2) {
+		// 日曜（11/2）までは10/27の週
+		assert.Equal(t, "2025-10-27", response.Data.Stats[0].Key)
+		assert.Equal(t, 4, response.Data.Stats[0].Count)
+		assert.Equal(t, 2, response.Data.Stats[0].UniqueUsers)
+		assert.Equal(t, "2025-11-03", response.Data.Stats[1].Key)
+		assert.Equal(t, 1, response.Data.Stats[1].Count)
+	}
+}
+
+func TestGetAnalyticsByEventType(t *testing.T) {
+	router, _, token := setupAnalyticsRouter(t)
+
+	response := getAnalytics(t, router, token, "?group_by=event_type")
+	if assert.Len(t, response.Data.Stats, 2) {
+		assert.Equal(t, "block_created", response.Data.Stats[0].Key)
+		assert.Equal(t, 3, response.Data.Stats[0].Count)
+		assert.Equal(t, 2, response.Data.Stats[0].UniqueUsers)
+		assert.Equal(t, "project_opened", response.Data.Stats[1].Key)
+		assert.Equal(t, 2, response.Data.Stats[1].Count)
+		assert.Equal(t, 1, response.Data.Stats[1].UniqueUsers)
+	}
+}
+
+func TestGetAnalyticsFilters(t *testing.T) {
+	router, _, token := setupAnalyticsRouter(t)
+
+	cases := []struct {
+		query string
+		total int
+	}{
+		{"?project_id=p1", 3},
+		{"?user_id=alice", 2},
+		{"?event_type=project_opened", 2},
+		{"?from=2025-10-29", 3},
+		{"?to=2025-10-29", 3},
+		{"?from=2025-10-27T12:00:00Z&to=2025-11-03T00:00:00Z", 3},
+		{"?from=2025-10-27T21:00:00%2B09:00", 4},
+		{"?project_id=p2&event_type=block_created", 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			assert.Equal(t, tc.total, getAnalytics(t, router, token, tc.query).Data.TotalEvents)
+		})
+	}
+}
+
+func TestGetAnalyticsRejectsInvalidQuery(t *testing.T) {
+	router, _, token := setupAnalyticsRouter(t)
+
+	for _, query := range []string{"?group_by=month", "?from=yesterday", "?to=2025-13-01"} {
+		w := sendJSON(router, "GET", "/api/v1/analytics/stats"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestGetAnalyticsLimitedToViewableProjects(t *testing.T) {
+	router, db, _ := setupAnalyticsRouter(t)
+	public := database.Project{ID: "p3", Title: "Public Map", OwnerID: "someone", IsPublic: true}
+	assert.NoError(t, db.Create(&public).Error)
+	assert.NoError(t, db.Create(&database.AnalyticsEvent{
+		UserID: "dave", ProjectID: "p3", EventType: "project_opened", CreatedAt: time.Date(2025, 11, 3, 9, 0, 0, 0, time.UTC),
+	}).Error)
+
+	w := sendJSON(router, "GET", "/api/v1/analytics/stats", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 閲覧できない p1・p2 のイベントは集計に含めない
+	handler := api.NewHandler(db, nil, testConfig())
+	strangerToken := issueToken(t, handler, "stranger")
+	response := getAnalytics(t, router, strangerToken, "")
+	assert.Equal(t, 1, response.Data.TotalEvents)
+	assert.Equal(t, 1, response.Data.UniqueProjects)
+
+	w = sendJSON(router, "GET", "/api/v1/analytics/stats?project_id=p1", strangerToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestTrackEventsBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, _ := setupTestDB()
+	handler := api.NewHandler(db, nil, testConfig())
+	router := gin.New()
+	router.POST("/api/v1/analytics/events", handler.TrackEvent)
+	router.POST("/api/v1/analytics/events/batch", handler.TrackEvents)
+
+	w := sendJSON(router, "POST", "/api/v1/analytics/events", "", map[string]interface{}{
+		"user_id": "alice", "event_type": "project_opened",
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	w = sendJSON(router, "POST", "/api/v1/analytics/events/batch", "", map[string]interface{}{
+		"events": []interface{}{
+			map[string]interface{}{"user_id": "alice", "event_type": "block_created", "data": map[string]interface{}{"block_type": "thinking_why"}},
+			map[string]interface{}{"user_id": "bob", "event_type": "block_moved"},
+		},
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"success": true, "accepted": 2}`, w.Body.String())
+
+	// 不正なイベントを含むバッチは全体を拒否する
+	w = sendJSON(router, "POST", "/api/v1/analytics/events/batch", "", map[string]interface{}{
+		"events": []interface{}{
+			map[string]interface{}{"event_type": "block_created"},
+			map[string]interface{}{"user_id": "bob"},
+		},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "events[1].event_type")
+
+	w = sendJSON(router, "POST", "/api/v1/analytics/events/batch", "", map[string]interface{}{"events": []interface{}{}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 停止時にバッファ内のイベントが書き込まれる
+	assert.NoError(t, handler.Close(context.Background()))
+	var count int64
+	db.Model(&database.AnalyticsEvent{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestTrackEventsUsesAuthenticatedUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, _ := setupTestDB()
+	handler := api.NewHandler(db, nil, testConfig())
+	router := gin.New()
+	router.Use(middleware.Authenticate(handler.Auth()))
+	router.POST("/api/v1/analytics/events", handler.TrackEvent)
+	router.POST("/api/v1/analytics/events/batch", handler.TrackEvents)
+	token := issueToken(t, handler, "alice")
+
+	// 認証済みの場合は本文の user_id で他人を名乗れない
+	w := sendJSON(router, "POST", "/api/v1/analytics/events", token, map[string]interface{}{
+		"user_id": "bob", "event_type": "project_opened",
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	w = sendJSON(router, "POST", "/api/v1/analytics/events/batch", token, map[string]interface{}{
+		"events": []interface{}{
+			map[string]interface{}{"user_id": "bob", "event_type": "block_moved"},
+			map[string]interface{}{"event_type": "block_moved"},
+		},
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	// 未認証の場合も本文の user_id は使わない
+	w = sendJSON(router, "POST", "/api/v1/analytics/events", "", map[string]interface{}{
+		"user_id": "bob", "event_type": "project_opened",
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	assert.NoError(t, handler.Close(context.Background()))
+	var userIDs []string
+	db.Model(&database.AnalyticsEvent{}).Pluck("user_id", &userIDs)
+	assert.ElementsMatch(t, []string{"alice", "alice", "alice", ""}, userIDs)
+}
+
+func TestTrackEventsRequiresVisibleProject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, _ := setupTestDB()
+	projects := []database.Project{
+		{ID: "private", Title: "Private Map", OwnerID: "alice"},
+		{ID: "public", Title: "Public Map", OwnerID: "alice", IsPublic: true},
+	}
+	require.NoError(t, db.Create(&projects).Error)
+	handler := api.NewHandler(db, nil, testConfig())
+	router := gin.New()
+	router.Use(middleware.Authenticate(handler.Auth()))
+	router.POST("/api/v1/analytics/events", handler.TrackEvent)
+	router.POST("/api/v1/analytics/events/batch", handler.TrackEvents)
+
+	// 閲覧できないプロジェクトと存在しないプロジェクトは区別せずに拒否する
+	for _, token := range []string{"", issueToken(t, handler, "stranger")} {
+		for _, projectID := range []string{"private", "missing"} {
+			w := sendJSON(router, "POST", "/api/v1/analytics/events", token, map[string]interface{}{
+				"project_id": projectID, "event_type": "project_opened",
+			})
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "project_id")
+		}
+	}
+
+	w := sendJSON(router, "POST", "/api/v1/analytics/events/batch", "", map[string]interface{}{
+		"events": []interface{}{
+			map[string]interface{}{"project_id": "public", "event_type": "project_opened"},
+			map[string]interface{}{"project_id": "private", "event_type": "project_opened"},
+		},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "events[1].project_id")
+
+	w = sendJSON(router, "POST", "/api/v1/analytics/events", issueToken(t, handler, "alice"), map[string]interface{}{
+		"project_id": "private", "event_type": "project_opened",
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	w = sendJSON(router, "POST", "/api/v1/analytics/events", "", map[string]interface{}{
+		"project_id": "public", "event_type": "project_opened",
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.NoError(t, handler.Close(context.Background()))
+}
+
+func TestTrackEventsBackpressure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, _ := setupTestDB()
+	cfg := testConfig()
+	cfg.Analytics.BufferSize = 3
+	cfg.Analytics.BatchSize = 3
+	cfg.Analytics.FlushInterval = time.Hour
+	handler := api.NewHandler(db, nil, cfg)
+	defer handler.Close(context.Background())
+
+	router := gin.New()
+	router.POST("/api/v1/analytics/events/batch", handler.TrackEvents)
+
+	batch := func(n int) map[string]interface{} {
+		events := make([]interface{}, n)
+		for i := range events {
+			events[i] = map[string]interface{}{"event_type": "project_opened"}
+		}
+		return map[string]interface{}{"events": events}
+	}
+
+	w := sendJSON(router, "POST", "/api/v1/analytics/events/batch", "", batch(2))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	w = sendJSON(router, "POST", "/api/v1/analytics/events/batch", "", batch(2))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+}
+
+func TestGetAnalyticsReadsRollups(t *testing.T) {
+	router, db, token := setupAnalyticsRouter(t)
+
+	queries := []string{
+		"",
+		"?group_by=week",
+		"?group_by=event_type",
+		"?project_id=p1",
+		"?user_id=alice&group_by=event_type",
+		"?from=2025-10-29",
+		"?to=2025-10-29",
+	}
+	before := make(map[string]analyticsResponse)
+	for _, query := range queries {
+		before[query] = getAnalytics(t, router, token, query)
+	}
+
+	// 10/31 までを集計し、保持期間を過ぎた生イベントを削除（11/2 以降の生イベントは残る）
+	now := time.Date(2025, 11, 1, 2, 0, 0, 0, time.UTC)
+	_, err := analytics.RollupDaily(db, now)
+	assert.NoError(t, err)
+	purged, err := analytics.PurgeExpired(db, now, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+
+	for _, query := range queries {
+		assert.Equal(t, before[query], getAnalytics(t, router, token, query), query)
+	}
+}
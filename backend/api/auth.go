@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"thinking-blocks-backend/auth"
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/middleware"
+	"thinking-blocks-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Register - ユーザー登録
+func (h *Handler) Register(c *gin.Context) {
+	var input struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+		Name     string `json:"name"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, utils.NewBadRequestError(err.Error()))
+		return
+	}
+
+	email := normalizeEmail(input.Email)
+	if !utils.ValidateEmail(email) {
+		respondError(c, utils.NewBadRequestError("Invalid email address"))
+		return
+	}
+
+	hash, err := auth.HashPassword(input.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrPasswordTooShort) || errors.Is(err, auth.ErrPasswordTooLong) {
+			respondError(c, utils.NewBadRequestError(err.Error()))
+			return
+		}
+		respondError(c, utils.NewInternalServerError("Failed to hash password"))
+		return
+	}
+
+	var existing int64
+	h.db.Model(&database.User{}).Where("email = ?", email).Count(&existing)
+	if existing > 0 {
+		respondError(c, utils.NewConflictError("Email is already registered"))
+		return
+	}
+
+	user := database.User{
+		Email:    email,
+		Name:     utils.SanitizeString(input.Name),
+		Password: hash,
+	}
+	if err := h.db.Create(&user).Error; err != nil {
+		// 同時に登録された場合は事前の確認をすり抜けるため、一意制約の違反も重複として扱う
+		if database.IsUniqueViolation(err) {
+			respondError(c, utils.NewConflictError("Email is already registered"))
+			return
+		}
+		respondError(c, utils.NewInternalServerError("Failed to create user"))
+		return
+	}
+
+	token, session, err := h.auth.Issue(user.ID)
+	if err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to issue session"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"user":       user,
+			"token":      token,
+			"expires_at": session.ExpiresAt,
+		},
+	})
+}
+
+// Login - ログイン
+func (h *Handler) Login(c *gin.Context) {
+	var input struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, utils.NewBadRequestError(err.Error()))
+		return
+	}
+
+	var user database.User
+	err := h.db.First(&user, "email = ?", normalizeEmail(input.Email)).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, utils.NewInternalServerError("Failed to fetch user"))
+		return
+	}
+	if err != nil || !auth.CheckPassword(user.Password, input.Password) {
+		respondError(c, utils.NewUnauthorizedError("Invalid email or password"))
+		return
+	}
+
+	token, session, err := h.auth.Issue(user.ID)
+	if err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to issue session"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"user":       user,
+			"token":      token,
+			"expires_at": session.ExpiresAt,
+		},
+	})
+}
+
+// Logout - ログアウト（セッション失効）
+func (h *Handler) Logout(c *gin.Context) {
+	if _, ok := requireUser(c); !ok {
+		return
+	}
+
+	if err := h.auth.Revoke(middleware.CurrentSessionID(c)); err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to revoke session"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Logged out successfully",
+	})
+}
+
+// GetCurrentUser - ログイン中のユーザー取得
+func (h *Handler) GetCurrentUser(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	var user database.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		respondError(c, utils.NewUnauthorizedError("User no longer exists"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    user,
+	})
+}
+
+// requireUser - 認証済みユーザーIDを取得し、未認証なら401を返す
+func requireUser(c *gin.Context) (string, bool) {
+	userID := middleware.CurrentUserID(c)
+	if userID == "" {
+		respondError(c, utils.NewUnauthorizedError("Authentication required"))
+		return "", false
+	}
+	return userID, true
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(utils.SanitizeString(email))
+}
@@ -0,0 +1,148 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"thinking-blocks-backend/api"
+	"thinking-blocks-backend/auth"
+	"thinking-blocks-backend/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupAuthRoutes(router *gin.Engine, handler *api.Handler) {
+	router.POST("/api/v1/auth/register", handler.Register)
+	router.POST("/api/v1/auth/login", handler.Login)
+	router.POST("/api/v1/auth/logout", handler.Logout)
+	router.GET("/api/v1/auth/me", handler.GetCurrentUser)
+}
+
+func postJSON(router *gin.Engine, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRegisterLoginLogout(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupAuthRoutes(router, handler)
+
+	w := postJSON(router, "/api/v1/auth/register", map[string]interface{}{
+		"email":    "Alice@Example.com",
+		"password": "correct-horse",
+		"name":     "Alice",
+	}, "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// 同じメールアドレスでの再登録は拒否
+	w = postJSON(router, "/api/v1/auth/register", map[string]interface{}{
+		"email":    "alice@example.com",
+		"password": "another-password",
+	}, "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// 誤ったパスワード
+	w = postJSON(router, "/api/v1/auth/login", map[string]interface{}{
+		"email":    "alice@example.com",
+		"password": "wrong-password",
+	}, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postJSON(router, "/api/v1/auth/login", map[string]interface{}{
+		"email":    "alice@example.com",
+		"password": "correct-horse",
+	}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var loginResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &loginResponse)
+	loginData := loginResponse["data"].(map[string]interface{})
+	token := loginData["token"].(string)
+	assert.NotEmpty(t, token)
+
+	user := loginData["user"].(map[string]interface{})
+	assert.Equal(t, "alice@example.com", user["email"])
+	assert.Nil(t, user["password"])
+
+	req, _ := http.NewRequest("GET", "/api/v1/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = postJSON(router, "/api/v1/auth/logout", nil, token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 失効後のトークンは使えない
+	req, _ = http.NewRequest("GET", "/api/v1/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRegisterValidation(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupAuthRoutes(router, handler)
+
+	w := postJSON(router, "/api/v1/auth/register", map[string]interface{}{
+		"email":    "not-an-email",
+		"password": "correct-horse",
+	}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = postJSON(router, "/api/v1/auth/register", map[string]interface{}{
+		"email":    "bob@example.com",
+		"password": "short",
+	}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRegisterRejectsOverlongPassword(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupAuthRoutes(router, handler)
+
+	w := postJSON(router, "/api/v1/auth/register", map[string]interface{}{
+		"email":    "carol@example.com",
+		"password": strings.Repeat("a", auth.MaxPasswordLength+1),
+	}, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRegisterMapsDuplicateInsertToConflict(t *testing.T) {
+	db, err := setupTestDB()
+	require.NoError(t, err)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handler := api.NewHandler(db, nil, testConfig())
+	setupAuthRoutes(router, handler)
+
+	// 事前の確認をすり抜けた同時登録を、挿入の直前に同じメールのユーザーを作って再現する
+	racing := true
+	require.NoError(t, db.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.(*database.User); ok && racing {
+			racing = false
+			tx.Exec("INSERT INTO users (id, email, password, created_at, updated_at) VALUES ('racer', 'dave@example.com', 'x', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)")
+		}
+	}))
+
+	w := postJSON(router, "/api/v1/auth/register", map[string]interface{}{
+		"email":    "dave@example.com",
+		"password": "correct-horse",
+	}, "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
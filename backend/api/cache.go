@@ -13,13 +13,12 @@ import (
 
 // GetProjectsWithCache - キャッシュを使用したプロジェクト一覧取得
 func (h *Handler) GetProjectsWithCache(c *gin.Context) {
-	owner := c.Query("owner")
-	isPublic := c.Query("public")
+	filter := newProjectFilter(c)
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
 
 	// キャッシュキーの生成
-	cacheKey := "projects:" + owner + ":" + isPublic + ":" + strconv.Itoa(page)
+	cacheKey := "projects:" + filter.cacheKey() + ":" + strconv.Itoa(page)
 
 	// キャッシュから取得試行
 	var projects []database.Project
@@ -31,14 +30,7 @@ func (h *Handler) GetProjectsWithCache(c *gin.Context) {
 		5*time.Minute,
 		func() (interface{}, error) {
 			var result []database.Project
-			query := h.db.Model(&database.Project{})
-
-			if owner != "" {
-				query = query.Where("owner_id = ?", owner)
-			}
-			if isPublic == "true" {
-				query = query.Where("is_public = ?", true)
-			}
+			query := filter.apply(h.db.Model(&database.Project{}))
 
 			offset := (page - 1) * pageSize
 			if err := query.Order("updated_at DESC").
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/jsonpatch"
+	"thinking-blocks-backend/policy"
+	"thinking-blocks-backend/thinking"
+	"thinking-blocks-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MaxPatchOperations - 1回のパッチで送れる操作数の上限
+const MaxPatchOperations = 1000
+
+// ErrorCodePatchTestFailed - パッチの test 操作が一致しない場合のエラーコード
+const ErrorCodePatchTestFailed = "patch_test_failed"
+
+// PatchProjectContent - 保存済みの content に JSON Patch（RFC 6902）を適用
+// すべての操作を適用した結果が検証に通った場合のみ保存する。レスポンスには content を含めない
+func (h *Handler) PatchProjectContent(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionEdit)
+	if !ok {
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		respondError(c, utils.NewBadRequestError("Failed to read request body"))
+		return
+	}
+	patch, err := jsonpatch.Decode(body)
+	if err != nil {
+		respondError(c, utils.NewValidationError("Invalid JSON Patch", patchFields(err)))
+		return
+	}
+	if len(patch) > MaxPatchOperations {
+		respondError(c, utils.NewValidationError("Invalid JSON Patch", []utils.FieldError{
+			{Field: "operations", Message: fmt.Sprintf("must not contain more than %d operations", MaxPatchOperations)},
+		}))
+		return
+	}
+
+	expected, appErr := expectedVersion(c)
+	if appErr != nil {
+		respondError(c, appErr)
+		return
+	}
+
+	var revision *database.ProjectRevision
+	if len(patch) > 0 {
+		err = h.db.Transaction(func(tx *gorm.DB) error {
+			locked, err := lockProject(tx, project.ID)
+			if err != nil {
+				return err
+			}
+			// 古いバージョンに対するパッチは適用しない
+			if err := checkVersion(locked, expected); err != nil {
+				return err
+			}
+
+			content, err := patch.Apply(locked.Content)
+			if err != nil {
+				return patchApplyError(err)
+			}
+			if _, appErr := thinking.Parse(content); appErr != nil {
+				return appErr
+			}
+
+			if err := updateProjectVersion(tx, locked, expected, map[string]interface{}{"content": content}); err != nil {
+				return err
+			}
+			revision, err = h.recordRevision(tx, project.ID, content, revisionMeta{
+				AuthorID: userID,
+				Source:   database.RevisionSourceUpdate,
+			})
+			return err
+		})
+		if err != nil {
+			respondUpdateError(c, err, "Failed to update project content")
+			return
+		}
+	}
+
+	project.Content = nil
+	if err := h.db.Omit("content").First(project, "id = ?", project.ID).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to reload project"))
+		return
+	}
+
+	response := gin.H{
+		"success": true,
+		"data":    project,
+	}
+	if revision != nil {
+		response["revision"] = revision.Number
+	}
+
+	setProjectETag(c, project)
+	c.JSON(http.StatusOK, response)
+}
+
+// patchFields - パッチのエラーを操作の位置付きのフィールドエラーに変換
+func patchFields(err error) []utils.FieldError {
+	var opErr *jsonpatch.Error
+	if !errors.As(err, &opErr) {
+		return []utils.FieldError{{Field: "operations", Message: err.Error()}}
+	}
+	return []utils.FieldError{{
+		Field:   fmt.Sprintf("operations[%d].%s", opErr.Index, opErr.Field),
+		Message: opErr.Err.Error(),
+	}}
+}
+
+// patchApplyError - 適用できなかったパッチのエラー
+// test 操作の不一致は409、保存済みの content にないパスは422
+func patchApplyError(err error) *utils.AppError {
+	var appErr *utils.AppError
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		appErr = utils.NewConflictError("JSON Patch test operation failed").WithErrorCode(ErrorCodePatchTestFailed)
+	} else {
+		appErr = utils.NewAppError(http.StatusUnprocessableEntity, "JSON Patch cannot be applied", "The patch does not match the stored content")
+	}
+	appErr.Fields = patchFields(err)
+	return appErr
+}
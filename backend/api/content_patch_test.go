@@ -0,0 +1,91 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchProjectContent(t *testing.T) {
+	router, handler := setupRevisionRoutes(0)
+	router.PATCH("/api/v1/projects/:id/content", handler.PatchProjectContent)
+	token := issueToken(t, handler, "owner")
+
+	projectID := createTestProject(t, router, token, map[string]interface{}{
+		"title":   "Big map",
+		"content": contentWithText("最初"),
+	})
+	path := "/api/v1/projects/" + projectID
+	jsonPatch := map[string]string{"Content-Type": "application/json-patch+json"}
+
+	w := sendWithHeaders(router, "PATCH", path+"/content", token, jsonPatch, []map[string]interface{}{
+		{"op": "test", "path": "/thinking_structure/blocks/0/id", "value": "b1"},
+		{"op": "replace", "path": "/thinking_structure/blocks/0/text", "value": "更新"},
+		{"op": "add", "path": "/thinking_structure/blocks/-", "value": map[string]interface{}{
+			"id": "b2", "type": "thinking_how", "text": "追加",
+		}},
+		{"op": "add", "path": "/thinking_structure/blocks/0/connections", "value": []string{"b2"}},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var response struct {
+		Data struct {
+			Version int             `json:"version"`
+			Content json.RawMessage `json:"content"`
+		} `json:"data"`
+		Revision int `json:"revision"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 2, response.Data.Version)
+	assert.Equal(t, 2, response.Revision)
+	// 小さな編集のレスポンスには content を含めない
+	assert.Equal(t, "null", string(response.Data.Content))
+
+	w = sendJSON(router, "GET", path+"/revisions/2", token, nil)
+	assert.Contains(t, w.Body.String(), "更新")
+	assert.Contains(t, w.Body.String(), "追加")
+
+	// 古いバージョンに対するパッチは409
+	w = sendWithHeaders(router, "PATCH", path+"/content", token, map[string]string{"If-Match": `"1"`}, []map[string]interface{}{
+		{"op": "remove", "path": "/thinking_structure/blocks/1"},
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "version_conflict")
+
+	// 検証に通らない結果は保存しない（一部の操作だけが適用されることもない）
+	w = sendWithHeaders(router, "PATCH", path+"/content", token, map[string]string{"If-Match": `"2"`}, []map[string]interface{}{
+		{"op": "replace", "path": "/thinking_structure/blocks/0/text", "value": "途中"},
+		{"op": "replace", "path": "/thinking_structure/blocks/1/id", "value": "b1"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "duplicate block id")
+
+	w = sendJSON(router, "PATCH", path+"/content", token, []map[string]interface{}{
+		{"op": "remove", "path": "/thinking_structure/blocks/5"},
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "operations[0].path")
+
+	w = sendJSON(router, "PATCH", path+"/content", token, []map[string]interface{}{
+		{"op": "test", "path": "/thinking_structure/blocks/0/text", "value": "最初"},
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "patch_test_failed")
+
+	w = sendJSON(router, "PATCH", path+"/content", token, []map[string]interface{}{
+		{"op": "add", "path": "/thinking_structure/blocks/-"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "operations[0].value")
+
+	w = sendJSON(router, "GET", path, token, nil)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.NotContains(t, w.Body.String(), "途中")
+	assert.Len(t, listRevisions(t, router, token, projectID), 2)
+
+	viewerToken := issueToken(t, handler, "stranger")
+	w = sendJSON(router, "PATCH", path+"/content", viewerToken, []map[string]interface{}{})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
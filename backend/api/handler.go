@@ -1,11 +1,23 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
 
+	"thinking-blocks-backend/analysis"
+	"thinking-blocks-backend/analytics"
+	"thinking-blocks-backend/auth"
+	"thinking-blocks-backend/config"
 	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/middleware"
+	"thinking-blocks-backend/policy"
+	"thinking-blocks-backend/thinking"
+	"thinking-blocks-backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
@@ -13,32 +25,133 @@ import (
 )
 
 type Handler struct {
-	db    *gorm.DB
-	redis *redis.Client
+	db         *gorm.DB
+	redis      *redis.Client
+	auth       *auth.Manager
+	analyzer   analysis.Analyzer
+	events     *analytics.Writer
+	eventTypes *analytics.Registry
+
+	revisionLimit int
 }
 
-func NewHandler(db *gorm.DB, redisClient *redis.Client) *Handler {
+func NewHandler(db *gorm.DB, redisClient *redis.Client, cfg *config.Config) *Handler {
 	return &Handler{
-		db:    db,
-		redis: redisClient,
+		db:         db,
+		redis:      redisClient,
+		auth:       auth.NewManager(db, cfg.JWTSecret, cfg.SessionTTL),
+		analyzer:   analysis.New(cfg.AI),
+		events:     analytics.NewWriter(db, cfg.Analytics),
+		eventTypes: analytics.DefaultRegistry(),
+
+		revisionLimit: cfg.RevisionLimit,
 	}
 }
 
-// GetProjects - プロジェクト一覧取得
-func (h *Handler) GetProjects(c *gin.Context) {
-	owner := c.Query("owner")
-	isPublic := c.Query("public")
+// Close - バッファ内のアナリティクスイベントを書き込んでから停止
+func (h *Handler) Close(ctx context.Context) error {
+	return h.events.Close(ctx)
+}
 
-	var projects []database.Project
-	query := h.db.Model(&database.Project{})
+// Auth - 認証ミドルウェアと共有するセッションマネージャー
+func (h *Handler) Auth() *auth.Manager {
+	return h.auth
+}
 
-	if owner != "" {
-		query = query.Where("owner_id = ?", owner)
+// projectFilter - プロジェクト一覧の絞り込み条件
+type projectFilter struct {
+	userID       string
+	owner        string
+	publicOnly   bool
+	sharedWithMe bool
+}
+
+func newProjectFilter(c *gin.Context) projectFilter {
+	return projectFilter{
+		userID:       middleware.CurrentUserID(c),
+		owner:        c.Query("owner"),
+		publicOnly:   c.Query("public") == "true",
+		sharedWithMe: c.Query("shared_with_me") == "true",
 	}
-	if isPublic == "true" {
+}
+
+// apply - 呼び出し元から見えるプロジェクトに絞り込む
+// 未認証または public=true の場合は公開プロジェクトのみ、shared_with_me=true の場合は
+// メンバーとして参加しているプロジェクト、それ以外は自分のプロジェクト
+func (f projectFilter) apply(query *gorm.DB) *gorm.DB {
+	switch {
+	case f.publicOnly || f.userID == "":
 		query = query.Where("is_public = ?", true)
+		if f.owner != "" {
+			query = query.Where("owner_id = ?", f.owner)
+		}
+	case f.sharedWithMe:
+		memberships := query.Session(&gorm.Session{NewDB: true}).
+			Model(&database.ProjectMember{}).
+			Select("project_id").
+			Where("user_id = ? AND status = ?", f.userID, database.MemberStatusAccepted)
+		query = query.Where("id IN (?)", memberships)
+		if f.owner != "" {
+			query = query.Where("owner_id = ?", f.owner)
+		}
+	case f.owner == "" || f.owner == f.userID:
+		query = query.Where("owner_id = ?", f.userID)
+	default:
+		query = query.Where("owner_id = ? AND is_public = ?", f.owner, true)
+	}
+	return query
+}
+
+// cacheKey - 絞り込み条件ごとのキャッシュキー
+func (f projectFilter) cacheKey() string {
+	return f.userID + ":" + f.owner + ":" + strconv.FormatBool(f.publicOnly) + ":" + strconv.FormatBool(f.sharedWithMe)
+}
+
+// authorizeProject - プロジェクトを取得し、呼び出し元の操作権限を検証
+func (h *Handler) authorizeProject(c *gin.Context, id string, action policy.Action) (*database.Project, bool) {
+	var project database.Project
+	if err := h.db.First(&project, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Project not found",
+		})
+		return nil, false
+	}
+
+	userID := middleware.CurrentUserID(c)
+	if err := policy.Authorize(&project, userID, h.findMembership(project.ID, userID), action); err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+
+	return &project, true
+}
+
+// findMembership - 承認済みのメンバーシップを取得（なければnil）
+func (h *Handler) findMembership(projectID, userID string) *database.ProjectMember {
+	if userID == "" {
+		return nil
 	}
 
+	var member database.ProjectMember
+	if err := h.db.Where("project_id = ? AND user_id = ? AND status = ?",
+		projectID, userID, database.MemberStatusAccepted).First(&member).Error; err != nil {
+		return nil
+	}
+	return &member
+}
+
+// GetProjects - プロジェクト一覧取得
+func (h *Handler) GetProjects(c *gin.Context) {
+	filter := newProjectFilter(c)
+	if filter.sharedWithMe && filter.userID == "" {
+		respondError(c, utils.NewUnauthorizedError("Authentication required"))
+		return
+	}
+
+	var projects []database.Project
+	query := filter.apply(h.db.Model(&database.Project{}))
+
 	if err := query.Order("updated_at DESC").Find(&projects).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -56,14 +169,14 @@ func (h *Handler) GetProjects(c *gin.Context) {
 
 // GetProject - 特定プロジェクト取得
 func (h *Handler) GetProject(c *gin.Context) {
-	id := c.Param("id")
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionView)
+	if !ok {
+		return
+	}
 
-	var project database.Project
-	if err := h.db.First(&project, "id = ?", id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Project not found",
-		})
+	setProjectETag(c, project)
+	if c.GetHeader("If-None-Match") == projectETag(project) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
@@ -75,15 +188,18 @@ func (h *Handler) GetProject(c *gin.Context) {
 
 // CreateProject - プロジェクト作成
 func (h *Handler) CreateProject(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
 	var input struct {
-		Title         string          `json:"title" binding:"required"`
-		Description   string          `json:"description"`
-		Content       json.RawMessage `json:"content" binding:"required"`
-		Theme         string          `json:"theme"`
-		Owner         string          `json:"owner"`
-		IsPublic      bool            `json:"is_public"`
-		Collaborators []string        `json:"collaborators"`
-		Tags          []string        `json:"tags"`
+		Title       string          `json:"title" binding:"required"`
+		Description string          `json:"description"`
+		Content     json.RawMessage `json:"content" binding:"required"`
+		Theme       string          `json:"theme"`
+		IsPublic    bool            `json:"is_public"`
+		Tags        []string        `json:"tags"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -94,18 +210,48 @@ func (h *Handler) CreateProject(c *gin.Context) {
 		return
 	}
 
+	if _, appErr := thinking.Parse(input.Content); appErr != nil {
+		respondError(c, appErr)
+		return
+	}
+
+	var fieldErrs []utils.FieldError
+	if msg := validateTitle(input.Title); msg != "" {
+		fieldErrs = append(fieldErrs, utils.FieldError{Field: "title", Message: msg})
+	}
+	if input.Theme == "" {
+		input.Theme = thinking.DefaultTheme
+	} else if msg := validateTheme(input.Theme); msg != "" {
+		fieldErrs = append(fieldErrs, utils.FieldError{Field: "theme", Message: msg})
+	}
+	tags, tagErrs := normalizeTags(input.Tags)
+	fieldErrs = append(fieldErrs, tagErrs...)
+	if len(fieldErrs) > 0 {
+		respondError(c, utils.NewValidationError("Invalid project", fieldErrs))
+		return
+	}
+
 	project := database.Project{
-		Title:         input.Title,
-		Description:   input.Description,
-		Content:       []byte(input.Content),
-		Theme:         input.Theme,
-		OwnerID:       input.Owner,
-		IsPublic:      input.IsPublic,
-		Collaborators: input.Collaborators,
-		Tags:          input.Tags,
+		Title:       strings.TrimSpace(input.Title),
+		Description: input.Description,
+		Content:     []byte(input.Content),
+		Theme:       input.Theme,
+		OwnerID:     userID,
+		IsPublic:    input.IsPublic,
+		Tags:        tags,
 	}
 
-	if err := h.db.Create(&project).Error; err != nil {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&project).Error; err != nil {
+			return err
+		}
+		_, err := h.recordRevision(tx, project.ID, project.Content, revisionMeta{
+			AuthorID: userID,
+			Source:   database.RevisionSourceCreate,
+		})
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Failed to create project",
@@ -113,6 +259,7 @@ func (h *Handler) CreateProject(c *gin.Context) {
 		return
 	}
 
+	setProjectETag(c, &project)
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
 		"data":    project,
@@ -121,163 +268,113 @@ func (h *Handler) CreateProject(c *gin.Context) {
 
 // UpdateProject - プロジェクト更新
 func (h *Handler) UpdateProject(c *gin.Context) {
-	id := c.Param("id")
-
-	var project database.Project
-	if err := h.db.First(&project, "id = ?", id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Project not found",
-		})
+	userID, ok := requireUser(c)
+	if !ok {
 		return
 	}
 
-	var input map[string]interface{}
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionEdit)
+	if !ok {
 		return
 	}
 
-	if err := h.db.Model(&project).Updates(input).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to update project",
-		})
+	body, err := c.GetRawData()
+	if err != nil {
+		respondError(c, utils.NewBadRequestError("Failed to read request body"))
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    project,
-	})
-}
-
-// DeleteProject - プロジェクト削除
-func (h *Handler) DeleteProject(c *gin.Context) {
-	id := c.Param("id")
-
-	if err := h.db.Delete(&database.Project{}, "id = ?", id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to delete project",
-		})
+	patch, appErr := parseProjectPatch(body)
+	if appErr != nil {
+		respondError(c, appErr)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Project deleted successfully",
-	})
-}
-
-// CreateShareLink - 共有リンク作成
-func (h *Handler) CreateShareLink(c *gin.Context) {
-	projectID := c.Param("id")
-
-	var input struct {
-		Permission string     `json:"permission"`
-		ExpiresAt  *time.Time `json:"expires_at"`
-		MaxUses    *int       `json:"max_uses"`
+	// 公開範囲の変更は共有リンクの発行と同じ権限（オーナー）が必要
+	if patch.IsPublic != nil && *patch.IsPublic != project.IsPublic {
+		if appErr := policy.Authorize(project, userID, h.findMembership(project.ID, userID), policy.ActionShare); appErr != nil {
+			respondError(c, appErr)
+			return
+		}
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+	// 更新元のバージョンは If-Match ヘッダーか本文の version で指定する
+	expected, appErr := expectedVersion(c)
+	if appErr != nil {
+		respondError(c, appErr)
 		return
 	}
-
-	shareLink := database.ShareLink{
-		ProjectID:  projectID,
-		Permission: input.Permission,
-		ExpiresAt:  input.ExpiresAt,
-		MaxUses:    input.MaxUses,
+	if expected == 0 {
+		expected = patch.Version
 	}
 
-	if err := h.db.Create(&shareLink).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to create share link",
+	// If-Match のバージョンが古ければ409、内容の変更はリビジョンとして記録する
+	if updates := patch.updates(); len(updates) > 0 {
+		err = h.db.Transaction(func(tx *gorm.DB) error {
+			locked, err := lockProject(tx, project.ID)
+			if err != nil {
+				return err
+			}
+			if err := updateProjectVersion(tx, locked, expected, updates); err != nil {
+				return err
+			}
+			if patch.Content != nil {
+				_, err := h.recordRevision(tx, project.ID, patch.Content, revisionMeta{
+					AuthorID: userID,
+					Source:   database.RevisionSourceUpdate,
+				})
+				return err
+			}
+			return nil
 		})
+	}
+	if err != nil {
+		respondUpdateError(c, err, "Failed to update project")
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"success": true,
-		"data":    shareLink,
-	})
-}
-
-// GetShareLinks - 共有リンク一覧
-func (h *Handler) GetShareLinks(c *gin.Context) {
-	projectID := c.Param("id")
-
-	var shareLinks []database.ShareLink
-	if err := h.db.Where("project_id = ?", projectID).Find(&shareLinks).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to fetch share links",
-		})
+	if err := h.db.First(project, "id = ?", project.ID).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to reload project"))
 		return
 	}
 
+	setProjectETag(c, project)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    shareLinks,
+		"data":    project,
 	})
 }
 
-// AccessSharedProject - 共有プロジェクトアクセス
-func (h *Handler) AccessSharedProject(c *gin.Context) {
-	token := c.Param("token")
-
-	var shareLink database.ShareLink
-	if err := h.db.Where("token = ?", token).First(&shareLink).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Invalid or expired share link",
-		})
+// DeleteProject - プロジェクト削除
+func (h *Handler) DeleteProject(c *gin.Context) {
+	if _, ok := requireUser(c); !ok {
 		return
 	}
 
-	// 有効期限チェック
-	if shareLink.ExpiresAt != nil && shareLink.ExpiresAt.Before(time.Now()) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"error":   "Share link has expired",
-		})
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionDelete)
+	if !ok {
 		return
 	}
 
-	// 使用回数チェック
-	if shareLink.MaxUses != nil && shareLink.CurrentUses >= *shareLink.MaxUses {
-		c.JSON(http.StatusForbidden, gin.H{
+	if err := h.db.Delete(project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"error":   "Share link usage limit reached",
+			"error":   "Failed to delete project",
 		})
 		return
 	}
 
-	// 使用回数をインクリメント
-	h.db.Model(&shareLink).Update("current_uses", shareLink.CurrentUses+1)
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data": gin.H{
-			"project_id": shareLink.ProjectID,
-			"permission": shareLink.Permission,
-		},
+		"message": "Project deleted successfully",
 	})
 }
 
 // AnalyzeThinking - AI分析
+// project_id を指定すると結果を分析履歴に保存し、同じ内容の再分析には保存済みの結果を返す
 func (h *Handler) AnalyzeThinking(c *gin.Context) {
 	var input struct {
-		Content      json.RawMessage `json:"content" binding:"required"`
+		ProjectID    string          `json:"project_id"`
+		Content      json.RawMessage `json:"content"`
 		Theme        string          `json:"theme"`
 		AnalysisType string          `json:"analysis_type"`
 	}
@@ -290,74 +387,76 @@ func (h *Handler) AnalyzeThinking(c *gin.Context) {
 		return
 	}
 
-	// TODO: 実際のAI分析ロジックを実装
-	analysis := gin.H{
-		"stats": gin.H{
-			"total": 0,
-		},
-		"patterns":    []string{},
-		"suggestions": []string{"思考をさらに深掘りしてみましょう"},
-		"timestamp":   time.Now(),
+	var project *database.Project
+	if input.ProjectID != "" {
+		var ok bool
+		project, ok = h.authorizeProject(c, input.ProjectID, policy.ActionView)
+		if !ok {
+			return
+		}
+		// content を省略した場合は保存済みの内容を分析する
+		if len(input.Content) == 0 {
+			input.Content = project.Content
+		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    analysis,
-	})
-}
-
-// TrackEvent - イベント追跡
-func (h *Handler) TrackEvent(c *gin.Context) {
-	var input struct {
-		UserID    string          `json:"user_id"`
-		ProjectID string          `json:"project_id"`
-		EventType string          `json:"event_type" binding:"required"`
-		Data      json.RawMessage `json:"data"`
+	if len(input.Content) == 0 {
+		respondError(c, utils.NewValidationError("Invalid analysis request", []utils.FieldError{
+			{Field: "content", Message: "is required"},
+		}))
+		return
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
+	doc, appErr := thinking.Parse(input.Content)
+	if appErr != nil {
+		respondError(c, appErr)
 		return
 	}
 
-	event := database.AnalyticsEvent{
-		UserID:    input.UserID,
-		ProjectID: input.ProjectID,
-		EventType: input.EventType,
-		Data:      []byte(input.Data),
+	req := analysis.Request{
+		Document:     doc,
+		Theme:        input.Theme,
+		AnalysisType: input.AnalysisType,
 	}
 
-	if err := h.db.Create(&event).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Failed to track event",
-		})
+	var contentHash string
+	if project != nil {
+		var err error
+		contentHash, err = analysis.Fingerprint(req, h.analyzer.Provider())
+		if err != nil {
+			respondError(c, utils.NewInternalServerError("Failed to analyze thinking structure"))
+			return
+		}
+		if stored, found := h.findStoredAnalysis(project.ID, contentHash); found {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data":    stored.Result,
+				"cached":  true,
+			})
+			return
+		}
+	}
+
+	result, err := h.analyzer.Analyze(c.Request.Context(), req)
+	if errors.Is(err, analysis.ErrUnknownAnalysisType) {
+		respondError(c, utils.NewValidationError("Invalid analysis request", []utils.FieldError{
+			{Field: "analysis_type", Message: "must be one of comprehensive, quick, deep, critical"},
+		}))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to analyze thinking structure: %v", err)
+		respondError(c, utils.NewAppError(http.StatusBadGateway, "AI analysis failed", "The analysis provider is unavailable"))
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"success": true,
-		"data":    event,
-	})
-}
+	if project != nil && h.canStoreAnalysis(c, project, doc) {
+		h.storeAnalysis(c, project.ID, contentHash, result)
+	}
 
-// GetAnalytics - 分析データ取得
-func (h *Handler) GetAnalytics(c *gin.Context) {
-	// TODO: 実装
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data": gin.H{
-			"totalEvents": 0,
-			"stats":       gin.H{},
-		},
+		"data":    result,
+		"cached":  false,
 	})
 }
-
-// 認証関連（スタブ実装）
-func (h *Handler) Register(c *gin.Context)       { c.JSON(200, gin.H{"message": "Not implemented"}) }
-func (h *Handler) Login(c *gin.Context)          { c.JSON(200, gin.H{"message": "Not implemented"}) }
-func (h *Handler) Logout(c *gin.Context)         { c.JSON(200, gin.H{"message": "Not implemented"}) }
-func (h *Handler) GetCurrentUser(c *gin.Context) { c.JSON(200, gin.H{"message": "Not implemented"}) }
@@ -6,9 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"thinking-blocks-backend/api"
+	"thinking-blocks-backend/config"
 	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/middleware"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -22,6 +25,13 @@ func setupTestDB() (*gorm.DB, error) {
 		return nil, err
 	}
 
+	// :memory: は接続ごとに別のDBになるため、接続を1本に固定する
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
 	// マイグレーション
 	err = database.Migrate(db)
 	if err != nil {
@@ -31,16 +41,33 @@ func setupTestDB() (*gorm.DB, error) {
 	return db, nil
 }
 
+func testConfig() *config.Config {
+	return &config.Config{
+		JWTSecret:  "test-secret",
+		SessionTTL: time.Hour,
+	}
+}
+
 func setupTestRouter() (*gin.Engine, *api.Handler) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 
 	db, _ := setupTestDB()
-	handler := api.NewHandler(db, nil)
+	handler := api.NewHandler(db, nil, testConfig())
+	router.Use(middleware.Authenticate(handler.Auth()))
 
 	return router, handler
 }
 
+// issueToken - テスト用にユーザーのセッショントークンを発行
+func issueToken(t *testing.T, handler *api.Handler, userID string) string {
+	token, _, err := handler.Auth().Issue(userID)
+	if err != nil {
+		t.Fatalf("failed to issue token: %v", err)
+	}
+	return token
+}
+
 func TestHealthCheck(t *testing.T) {
 	router, handler := setupTestRouter()
 	router.GET("/health", handler.HealthCheck)
@@ -65,12 +92,13 @@ func TestCreateProject(t *testing.T) {
 		"description": "Test Description",
 		"content":     map[string]interface{}{"blocks": []interface{}{}},
 		"theme":       "creative",
-		"owner":       "test_user",
+		"owner":       "someone_else",
 	}
 
 	jsonData, _ := json.Marshal(project)
 	req, _ := http.NewRequest("POST", "/api/v1/projects", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+issueToken(t, handler, "test_user"))
 
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
@@ -81,6 +109,36 @@ func TestCreateProject(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), &response)
 	assert.True(t, response["success"].(bool))
 	assert.NotNil(t, response["data"])
+
+	// オーナーはリクエストボディではなく認証済みユーザーから決まる
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, "test_user", data["owner_id"])
+}
+
+func TestCreateProjectRequiresAuth(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+
+	project := map[string]interface{}{
+		"title":   "Anonymous",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	}
+	jsonData, _ := json.Marshal(project)
+	req, _ := http.NewRequest("POST", "/api/v1/projects", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 不正なトークンは匿名扱いにせず拒否
+	req, _ = http.NewRequest("POST", "/api/v1/projects", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
 func TestGetProjects(t *testing.T) {
@@ -101,6 +159,7 @@ func TestGetProjects(t *testing.T) {
 
 func TestGetProject(t *testing.T) {
 	router, handler := setupTestRouter()
+	token := issueToken(t, handler, "test_user")
 
 	// プロジェクト作成
 	router.POST("/api/v1/projects", handler.CreateProject)
@@ -111,6 +170,7 @@ func TestGetProject(t *testing.T) {
 	jsonData, _ := json.Marshal(project)
 	req1, _ := http.NewRequest("POST", "/api/v1/projects", bytes.NewBuffer(jsonData))
 	req1.Header.Set("Content-Type", "application/json")
+	req1.Header.Set("Authorization", "Bearer "+token)
 	w1 := httptest.NewRecorder()
 	router.ServeHTTP(w1, req1)
 
@@ -122,6 +182,7 @@ func TestGetProject(t *testing.T) {
 	// プロジェクト取得
 	router.GET("/api/v1/projects/:id", handler.GetProject)
 	req2, _ := http.NewRequest("GET", "/api/v1/projects/"+projectID, nil)
+	req2.Header.Set("Authorization", "Bearer "+token)
 	w2 := httptest.NewRecorder()
 	router.ServeHTTP(w2, req2)
 
@@ -137,6 +198,7 @@ func TestGetProject(t *testing.T) {
 
 func TestUpdateProject(t *testing.T) {
 	router, handler := setupTestRouter()
+	token := issueToken(t, handler, "test_user")
 
 	// プロジェクト作成
 	router.POST("/api/v1/projects", handler.CreateProject)
@@ -147,6 +209,7 @@ func TestUpdateProject(t *testing.T) {
 	jsonData, _ := json.Marshal(project)
 	req1, _ := http.NewRequest("POST", "/api/v1/projects", bytes.NewBuffer(jsonData))
 	req1.Header.Set("Content-Type", "application/json")
+	req1.Header.Set("Authorization", "Bearer "+token)
 	w1 := httptest.NewRecorder()
 	router.ServeHTTP(w1, req1)
 
@@ -163,6 +226,7 @@ func TestUpdateProject(t *testing.T) {
 	updateJSON, _ := json.Marshal(updateData)
 	req2, _ := http.NewRequest("PUT", "/api/v1/projects/"+projectID, bytes.NewBuffer(updateJSON))
 	req2.Header.Set("Content-Type", "application/json")
+	req2.Header.Set("Authorization", "Bearer "+token)
 	w2 := httptest.NewRecorder()
 	router.ServeHTTP(w2, req2)
 
@@ -175,6 +239,7 @@ func TestUpdateProject(t *testing.T) {
 
 func TestDeleteProject(t *testing.T) {
 	router, handler := setupTestRouter()
+	token := issueToken(t, handler, "test_user")
 
 	// プロジェクト作成
 	router.POST("/api/v1/projects", handler.CreateProject)
@@ -185,6 +250,7 @@ func TestDeleteProject(t *testing.T) {
 	jsonData, _ := json.Marshal(project)
 	req1, _ := http.NewRequest("POST", "/api/v1/projects", bytes.NewBuffer(jsonData))
 	req1.Header.Set("Content-Type", "application/json")
+	req1.Header.Set("Authorization", "Bearer "+token)
 	w1 := httptest.NewRecorder()
 	router.ServeHTTP(w1, req1)
 
@@ -196,6 +262,7 @@ func TestDeleteProject(t *testing.T) {
 	// プロジェクト削除
 	router.DELETE("/api/v1/projects/:id", handler.DeleteProject)
 	req2, _ := http.NewRequest("DELETE", "/api/v1/projects/"+projectID, nil)
+	req2.Header.Set("Authorization", "Bearer "+token)
 	w2 := httptest.NewRecorder()
 	router.ServeHTTP(w2, req2)
 
@@ -205,3 +272,198 @@ func TestDeleteProject(t *testing.T) {
 	json.Unmarshal(w2.Body.Bytes(), &deleteResponse)
 	assert.True(t, deleteResponse["success"].(bool))
 }
+
+func TestPrivateProjectRequiresAuth(t *testing.T) {
+	router, handler := setupTestRouter()
+	token := issueToken(t, handler, "test_user")
+	router.POST("/api/v1/projects", handler.CreateProject)
+	router.GET("/api/v1/projects", handler.GetProjects)
+	router.GET("/api/v1/projects/:id", handler.GetProject)
+
+	ids := map[bool]string{}
+	for _, isPublic := range []bool{true, false} {
+		project := map[string]interface{}{
+			"title":     "Visibility",
+			"content":   map[string]interface{}{"blocks": []interface{}{}},
+			"is_public": isPublic,
+		}
+		jsonData, _ := json.Marshal(project)
+		req, _ := http.NewRequest("POST", "/api/v1/projects", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		ids[isPublic] = response["data"].(map[string]interface{})["id"].(string)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/projects/"+ids[true], nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/projects/"+ids[false], nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 未認証の一覧は公開プロジェクトのみ
+	req, _ = http.NewRequest("GET", "/api/v1/projects", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var listResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.Equal(t, float64(1), listResponse["count"])
+
+	// 認証済みなら自分のプロジェクトすべて
+	req, _ = http.NewRequest("GET", "/api/v1/projects", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.Equal(t, float64(2), listResponse["count"])
+}
+
+// createTestProject - テスト用プロジェクトを作成してIDを返す
+func createTestProject(t *testing.T, router *gin.Engine, token string, project map[string]interface{}) string {
+	jsonData, _ := json.Marshal(project)
+	req, _ := http.NewRequest("POST", "/api/v1/projects", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("failed to create project: %d %s", w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response["data"].(map[string]interface{})["id"].(string)
+}
+
+func TestProjectAuthorization(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+	router.PUT("/api/v1/projects/:id", handler.UpdateProject)
+	router.DELETE("/api/v1/projects/:id", handler.DeleteProject)
+	router.POST("/api/v1/projects/:id/share", handler.CreateShareLink)
+	setupMemberRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	strangerToken := issueToken(t, handler, "stranger")
+
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Shared Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+
+	send := func(method, path, token string, body interface{}) int {
+		return sendJSON(router, method, path, token, body).Code
+	}
+
+	path := "/api/v1/projects/" + projectID
+	collaboratorToken, _ := addMember(t, router, handler, projectID, ownerToken, "collaborator", "editor")
+	update := map[string]interface{}{"title": "Edited"}
+	share := map[string]interface{}{"permission": "view"}
+
+	assert.Equal(t, http.StatusForbidden, send("PUT", path, strangerToken, update))
+	assert.Equal(t, http.StatusForbidden, send("DELETE", path, strangerToken, nil))
+
+	assert.Equal(t, http.StatusOK, send("PUT", path, collaboratorToken, update))
+	assert.Equal(t, http.StatusForbidden, send("DELETE", path, collaboratorToken, nil))
+	assert.Equal(t, http.StatusForbidden, send("POST", path+"/share", collaboratorToken, share))
+
+	assert.Equal(t, http.StatusCreated, send("POST", path+"/share", ownerToken, share))
+	assert.Equal(t, http.StatusOK, send("DELETE", path, ownerToken, nil))
+}
+
+// sendJSON - 認証付きJSONリクエストを送る
+func sendJSON(router *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Buffer
+	if body != nil {
+		jsonData, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(jsonData)
+	} else {
+		reader = bytes.NewBuffer(nil)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateProjectRejectsMalformedContent(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+
+	w := sendJSON(router, "POST", "/api/v1/projects", issueToken(t, handler, "test_user"), map[string]interface{}{
+		"title": "Broken",
+		"content": map[string]interface{}{
+			"thinking_structure": map[string]interface{}{
+				"blocks": []interface{}{
+					map[string]interface{}{"id": "a", "type": "thinking_unknown"},
+				},
+			},
+		},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	fields := response["fields"].([]interface{})
+	assert.Equal(t, "thinking_structure.blocks[0].type", fields[0].(map[string]interface{})["field"])
+}
+
+func TestAnalyzeThinking(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/ai/analyze", handler.AnalyzeThinking)
+
+	w := sendJSON(router, "POST", "/api/v1/ai/analyze", "", map[string]interface{}{
+		"content": map[string]interface{}{
+			"blocks": []interface{}{
+				map[string]interface{}{"id": "a", "type": "why_block", "depth": 2},
+				map[string]interface{}{"id": "b", "type": "how_block"},
+				map[string]interface{}{"id": "c", "type": "what_block"},
+			},
+		},
+		"theme": "research",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Data struct {
+			Stats struct {
+				Total  int            `json:"total"`
+				ByType map[string]int `json:"byType"`
+			} `json:"stats"`
+			Patterns []string `json:"patterns"`
+			Depth    struct {
+				MaxDepth int `json:"maxDepth"`
+			} `json:"depth"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 3, response.Data.Stats.Total)
+	assert.Equal(t, 1, response.Data.Stats.ByType["why_block"])
+	assert.Equal(t, []string{"論理的展開パターン検出"}, response.Data.Patterns)
+	assert.Equal(t, 2, response.Data.Depth.MaxDepth)
+
+	w = sendJSON(router, "POST", "/api/v1/ai/analyze", "", map[string]interface{}{
+		"content": []interface{}{"not", "a", "document"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = sendJSON(router, "POST", "/api/v1/ai/analyze", "", map[string]interface{}{
+		"content":       map[string]interface{}{"blocks": []interface{}{}},
+		"analysis_type": "astrology",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
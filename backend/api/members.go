@@ -0,0 +1,226 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/policy"
+	"thinking-blocks-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetMembers - プロジェクトメンバー一覧（オーナーとメンバーのみ）
+// メールアドレスを含むため、公開プロジェクトでも閲覧者には見せない
+func (h *Handler) GetMembers(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionView)
+	if !ok {
+		return
+	}
+	if policy.RoleOf(project, userID, h.findMembership(project.ID, userID)) == policy.RoleNone {
+		respondError(c, utils.NewForbiddenError("Only the owner and members can list members"))
+		return
+	}
+
+	var members []database.ProjectMember
+	if err := h.db.Where("project_id = ?", project.ID).Order("created_at").Find(&members).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to fetch members"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"owner_id": project.OwnerID,
+			"members":  members,
+		},
+	})
+}
+
+// InviteMember - メンバーを招待（オーナーのみ）
+func (h *Handler) InviteMember(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionShare)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email  string `json:"email"`
+		UserID string `json:"user_id"`
+		Role   string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, utils.NewBadRequestError(err.Error()))
+		return
+	}
+
+	if !policy.ValidRole(input.Role) {
+		respondError(c, utils.NewBadRequestError("Role must be one of editor, commenter, viewer"))
+		return
+	}
+
+	member := database.ProjectMember{
+		ProjectID: project.ID,
+		Role:      input.Role,
+		Status:    database.MemberStatusPending,
+		InvitedBy: userID,
+	}
+
+	// 既存ユーザーなら紐付け、未登録ならメールアドレスで招待
+	var invitee database.User
+	switch {
+	case input.UserID != "":
+		if err := h.db.First(&invitee, "id = ?", input.UserID).Error; err != nil {
+			respondError(c, utils.NewNotFoundError("User not found"))
+			return
+		}
+		member.UserID = invitee.ID
+		member.Email = invitee.Email
+	case input.Email != "":
+		member.Email = normalizeEmail(input.Email)
+		if !utils.ValidateEmail(member.Email) {
+			respondError(c, utils.NewBadRequestError("Invalid email address"))
+			return
+		}
+		if err := h.db.First(&invitee, "email = ?", member.Email).Error; err == nil {
+			member.UserID = invitee.ID
+		}
+	default:
+		respondError(c, utils.NewBadRequestError("Either email or user_id is required"))
+		return
+	}
+
+	if member.UserID == project.OwnerID {
+		respondError(c, utils.NewConflictError("User already owns this project"))
+		return
+	}
+
+	var existing int64
+	h.db.Model(&database.ProjectMember{}).
+		Where("project_id = ? AND email = ?", project.ID, member.Email).
+		Count(&existing)
+	if existing > 0 {
+		respondError(c, utils.NewConflictError("User is already a member or invited"))
+		return
+	}
+
+	if err := h.db.Create(&member).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to invite member"))
+		return
+	}
+
+	// 招待トークンはこのレスポンスでのみ返し、招待相手に届けてもらう
+	c.JSON(http.StatusCreated, gin.H{
+		"success":      true,
+		"data":         member,
+		"invite_token": member.InviteToken,
+	})
+}
+
+// AcceptInvitation - 招待トークンを提示して招待を承認
+// メールアドレスは確認していないため、アドレスの一致だけでは承認させない
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, utils.NewBadRequestError("Invitation token is required"))
+		return
+	}
+
+	var user database.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		respondError(c, utils.NewUnauthorizedError("User no longer exists"))
+		return
+	}
+
+	var member database.ProjectMember
+	err := h.db.Where("project_id = ? AND status = ? AND invite_token = ?",
+		c.Param("id"), database.MemberStatusPending, input.Token).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, utils.NewNotFoundError("No pending invitation for this project"))
+		return
+	}
+	if err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to fetch invitation"))
+		return
+	}
+
+	// 既存ユーザーに宛てた招待は、そのユーザー以外は承認できない
+	if member.UserID != "" && member.UserID != user.ID {
+		respondError(c, utils.NewForbiddenError("This invitation was issued to another account"))
+		return
+	}
+
+	now := time.Now()
+	if err := h.db.Model(&member).Updates(map[string]interface{}{
+		"user_id":      user.ID,
+		"status":       database.MemberStatusAccepted,
+		"accepted_at":  now,
+		"invite_token": "",
+	}).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to accept invitation"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    member,
+	})
+}
+
+// RemoveMember - メンバーを削除（オーナー、または本人による退出・招待辞退）
+func (h *Handler) RemoveMember(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	projectID, memberID := c.Param("id"), c.Param("memberId")
+
+	// 本人の招待・参加は共有権限がなくても取り消せる
+	var user database.User
+	h.db.First(&user, "id = ?", userID)
+	var member database.ProjectMember
+	if err := h.db.Where("id = ? AND project_id = ?", memberID, projectID).
+		Where("user_id = ? OR (email <> '' AND email = ?)", userID, user.Email).
+		First(&member).Error; err != nil {
+		// 他人のメンバーシップは、存在を確かめる前に共有権限を確認する
+		if _, ok := h.authorizeProject(c, projectID, policy.ActionShare); !ok {
+			return
+		}
+		if err := h.db.Where("id = ? AND project_id = ?", memberID, projectID).First(&member).Error; err != nil {
+			respondError(c, utils.NewNotFoundError("Member not found"))
+			return
+		}
+	}
+
+	if err := h.db.Delete(&member).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to remove member"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Member removed successfully",
+	})
+}
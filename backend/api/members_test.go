@@ -0,0 +1,282 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"thinking-blocks-backend/api"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupMemberRoutes(router *gin.Engine, handler *api.Handler) {
+	router.GET("/api/v1/projects/:id/members", handler.GetMembers)
+	router.POST("/api/v1/projects/:id/members", handler.InviteMember)
+	router.POST("/api/v1/projects/:id/members/accept", handler.AcceptInvitation)
+	router.DELETE("/api/v1/projects/:id/members/:memberId", handler.RemoveMember)
+}
+
+// registerTestUser - <name>@example.com でユーザー登録し、ユーザーIDとトークンを返す
+func registerTestUser(t *testing.T, handler *api.Handler, name string) (string, string) {
+	router := gin.New()
+	router.POST("/register", handler.Register)
+
+	w := sendJSON(router, "POST", "/register", "", map[string]interface{}{
+		"email":    name + "@example.com",
+		"password": "password123",
+		"name":     name,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("failed to register user: %d %s", w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	data := response["data"].(map[string]interface{})
+	return data["user"].(map[string]interface{})["id"].(string), data["token"].(string)
+}
+
+// inviteToken - 招待レスポンスから招待トークンを取り出す
+func inviteToken(t *testing.T, w *httptest.ResponseRecorder) string {
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	token, ok := response["invite_token"].(string)
+	if !ok || token == "" {
+		t.Fatalf("invitation response has no token: %s", w.Body.String())
+	}
+	return token
+}
+
+// addMember - ユーザーを登録・招待・承認させ、トークンとメンバーIDを返す
+func addMember(t *testing.T, router *gin.Engine, handler *api.Handler, projectID, ownerToken, name, role string) (string, string) {
+	_, token := registerTestUser(t, handler, name)
+
+	path := "/api/v1/projects/" + projectID + "/members"
+	w := sendJSON(router, "POST", path, ownerToken, map[string]interface{}{
+		"email": name + "@example.com",
+		"role":  role,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("failed to invite member: %d %s", w.Code, w.Body.String())
+	}
+
+	w = sendJSON(router, "POST", path+"/accept", token, map[string]interface{}{
+		"token": inviteToken(t, w),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to accept invitation: %d %s", w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return token, response["data"].(map[string]interface{})["id"].(string)
+}
+
+func TestMemberInvitationFlow(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+	router.GET("/api/v1/projects", handler.GetProjects)
+	router.PUT("/api/v1/projects/:id", handler.UpdateProject)
+	setupMemberRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Team Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+	membersPath := "/api/v1/projects/" + projectID + "/members"
+
+	viewerID, viewerToken := registerTestUser(t, handler, "viewer")
+
+	// 不正なロールやオーナー権限の付与は拒否
+	for _, role := range []string{"admin", "owner"} {
+		w := sendJSON(router, "POST", membersPath, ownerToken, map[string]interface{}{
+			"email": "viewer@example.com",
+			"role":  role,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code, role)
+	}
+
+	w := sendJSON(router, "POST", membersPath, ownerToken, map[string]interface{}{
+		"email": "viewer@example.com",
+		"role":  "viewer",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	token := inviteToken(t, w)
+	assert.NotContains(t, w.Body.String(), `"invite_token":""`)
+
+	// 二重招待は409
+	w = sendJSON(router, "POST", membersPath, ownerToken, map[string]interface{}{
+		"user_id": viewerID,
+		"role":    "editor",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// 承認前は閲覧できない
+	w = sendJSON(router, "GET", membersPath, viewerToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 承認前は「共有されたプロジェクト」に出てこない
+	w = sendJSON(router, "GET", "/api/v1/projects?shared_with_me=true", viewerToken, nil)
+	var listResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.Equal(t, float64(0), listResponse["count"])
+
+	// トークンなし・不正なトークンでは承認できない
+	w = sendJSON(router, "POST", membersPath+"/accept", viewerToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = sendJSON(router, "POST", membersPath+"/accept", viewerToken, map[string]interface{}{"token": "guess"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 招待されたのと別のアカウントでは承認できない
+	_, otherToken := registerTestUser(t, handler, "other")
+	w = sendJSON(router, "POST", membersPath+"/accept", otherToken, map[string]interface{}{"token": token})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "POST", membersPath+"/accept", viewerToken, map[string]interface{}{"token": token})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 招待トークンは一度しか使えない
+	w = sendJSON(router, "POST", membersPath+"/accept", viewerToken, map[string]interface{}{"token": token})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendJSON(router, "GET", "/api/v1/projects?shared_with_me=true", viewerToken, nil)
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.Equal(t, float64(1), listResponse["count"])
+
+	// viewer は編集・招待できない
+	w = sendJSON(router, "PUT", "/api/v1/projects/"+projectID, viewerToken, map[string]interface{}{"title": "Nope"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendJSON(router, "POST", membersPath, viewerToken, map[string]interface{}{
+		"email": "someone@example.com",
+		"role":  "viewer",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "GET", membersPath, viewerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var membersResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &membersResponse)
+	members := membersResponse["data"].(map[string]interface{})["members"].([]interface{})
+	assert.Len(t, members, 1)
+	memberID := members[0].(map[string]interface{})["id"].(string)
+
+	// 本人は退出できる
+	w = sendJSON(router, "DELETE", membersPath+"/"+memberID, viewerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendJSON(router, "GET", membersPath, viewerToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestRemoveMemberRequiresOwner(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+	setupMemberRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Team Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+
+	_, editorMemberID := addMember(t, router, handler, projectID, ownerToken, "editor", "editor")
+	otherToken, _ := addMember(t, router, handler, projectID, ownerToken, "other", "editor")
+
+	membersPath := "/api/v1/projects/" + projectID + "/members/"
+	w := sendJSON(router, "DELETE", membersPath+editorMemberID, otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "DELETE", membersPath+editorMemberID, ownerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRemoveMemberHidesOtherProjectsMembers(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+	setupMemberRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	strangerToken := issueToken(t, handler, "stranger")
+	content := map[string]interface{}{"blocks": []interface{}{}}
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{"title": "Team Map", "content": content})
+	otherProjectID := createTestProject(t, router, ownerToken, map[string]interface{}{"title": "Other Map", "content": content})
+	_, otherMemberID := addMember(t, router, handler, otherProjectID, ownerToken, "editor", "editor")
+
+	// 権限のないユーザーには、メンバーの有無にかかわらず同じ応答を返す
+	membersPath := "/api/v1/projects/" + projectID + "/members/"
+	for _, memberID := range []string{otherMemberID, "missing"} {
+		w := sendJSON(router, "DELETE", membersPath+memberID, strangerToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code, memberID)
+	}
+
+	// 他のプロジェクトのメンバーは削除できない
+	w := sendJSON(router, "DELETE", membersPath+otherMemberID, ownerToken, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetMembersHiddenFromNonMembers(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+	setupMemberRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":     "Public Map",
+		"is_public": true,
+		"content":   map[string]interface{}{"blocks": []interface{}{}},
+	})
+	memberToken, _ := addMember(t, router, handler, projectID, ownerToken, "member", "viewer")
+	membersPath := "/api/v1/projects/" + projectID + "/members"
+
+	// 公開プロジェクトでもメンバー以外にはメールアドレスを返さない
+	w := sendJSON(router, "GET", membersPath, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	_, strangerToken := registerTestUser(t, handler, "stranger")
+	w = sendJSON(router, "GET", membersPath, strangerToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "GET", membersPath, memberToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAcceptInvitationRequiresToken(t *testing.T) {
+	router, handler := setupTestRouter()
+	router.POST("/api/v1/projects", handler.CreateProject)
+	setupMemberRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Team Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+	membersPath := "/api/v1/projects/" + projectID + "/members"
+
+	// 未登録のアドレスへの招待
+	w := sendJSON(router, "POST", membersPath, ownerToken, map[string]interface{}{
+		"email": "invitee@example.com",
+		"role":  "editor",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	token := inviteToken(t, w)
+
+	// 同じアドレスで登録しただけでは承認できない（メールアドレスは未確認のため）
+	_, squatterToken := registerTestUser(t, handler, "invitee")
+	w = sendJSON(router, "POST", membersPath+"/accept", squatterToken, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 招待トークンを受け取った人は別のアドレスのアカウントでも承認できる
+	_, inviteeToken := registerTestUser(t, handler, "invitee2")
+	w = sendJSON(router, "POST", membersPath+"/accept", inviteeToken, map[string]interface{}{"token": token})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 招待一覧にトークンは含めない
+	w = sendJSON(router, "GET", membersPath, ownerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), token)
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"thinking-blocks-backend/thinking"
+	"thinking-blocks-backend/utils"
+)
+
+// プロジェクトの入力の上限
+const (
+	MaxTitleLength = 200
+	MaxTags        = 20
+	MaxTagLength   = 50
+)
+
+// projectReadOnlyFields - サーバーが管理し、更新では変更できないフィールド
+var projectReadOnlyFields = map[string]bool{
+	"id":         true,
+	"owner_id":   true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// projectPatch - プロジェクト更新で変更できるフィールド（JSON Merge Patch）
+// 省略したフィールドは変更せず、null を指定したフィールドは既定値に戻す
+type projectPatch struct {
+	Title       *string
+	Description *string
+	Content     json.RawMessage
+	Theme       *string
+	IsPublic    *bool
+	Tags        *[]string
+	Version     int // 更新元のバージョン（0は指定なし）
+}
+
+// parseProjectPatch - 更新内容を読み込み、フィールド単位で検証する
+func parseProjectPatch(body []byte) (*projectPatch, *utils.AppError) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return nil, utils.NewBadRequestError("Request body must be a JSON object")
+	}
+
+	patch := &projectPatch{}
+	var errs []utils.FieldError
+	add := func(field, message string) {
+		errs = append(errs, utils.FieldError{Field: field, Message: message})
+	}
+
+	for _, name := range sortedFieldNames(fields) {
+		raw := fields[name]
+		null := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		switch name {
+		case "title":
+			var title string
+			if null || json.Unmarshal(raw, &title) != nil {
+				add(name, "must be a string")
+			} else if msg := validateTitle(title); msg != "" {
+				add(name, msg)
+			} else {
+				title = strings.TrimSpace(title)
+				patch.Title = &title
+			}
+		case "description":
+			var description string
+			if !null && json.Unmarshal(raw, &description) != nil {
+				add(name, "must be a string or null")
+			} else {
+				patch.Description = &description
+			}
+		case "content":
+			if null {
+				add(name, "must not be null")
+			} else if _, appErr := thinking.Parse(raw); appErr != nil {
+				errs = append(errs, appErr.Fields...)
+			} else {
+				patch.Content = raw
+			}
+		case "theme":
+			theme := thinking.DefaultTheme
+			if !null && json.Unmarshal(raw, &theme) != nil {
+				add(name, "must be a string or null")
+			} else if msg := validateTheme(theme); msg != "" {
+				add(name, msg)
+			} else {
+				patch.Theme = &theme
+			}
+		case "is_public":
+			var isPublic bool
+			if !null && json.Unmarshal(raw, &isPublic) != nil {
+				add(name, "must be a boolean or null")
+			} else {
+				patch.IsPublic = &isPublic
+			}
+		case "tags":
+			var tags []string
+			if !null && json.Unmarshal(raw, &tags) != nil {
+				add(name, "must be an array of strings or null")
+			} else if normalized, tagErrs := normalizeTags(tags); len(tagErrs) > 0 {
+				errs = append(errs, tagErrs...)
+			} else {
+				patch.Tags = &normalized
+			}
+		case "version":
+			if !null && (json.Unmarshal(raw, &patch.Version) != nil || patch.Version < 1) {
+				add(name, "must be a positive integer")
+			}
+		default:
+			if projectReadOnlyFields[name] {
+				add(name, "is read-only")
+			} else {
+				add(name, "is not an updatable field")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, utils.NewValidationError("Invalid project update", errs)
+	}
+	return patch, nil
+}
+
+// updates - 変更するカラムと値
+func (p *projectPatch) updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if p.Title != nil {
+		updates["title"] = *p.Title
+	}
+	if p.Description != nil {
+		updates["description"] = *p.Description
+	}
+	if p.Content != nil {
+		updates["content"] = []byte(p.Content)
+	}
+	if p.Theme != nil {
+		updates["theme"] = *p.Theme
+	}
+	if p.IsPublic != nil {
+		updates["is_public"] = *p.IsPublic
+	}
+	if p.Tags != nil {
+		// map での更新ではシリアライザが使われないため、JSONに変換しておく
+		tags, _ := json.Marshal(*p.Tags)
+		updates["tags"] = tags
+	}
+	return updates
+}
+
+// validateTitle - タイトルの検証。不正な場合は理由を返す
+func validateTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "must not be empty"
+	}
+	if utf8.RuneCountInString(title) > MaxTitleLength {
+		return fmt.Sprintf("must be at most %d characters", MaxTitleLength)
+	}
+	return ""
+}
+
+// validateTheme - テーマの検証。不正な場合は理由を返す
+func validateTheme(theme string) string {
+	if !thinking.KnownThemes[theme] {
+		return "must be one of " + strings.Join(sortedFieldNames(thinking.KnownThemes), ", ")
+	}
+	return ""
+}
+
+// normalizeTags - タグの前後の空白を除き、重複を除いて検証する
+func normalizeTags(tags []string) ([]string, []utils.FieldError) {
+	var errs []utils.FieldError
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for i, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		field := fmt.Sprintf("tags[%d]", i)
+		switch {
+		case tag == "":
+			errs = append(errs, utils.FieldError{Field: field, Message: "must not be empty"})
+		case utf8.RuneCountInString(tag) > MaxTagLength:
+			errs = append(errs, utils.FieldError{Field: field, Message: fmt.Sprintf("must be at most %d characters", MaxTagLength)})
+		case !seen[tag]:
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	if len(normalized) > MaxTags {
+		errs = append(errs, utils.FieldError{Field: "tags", Message: fmt.Sprintf("must not contain more than %d tags", MaxTags)})
+	}
+	return normalized, errs
+}
+
+func sortedFieldNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
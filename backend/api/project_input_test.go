@@ -0,0 +1,180 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type projectResponse struct {
+	Data struct {
+		ID          string   `json:"id"`
+		Title       string   `json:"title"`
+		Description string   `json:"description"`
+		Theme       string   `json:"theme"`
+		OwnerID     string   `json:"owner_id"`
+		IsPublic    bool     `json:"is_public"`
+		Tags        []string `json:"tags"`
+		Version     int      `json:"version"`
+		UpdatedAt   string   `json:"updated_at"`
+	} `json:"data"`
+	Fields []struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	} `json:"fields"`
+}
+
+func decodeProject(t *testing.T, body []byte) projectResponse {
+	t.Helper()
+	var response projectResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	return response
+}
+
+func TestPatchProjectMergeSemantics(t *testing.T) {
+	router, handler := setupRevisionRoutes(0)
+	router.PATCH("/api/v1/projects/:id", handler.UpdateProject)
+	token := issueToken(t, handler, "owner")
+
+	projectID := createTestProject(t, router, token, map[string]interface{}{
+		"title":       "Workshop",
+		"description": "before",
+		"content":     contentWithText("最初"),
+		"theme":       "research",
+		"is_public":   true,
+		"tags":        []string{" ux ", "ux", "research"},
+	})
+	path := "/api/v1/projects/" + projectID
+
+	w := sendJSON(router, "GET", path, token, nil)
+	created := decodeProject(t, w.Body.Bytes())
+	assert.Equal(t, []string{"ux", "research"}, created.Data.Tags)
+
+	// 省略したフィールドは変更せず、null は既定値に戻す
+	w = sendJSON(router, "PATCH", path, token, map[string]interface{}{
+		"title":       "  Workshop v2  ",
+		"description": nil,
+		"theme":       nil,
+		"tags":        []string{"retro", "retro "},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	patched := decodeProject(t, w.Body.Bytes())
+	assert.Equal(t, "Workshop v2", patched.Data.Title)
+	assert.Equal(t, "", patched.Data.Description)
+	assert.Equal(t, "creative", patched.Data.Theme)
+	assert.True(t, patched.Data.IsPublic)
+	assert.Equal(t, []string{"retro"}, patched.Data.Tags)
+	assert.Equal(t, 2, patched.Data.Version)
+
+	// レスポンスは保存された行を反映する
+	w = sendJSON(router, "GET", path, token, nil)
+	stored := decodeProject(t, w.Body.Bytes())
+	assert.Equal(t, patched.Data, stored.Data)
+
+	w = sendJSON(router, "PATCH", path, token, map[string]interface{}{"tags": nil, "is_public": nil})
+	assert.Equal(t, http.StatusOK, w.Code)
+	patched = decodeProject(t, w.Body.Bytes())
+	assert.Empty(t, patched.Data.Tags)
+	assert.False(t, patched.Data.IsPublic)
+}
+
+func TestPatchProjectVisibilityRequiresShare(t *testing.T) {
+	router, handler := setupRevisionRoutes(0)
+	router.PATCH("/api/v1/projects/:id", handler.UpdateProject)
+	setupMemberRoutes(router, handler)
+	ownerToken := issueToken(t, handler, "owner")
+
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Private Map",
+		"content": contentWithText("秘密"),
+	})
+	editorToken, _ := addMember(t, router, handler, projectID, ownerToken, "editor", "editor")
+	path := "/api/v1/projects/" + projectID
+
+	// 編集者は内容を変更できるが、公開範囲は変更できない
+	w := sendJSON(router, "PATCH", path, editorToken, map[string]interface{}{"title": "Renamed", "is_public": true})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "GET", path, ownerToken, nil)
+	stored := decodeProject(t, w.Body.Bytes())
+	assert.Equal(t, "Private Map", stored.Data.Title)
+	assert.False(t, stored.Data.IsPublic)
+
+	// 値が変わらない場合は編集者も送れる
+	w = sendJSON(router, "PATCH", path, editorToken, map[string]interface{}{"title": "Renamed", "is_public": false})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendJSON(router, "PATCH", path, ownerToken, map[string]interface{}{"is_public": true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, decodeProject(t, w.Body.Bytes()).Data.IsPublic)
+}
+
+func TestPatchProjectRejectsInvalidFields(t *testing.T) {
+	router, handler := setupRevisionRoutes(0)
+	router.PATCH("/api/v1/projects/:id", handler.UpdateProject)
+	token := issueToken(t, handler, "owner")
+
+	projectID := createTestProject(t, router, token, map[string]interface{}{
+		"title":   "Workshop",
+		"content": contentWithText("最初"),
+	})
+	path := "/api/v1/projects/" + projectID
+
+	cases := []struct {
+		name   string
+		body   map[string]interface{}
+		fields []string
+	}{
+		{"read-only owner", map[string]interface{}{"owner_id": "attacker", "id": "other"}, []string{"id", "owner_id"}},
+		{"unknown column", map[string]interface{}{"deleted_at": "2020-01-01T00:00:00Z"}, []string{"deleted_at"}},
+		{"empty title", map[string]interface{}{"title": "   "}, []string{"title"}},
+		{"null title", map[string]interface{}{"title": nil}, []string{"title"}},
+		{"unknown theme", map[string]interface{}{"theme": "party"}, []string{"theme"}},
+		{"bad tags", map[string]interface{}{"tags": []string{"ok", ""}}, []string{"tags[1]"}},
+		{"tags type", map[string]interface{}{"tags": "ux"}, []string{"tags"}},
+		{"null content", map[string]interface{}{"content": nil}, []string{"content"}},
+		{"public type", map[string]interface{}{"is_public": "yes"}, []string{"is_public"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := sendJSON(router, "PATCH", path, token, tc.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			response := decodeProject(t, w.Body.Bytes())
+			fields := make([]string, 0, len(response.Fields))
+			for _, f := range response.Fields {
+				fields = append(fields, f.Field)
+			}
+			assert.Equal(t, tc.fields, fields)
+		})
+	}
+
+	// 不正な更新は何も変更しない
+	w := sendJSON(router, "GET", path, token, nil)
+	project := decodeProject(t, w.Body.Bytes())
+	assert.Equal(t, "owner", project.Data.OwnerID)
+	assert.Equal(t, projectID, project.Data.ID)
+	assert.Equal(t, 1, project.Data.Version)
+}
+
+func TestCreateProjectValidatesThemeAndTags(t *testing.T) {
+	router, handler := setupRevisionRoutes(0)
+	token := issueToken(t, handler, "owner")
+
+	w := sendJSON(router, "POST", "/api/v1/projects", token, map[string]interface{}{
+		"title":   "Workshop",
+		"content": contentWithText("最初"),
+		"theme":   "party",
+		"tags":    []string{""},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	response := decodeProject(t, w.Body.Bytes())
+	if assert.Len(t, response.Fields, 2) {
+		assert.Equal(t, "theme", response.Fields[0].Field)
+		assert.Equal(t, "tags[0]", response.Fields[1].Field)
+	}
+}
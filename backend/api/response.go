@@ -0,0 +1,12 @@
+package api
+
+import (
+	"thinking-blocks-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError - AppErrorを共通のエラーレスポンスとして返す
+func respondError(c *gin.Context, err *utils.AppError) {
+	c.AbortWithStatusJSON(err.Code, utils.NewErrorResponse(err))
+}
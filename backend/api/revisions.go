@@ -0,0 +1,273 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/policy"
+	"thinking-blocks-backend/thinking"
+	"thinking-blocks-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// revisionMeta - リビジョンの作成者と作成元
+type revisionMeta struct {
+	AuthorID     string
+	ShareLinkID  string
+	Source       string
+	RestoredFrom *int
+}
+
+// lockProject - トランザクション内でプロジェクトの行をロックして読み込む（SQLiteではロックは無視される）
+func lockProject(tx *gorm.DB, projectID string) (*database.Project, error) {
+	var project database.Project
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&project, "id = ?", projectID).Error; err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// recordRevision - 内容をリビジョンとして記録し、上限を超えた古いリビジョンを削除
+// 最新のリビジョンと同じ内容の場合は記録しない。呼び出し側でプロジェクトの行をロックしておくこと
+func (h *Handler) recordRevision(tx *gorm.DB, projectID string, content []byte, meta revisionMeta) (*database.ProjectRevision, error) {
+	var latest database.ProjectRevision
+	err := tx.Where("project_id = ?", projectID).Order("number DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil && sameJSON(latest.Content, content) {
+		return &latest, nil
+	}
+
+	revision := database.ProjectRevision{
+		ProjectID:    projectID,
+		Number:       latest.Number + 1,
+		Content:      content,
+		AuthorID:     meta.AuthorID,
+		ShareLinkID:  meta.ShareLinkID,
+		Source:       meta.Source,
+		RestoredFrom: meta.RestoredFrom,
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return nil, err
+	}
+
+	if h.revisionLimit > 0 && revision.Number > h.revisionLimit {
+		if err := tx.Where("project_id = ? AND number <= ?", projectID, revision.Number-h.revisionLimit).
+			Delete(&database.ProjectRevision{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
+
+// sameJSON - 空白やキーの順序を無視してJSONが等しいか
+func sameJSON(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// findRevision - URLのリビジョン番号からリビジョンを取得
+func (h *Handler) findRevision(c *gin.Context, projectID string) (*database.ProjectRevision, bool) {
+	number, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || number < 1 {
+		respondError(c, utils.NewBadRequestError("Revision must be a positive integer"))
+		return nil, false
+	}
+
+	var revision database.ProjectRevision
+	if err := h.db.Where("project_id = ? AND number = ?", projectID, number).First(&revision).Error; err != nil {
+		respondError(c, utils.NewNotFoundError("Revision not found"))
+		return nil, false
+	}
+	return &revision, true
+}
+
+// GetRevisions - リビジョン一覧（新しい順、内容は含まない）
+func (h *Handler) GetRevisions(c *gin.Context) {
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionView)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	offset, limit := utils.Paginate(page, pageSize)
+
+	var revisions []database.ProjectRevision
+	if err := h.db.Omit("content").
+		Where("project_id = ?", project.ID).
+		Order("number DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&revisions).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to fetch revisions"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    revisions,
+		"count":   len(revisions),
+	})
+}
+
+// GetRevision - リビジョンの内容を取得
+func (h *Handler) GetRevision(c *gin.Context) {
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionView)
+	if !ok {
+		return
+	}
+
+	revision, ok := h.findRevision(c, project.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    revision,
+	})
+}
+
+// DiffRevision - リビジョンの差分
+// against で比較元のリビジョン番号を指定する。省略時は直前のリビジョン（なければ空のドキュメント）と比較する
+func (h *Handler) DiffRevision(c *gin.Context) {
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionView)
+	if !ok {
+		return
+	}
+
+	revision, ok := h.findRevision(c, project.ID)
+	if !ok {
+		return
+	}
+
+	var base *database.ProjectRevision
+	if against := c.Query("against"); against != "" {
+		number, err := strconv.Atoi(against)
+		if err != nil || number < 1 {
+			respondError(c, utils.NewValidationError("Invalid diff request", []utils.FieldError{
+				{Field: "against", Message: "must be a positive integer"},
+			}))
+			return
+		}
+		var found database.ProjectRevision
+		if err := h.db.Where("project_id = ? AND number = ?", project.ID, number).First(&found).Error; err != nil {
+			respondError(c, utils.NewNotFoundError("Revision not found"))
+			return
+		}
+		base = &found
+	} else {
+		var previous database.ProjectRevision
+		err := h.db.Where("project_id = ? AND number < ?", project.ID, revision.Number).Order("number DESC").First(&previous).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, utils.NewInternalServerError("Failed to fetch revisions"))
+			return
+		}
+		if err == nil {
+			base = &previous
+		}
+	}
+
+	from := &thinking.Document{}
+	fromNumber := 0
+	if base != nil {
+		doc, appErr := thinking.Parse(base.Content)
+		if appErr != nil {
+			respondError(c, unreadableRevision(base.Number))
+			return
+		}
+		from, fromNumber = doc, base.Number
+	}
+
+	to, appErr := thinking.Parse(revision.Content)
+	if appErr != nil {
+		respondError(c, unreadableRevision(revision.Number))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    thinking.Compare(from, to),
+		"from":    fromNumber,
+		"to":      revision.Number,
+	})
+}
+
+// unreadableRevision - 現在の形式で読み込めない（履歴導入前の）リビジョン
+func unreadableRevision(number int) *utils.AppError {
+	return utils.NewAppError(http.StatusUnprocessableEntity, "Revision cannot be compared",
+		"Revision "+strconv.Itoa(number)+" is not a valid thinking_structure document")
+}
+
+// RestoreRevision - リビジョンの内容に戻す（復元も新しいリビジョンとして記録）
+func (h *Handler) RestoreRevision(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionEdit)
+	if !ok {
+		return
+	}
+
+	revision, ok := h.findRevision(c, project.ID)
+	if !ok {
+		return
+	}
+
+	expected, appErr := expectedVersion(c)
+	if appErr != nil {
+		respondError(c, appErr)
+		return
+	}
+
+	var restored *database.ProjectRevision
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		locked, err := lockProject(tx, project.ID)
+		if err != nil {
+			return err
+		}
+		if err := updateProjectVersion(tx, locked, expected, map[string]interface{}{
+			"content": []byte(revision.Content),
+		}); err != nil {
+			return err
+		}
+
+		restored, err = h.recordRevision(tx, project.ID, revision.Content, revisionMeta{
+			AuthorID:     userID,
+			Source:       database.RevisionSourceRestore,
+			RestoredFrom: &revision.Number,
+		})
+		return err
+	})
+	if err != nil {
+		respondUpdateError(c, err, "Failed to restore revision")
+		return
+	}
+
+	if err := h.db.First(project, "id = ?", project.ID).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to restore revision"))
+		return
+	}
+
+	setProjectETag(c, project)
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"data":     project,
+		"revision": restored.Number,
+	})
+}
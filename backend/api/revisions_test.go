@@ -0,0 +1,223 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"thinking-blocks-backend/api"
+	"thinking-blocks-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type revisionResponse struct {
+	Number       int             `json:"number"`
+	AuthorID     string          `json:"author_id"`
+	Source       string          `json:"source"`
+	RestoredFrom *int            `json:"restored_from"`
+	Content      json.RawMessage `json:"content"`
+}
+
+func setupRevisionRoutes(revisionLimit int) (*gin.Engine, *api.Handler) {
+	gin.SetMode(gin.TestMode)
+	db, _ := setupTestDB()
+	cfg := testConfig()
+	cfg.RevisionLimit = revisionLimit
+	handler := api.NewHandler(db, nil, cfg)
+
+	router := gin.New()
+	router.Use(middleware.Authenticate(handler.Auth()))
+	router.POST("/api/v1/projects", handler.CreateProject)
+	router.GET("/api/v1/projects/:id", handler.GetProject)
+	router.PUT("/api/v1/projects/:id", handler.UpdateProject)
+	router.GET("/api/v1/projects/:id/revisions", handler.GetRevisions)
+	router.GET("/api/v1/projects/:id/revisions/:rev", handler.GetRevision)
+	router.GET("/api/v1/projects/:id/revisions/:rev/diff", handler.DiffRevision)
+	router.POST("/api/v1/projects/:id/revisions/:rev/restore", handler.RestoreRevision)
+	return router, handler
+}
+
+func contentWithText(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"thinking_structure": map[string]interface{}{
+			"blocks": []interface{}{
+				map[string]interface{}{"id": "b1", "type": "thinking_why", "text": text},
+			},
+		},
+	}
+}
+
+func listRevisions(t *testing.T, router *gin.Engine, token, projectID string) []revisionResponse {
+	t.Helper()
+	w := sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("failed to list revisions: %d %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Data []revisionResponse `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response.Data
+}
+
+func TestRevisionHistoryAndRestore(t *testing.T) {
+	router, handler := setupRevisionRoutes(0)
+	token := issueToken(t, handler, "owner")
+
+	projectID := createTestProject(t, router, token, map[string]interface{}{
+		"title":   "Versioned",
+		"content": contentWithText("最初"),
+	})
+
+	w := sendJSON(router, "PUT", "/api/v1/projects/"+projectID, token, map[string]interface{}{"content": contentWithText("二番目")})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 内容が変わらない更新はリビジョンを作らない
+	w = sendJSON(router, "PUT", "/api/v1/projects/"+projectID, token, map[string]interface{}{"title": "Renamed"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendJSON(router, "PUT", "/api/v1/projects/"+projectID, token, map[string]interface{}{"content": contentWithText("二番目")})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	revisions := listRevisions(t, router, token, projectID)
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, 2, revisions[0].Number)
+		assert.Equal(t, "update", revisions[0].Source)
+		assert.Equal(t, "owner", revisions[0].AuthorID)
+		assert.Equal(t, "create", revisions[1].Source)
+		// 一覧には内容を含めない
+		assert.Empty(t, revisions[0].Content)
+	}
+
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions/1", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "最初")
+
+	w = sendJSON(router, "POST", "/api/v1/projects/"+projectID+"/revisions/1/restore", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID, token, nil)
+	var project struct {
+		Data struct {
+			Content []byte `json:"content"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &project)
+	assert.Contains(t, string(project.Data.Content), "最初")
+
+	revisions = listRevisions(t, router, token, projectID)
+	if assert.Len(t, revisions, 3) {
+		assert.Equal(t, "restore", revisions[0].Source)
+		if assert.NotNil(t, revisions[0].RestoredFrom) {
+			assert.Equal(t, 1, *revisions[0].RestoredFrom)
+		}
+	}
+
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions/99", token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions/abc", token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRevisionRetention(t *testing.T) {
+	router, handler := setupRevisionRoutes(3)
+	token := issueToken(t, handler, "owner")
+
+	projectID := createTestProject(t, router, token, map[string]interface{}{
+		"title":   "Busy",
+		"content": contentWithText("v1"),
+	})
+	for i := 2; i <= 5; i++ {
+		w := sendJSON(router, "PUT", "/api/v1/projects/"+projectID, token, map[string]interface{}{"content": contentWithText(fmt.Sprintf("v%d", i))})
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	revisions := listRevisions(t, router, token, projectID)
+	numbers := make([]int, 0, len(revisions))
+	for _, r := range revisions {
+		numbers = append(numbers, r.Number)
+	}
+	assert.Equal(t, []int{5, 4, 3}, numbers)
+}
+
+func TestRevisionPermissions(t *testing.T) {
+	router, handler := setupRevisionRoutes(0)
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":     "Public",
+		"content":   contentWithText("公開"),
+		"is_public": true,
+	})
+
+	// 公開プロジェクトの履歴は誰でも閲覧できるが、復元には編集権限が必要
+	strangerToken := issueToken(t, handler, "stranger")
+	w := sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions", strangerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendJSON(router, "POST", "/api/v1/projects/"+projectID+"/revisions/1/restore", strangerToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "POST", "/api/v1/projects/"+projectID+"/revisions/1/restore", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestDiffRevision(t *testing.T) {
+	router, handler := setupRevisionRoutes(0)
+	token := issueToken(t, handler, "owner")
+
+	projectID := createTestProject(t, router, token, map[string]interface{}{
+		"title":   "Workshop",
+		"content": contentWithText("前"),
+	})
+	w := sendJSON(router, "PUT", "/api/v1/projects/"+projectID, token, map[string]interface{}{"content": contentWithText("後")})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	type diffResponse struct {
+		Data struct {
+			Added    []map[string]interface{} `json:"added"`
+			Retexted []map[string]interface{} `json:"retexted"`
+		} `json:"data"`
+		From int `json:"from"`
+		To   int `json:"to"`
+	}
+
+	// 省略時は直前のリビジョンと比較
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions/2/diff", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response diffResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 1, response.From)
+	assert.Equal(t, 2, response.To)
+	if assert.Len(t, response.Data.Retexted, 1) {
+		assert.Equal(t, "前", response.Data.Retexted[0]["from"])
+		assert.Equal(t, "後", response.Data.Retexted[0]["to"])
+	}
+
+	// 最初のリビジョンは空のドキュメントと比較
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions/1/diff", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	response = diffResponse{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, 0, response.From)
+	assert.Len(t, response.Data.Added, 1)
+
+	// 新しいリビジョンを比較元にすることもできる
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions/1/diff?against=2", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	response = diffResponse{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if assert.Len(t, response.Data.Retexted, 1) {
+		assert.Equal(t, "後", response.Data.Retexted[0]["from"])
+	}
+
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions/2/diff?against=9", token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions/2/diff?against=x", token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	strangerToken := issueToken(t, handler, "stranger")
+	w = sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/revisions/2/diff", strangerToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
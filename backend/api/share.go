@@ -0,0 +1,587 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"thinking-blocks-backend/auth"
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/middleware"
+	"thinking-blocks-backend/policy"
+	"thinking-blocks-backend/thinking"
+	"thinking-blocks-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 共有リンクの制限に関するエラーコード
+const (
+	ErrCodeSharePasswordRequired = "share_password_required"
+	ErrCodeSharePasswordInvalid  = "share_password_invalid"
+	ErrCodeShareLoginRequired    = "share_login_required"
+	ErrCodeShareDomainForbidden  = "share_domain_forbidden"
+)
+
+// SharePasswordHeader - 共有リンクのパスワードを渡すヘッダー
+const SharePasswordHeader = "X-Share-Password"
+
+// SharePasswordCookie - WebSocket接続時に共有リンクのパスワードを渡すクッキー
+// ブラウザはWebSocketの接続時にヘッダーを設定できないため、接続時に限り受け付ける
+// （クエリはアクセスログに残るため使わない）
+const SharePasswordCookie = "thinking_blocks_share_password"
+
+// CreateShareLink - 共有リンク作成
+func (h *Handler) CreateShareLink(c *gin.Context) {
+	if _, ok := requireUser(c); !ok {
+		return
+	}
+
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionShare)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Permission    string     `json:"permission"`
+		ExpiresAt     *time.Time `json:"expires_at"`
+		MaxUses       *int       `json:"max_uses"`
+		Password      string     `json:"password"`
+		AllowedDomain string     `json:"allowed_domain"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if input.Permission == "" {
+		input.Permission = database.SharePermissionView
+	}
+	if input.Permission != database.SharePermissionView && input.Permission != database.SharePermissionEdit {
+		respondError(c, utils.NewBadRequestError("Permission must be view or edit"))
+		return
+	}
+
+	shareLink := database.ShareLink{
+		ProjectID:  project.ID,
+		Permission: input.Permission,
+		ExpiresAt:  input.ExpiresAt,
+		MaxUses:    input.MaxUses,
+	}
+
+	if input.Password != "" {
+		hash, err := auth.HashPassword(input.Password)
+		if err != nil {
+			respondError(c, utils.NewBadRequestError(err.Error()))
+			return
+		}
+		shareLink.PasswordHash = hash
+	}
+
+	if input.AllowedDomain != "" {
+		domain, ok := normalizeDomain(input.AllowedDomain)
+		if !ok {
+			respondError(c, utils.NewBadRequestError("Invalid allowed_domain"))
+			return
+		}
+		shareLink.AllowedDomain = domain
+	}
+
+	if err := h.db.Create(&shareLink).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to create share link",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    newShareLinkView(shareLink, time.Now()),
+	})
+}
+
+// GetShareLinks - 共有リンク一覧
+func (h *Handler) GetShareLinks(c *gin.Context) {
+	if _, ok := requireUser(c); !ok {
+		return
+	}
+
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionShare)
+	if !ok {
+		return
+	}
+
+	var shareLinks []database.ShareLink
+	if err := h.db.Where("project_id = ?", project.ID).Order("created_at DESC").Find(&shareLinks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to fetch share links",
+		})
+		return
+	}
+
+	now := time.Now()
+	views := make([]shareLinkView, 0, len(shareLinks))
+	for _, shareLink := range shareLinks {
+		views = append(views, newShareLinkView(shareLink, now))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    views,
+	})
+}
+
+// shareLinkView - 残り使用回数と状態を付加した共有リンク
+type shareLinkView struct {
+	database.ShareLink
+	RemainingUses     *int   `json:"remaining_uses"` // 無制限の場合はnull
+	Expired           bool   `json:"expired"`
+	Status            string `json:"status"` // active, expired, exhausted
+	PasswordProtected bool   `json:"password_protected"`
+}
+
+func newShareLinkView(shareLink database.ShareLink, now time.Time) shareLinkView {
+	view := shareLinkView{
+		ShareLink:         shareLink,
+		Status:            "active",
+		PasswordProtected: shareLink.PasswordHash != "",
+	}
+
+	if shareLink.MaxUses != nil {
+		remaining := *shareLink.MaxUses - shareLink.CurrentUses
+		if remaining < 0 {
+			remaining = 0
+		}
+		view.RemainingUses = &remaining
+		if remaining == 0 {
+			view.Status = "exhausted"
+		}
+	}
+
+	if shareLink.ExpiresAt != nil && !shareLink.ExpiresAt.After(now) {
+		view.Expired = true
+		view.Status = "expired"
+	}
+
+	return view
+}
+
+// findProjectShareLink - プロジェクトに属する共有リンクを取得（共有権限が必要）
+func (h *Handler) findProjectShareLink(c *gin.Context) (*database.ShareLink, bool) {
+	if _, ok := requireUser(c); !ok {
+		return nil, false
+	}
+
+	project, ok := h.authorizeProject(c, c.Param("id"), policy.ActionShare)
+	if !ok {
+		return nil, false
+	}
+
+	var shareLink database.ShareLink
+	if err := h.db.Where("id = ? AND project_id = ?", c.Param("linkId"), project.ID).
+		First(&shareLink).Error; err != nil {
+		respondError(c, utils.NewNotFoundError("Share link not found"))
+		return nil, false
+	}
+
+	return &shareLink, true
+}
+
+// UpdateShareLink - 共有リンクの権限・有効期限・使用回数上限を変更
+// null を指定した expires_at / max_uses は無制限に戻る
+func (h *Handler) UpdateShareLink(c *gin.Context) {
+	shareLink, ok := h.findProjectShareLink(c)
+	if !ok {
+		return
+	}
+
+	var input map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, utils.NewBadRequestError(err.Error()))
+		return
+	}
+
+	updates := map[string]interface{}{}
+	for key, raw := range input {
+		switch key {
+		case "permission":
+			var permission string
+			if err := json.Unmarshal(raw, &permission); err != nil ||
+				(permission != database.SharePermissionView && permission != database.SharePermissionEdit) {
+				respondError(c, utils.NewBadRequestError("Permission must be view or edit"))
+				return
+			}
+			updates["permission"] = permission
+		case "expires_at":
+			var expiresAt *time.Time
+			if err := json.Unmarshal(raw, &expiresAt); err != nil {
+				respondError(c, utils.NewBadRequestError("expires_at must be an RFC 3339 timestamp or null"))
+				return
+			}
+			updates["expires_at"] = expiresAt
+		case "max_uses":
+			var maxUses *int
+			if err := json.Unmarshal(raw, &maxUses); err != nil || (maxUses != nil && *maxUses < 0) {
+				respondError(c, utils.NewBadRequestError("max_uses must be a non-negative integer or null"))
+				return
+			}
+			updates["max_uses"] = maxUses
+		case "password":
+			var password *string
+			if err := json.Unmarshal(raw, &password); err != nil {
+				respondError(c, utils.NewBadRequestError("password must be a string or null"))
+				return
+			}
+			hash := ""
+			if password != nil && *password != "" {
+				var err error
+				if hash, err = auth.HashPassword(*password); err != nil {
+					respondError(c, utils.NewBadRequestError(err.Error()))
+					return
+				}
+			}
+			updates["password_hash"] = hash
+		case "allowed_domain":
+			var domain *string
+			if err := json.Unmarshal(raw, &domain); err != nil {
+				respondError(c, utils.NewBadRequestError("allowed_domain must be a string or null"))
+				return
+			}
+			normalized := ""
+			if domain != nil && *domain != "" {
+				var ok bool
+				if normalized, ok = normalizeDomain(*domain); !ok {
+					respondError(c, utils.NewBadRequestError("Invalid allowed_domain"))
+					return
+				}
+			}
+			updates["allowed_domain"] = normalized
+		default:
+			respondError(c, utils.NewBadRequestError("Unknown field: "+key))
+			return
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := h.db.Model(shareLink).Updates(updates).Error; err != nil {
+			respondError(c, utils.NewInternalServerError("Failed to update share link"))
+			return
+		}
+	}
+
+	if err := h.db.First(shareLink, "id = ?", shareLink.ID).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to reload share link"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    newShareLinkView(*shareLink, time.Now()),
+	})
+}
+
+// RevokeShareLink - 共有リンクを失効
+func (h *Handler) RevokeShareLink(c *gin.Context) {
+	shareLink, ok := h.findProjectShareLink(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.Delete(shareLink).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to revoke share link"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Share link revoked successfully",
+	})
+}
+
+// GetShareLinkAccesses - 共有リンクのアクセス履歴
+func (h *Handler) GetShareLinkAccesses(c *gin.Context) {
+	shareLink, ok := h.findProjectShareLink(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	offset, limit := utils.Paginate(page, pageSize)
+
+	var accesses []database.ShareLinkAccess
+	if err := h.db.Where("share_link_id = ?", shareLink.ID).
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&accesses).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to fetch share link accesses"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    accesses,
+		"count":   len(accesses),
+	})
+}
+
+// recordShareAccess - 共有リンクへのアクセスを記録
+func (h *Handler) recordShareAccess(c *gin.Context, shareLink *database.ShareLink, appErr *utils.AppError) {
+	status := http.StatusOK
+	if appErr != nil {
+		status = appErr.Code
+	}
+
+	access := database.ShareLinkAccess{
+		ShareLinkID: shareLink.ID,
+		ProjectID:   shareLink.ProjectID,
+		UserID:      middleware.CurrentUserID(c),
+		IPAddress:   c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		Status:      status,
+	}
+	if err := h.db.Create(&access).Error; err != nil {
+		log.Printf("Failed to record share link access: %v", err)
+	}
+}
+
+// ResolveShareLink - 共有トークンを検証し、有効なリンクを返す（使用回数は消費しない）
+// 使用回数の上限は使用を数える GET /share/:token だけで適用し、開いた後の編集や接続は拒否しない
+func (h *Handler) ResolveShareLink(token string) (*database.ShareLink, *utils.AppError) {
+	var shareLink database.ShareLink
+	if err := h.db.Where("token = ?", token).First(&shareLink).Error; err != nil {
+		return nil, utils.NewNotFoundError("Invalid or expired share link")
+	}
+
+	if shareLink.ExpiresAt != nil && shareLink.ExpiresAt.Before(time.Now()) {
+		return nil, utils.NewForbiddenError("Share link has expired")
+	}
+	return &shareLink, nil
+}
+
+// checkShareRestrictions - 共有リンクのパスワードとドメイン制限を検証
+func (h *Handler) checkShareRestrictions(shareLink *database.ShareLink, password, userID string) *utils.AppError {
+	if shareLink.PasswordHash != "" {
+		if password == "" {
+			return utils.NewUnauthorizedError("Share link requires a password").
+				WithErrorCode(ErrCodeSharePasswordRequired)
+		}
+		if !auth.CheckPassword(shareLink.PasswordHash, password) {
+			return utils.NewForbiddenError("Incorrect share link password").
+				WithErrorCode(ErrCodeSharePasswordInvalid)
+		}
+	}
+
+	if shareLink.AllowedDomain != "" {
+		if userID == "" {
+			return utils.NewUnauthorizedError("Share link requires signing in with a " + shareLink.AllowedDomain + " account").
+				WithErrorCode(ErrCodeShareLoginRequired)
+		}
+		var user database.User
+		if err := h.db.First(&user, "id = ?", userID).Error; err != nil || emailDomain(user.Email) != shareLink.AllowedDomain {
+			return utils.NewForbiddenError("Share link is restricted to " + shareLink.AllowedDomain + " accounts").
+				WithErrorCode(ErrCodeShareDomainForbidden)
+		}
+	}
+
+	return nil
+}
+
+// normalizeDomain - 許可ドメインを小文字・先頭の@なしに正規化
+func normalizeDomain(domain string) (string, bool) {
+	domain = strings.TrimPrefix(strings.ToLower(utils.SanitizeString(domain)), "@")
+	if domain == "" || strings.ContainsAny(domain, "@/ ") || !strings.Contains(domain, ".") {
+		return "", false
+	}
+	return domain, true
+}
+
+// emailDomain - メールアドレスのドメイン部分
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// consumeShareLink - 有効期限と使用回数上限を条件に、使用回数を1回分だけ原子的に消費
+func (h *Handler) consumeShareLink(linkID string) *utils.AppError {
+	result := h.db.Model(&database.ShareLink{}).
+		Where("id = ?", linkID).
+		Where("max_uses IS NULL OR current_uses < max_uses").
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		UpdateColumn("current_uses", gorm.Expr("current_uses + ?", 1))
+	if result.Error != nil {
+		return utils.NewInternalServerError("Failed to record share link usage")
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	// 条件に合わなかった理由を判定
+	var shareLink database.ShareLink
+	if err := h.db.First(&shareLink, "id = ?", linkID).Error; err != nil {
+		return utils.NewNotFoundError("Invalid or expired share link")
+	}
+	if shareLink.ExpiresAt != nil && !shareLink.ExpiresAt.After(time.Now()) {
+		return utils.NewForbiddenError("Share link has expired")
+	}
+	return utils.NewForbiddenError("Share link usage limit reached")
+}
+
+// openSharedProject - 共有リンクの使用回数を消費してプロジェクトを取得
+func (h *Handler) openSharedProject(shareLink *database.ShareLink) (*database.Project, *utils.AppError) {
+	var project database.Project
+	if err := h.db.First(&project, "id = ?", shareLink.ProjectID).Error; err != nil {
+		return nil, utils.NewNotFoundError("Shared project no longer exists")
+	}
+
+	if appErr := h.consumeShareLink(shareLink.ID); appErr != nil {
+		return nil, appErr
+	}
+
+	return &project, nil
+}
+
+// AccessSharedProject - 共有プロジェクトアクセス
+func (h *Handler) AccessSharedProject(c *gin.Context) {
+	var shareLink database.ShareLink
+	if err := h.db.Where("token = ?", c.Param("token")).First(&shareLink).Error; err != nil {
+		respondError(c, utils.NewNotFoundError("Invalid or expired share link"))
+		return
+	}
+
+	appErr := h.checkShareRestrictions(&shareLink, c.GetHeader(SharePasswordHeader), middleware.CurrentUserID(c))
+	var project *database.Project
+	if appErr == nil {
+		project, appErr = h.openSharedProject(&shareLink)
+	}
+	h.recordShareAccess(c, &shareLink, appErr)
+	if appErr != nil {
+		respondError(c, appErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"project_id": shareLink.ProjectID,
+			"permission": shareLink.Permission,
+			"expires_at": shareLink.ExpiresAt,
+			"project":    project,
+		},
+	})
+}
+
+// UpdateSharedProject - 編集権限の共有トークンでプロジェクトを更新
+func (h *Handler) UpdateSharedProject(c *gin.Context) {
+	shareLink, appErr := h.ResolveShareLink(c.Param("token"))
+	if appErr != nil {
+		respondError(c, appErr)
+		return
+	}
+
+	if appErr := h.checkShareRestrictions(shareLink, c.GetHeader(SharePasswordHeader), middleware.CurrentUserID(c)); appErr != nil {
+		respondError(c, appErr)
+		return
+	}
+
+	if shareLink.Permission != database.SharePermissionEdit {
+		respondError(c, utils.NewForbiddenError("Share link does not allow editing"))
+		return
+	}
+
+	var project database.Project
+	if err := h.db.First(&project, "id = ?", shareLink.ProjectID).Error; err != nil {
+		respondError(c, utils.NewNotFoundError("Shared project no longer exists"))
+		return
+	}
+
+	// 共有トークンで変更できるのは内容に関わるフィールドのみ
+	var input struct {
+		Title       *string         `json:"title"`
+		Description *string         `json:"description"`
+		Content     json.RawMessage `json:"content"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondError(c, utils.NewBadRequestError(err.Error()))
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Title != nil {
+		if msg := validateTitle(*input.Title); msg != "" {
+			respondError(c, utils.NewValidationError("Invalid project update", []utils.FieldError{
+				{Field: "title", Message: msg},
+			}))
+			return
+		}
+		updates["title"] = strings.TrimSpace(*input.Title)
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if len(input.Content) > 0 {
+		if _, appErr := thinking.Parse(input.Content); appErr != nil {
+			respondError(c, appErr)
+			return
+		}
+		updates["content"] = []byte(input.Content)
+	}
+
+	expected, appErr := expectedVersion(c)
+	if appErr != nil {
+		respondError(c, appErr)
+		return
+	}
+
+	if len(updates) > 0 {
+		err := h.db.Transaction(func(tx *gorm.DB) error {
+			locked, err := lockProject(tx, project.ID)
+			if err != nil {
+				return err
+			}
+			if err := updateProjectVersion(tx, locked, expected, updates); err != nil {
+				return err
+			}
+			if len(input.Content) > 0 {
+				_, err := h.recordRevision(tx, project.ID, input.Content, revisionMeta{
+					AuthorID:    middleware.CurrentUserID(c),
+					ShareLinkID: shareLink.ID,
+					Source:      database.RevisionSourceShare,
+				})
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			respondUpdateError(c, err, "Failed to update project")
+			return
+		}
+	}
+
+	if err := h.db.First(&project, "id = ?", project.ID).Error; err != nil {
+		respondError(c, utils.NewInternalServerError("Failed to reload project"))
+		return
+	}
+
+	setProjectETag(c, &project)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    project,
+	})
+}
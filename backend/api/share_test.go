@@ -0,0 +1,392 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"thinking-blocks-backend/api"
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupShareRoutes(router *gin.Engine, handler *api.Handler) {
+	router.POST("/api/v1/projects", handler.CreateProject)
+	router.POST("/api/v1/projects/:id/share", handler.CreateShareLink)
+	router.GET("/api/v1/projects/:id/share", handler.GetShareLinks)
+	router.GET("/api/v1/share/:token", handler.AccessSharedProject)
+	router.PUT("/api/v1/share/:token", handler.UpdateSharedProject)
+	router.PATCH("/api/v1/projects/:id/share/:linkId", handler.UpdateShareLink)
+	router.DELETE("/api/v1/projects/:id/share/:linkId", handler.RevokeShareLink)
+	router.GET("/api/v1/projects/:id/share/:linkId/accesses", handler.GetShareLinkAccesses)
+}
+
+// createShareLink - 共有リンクを作成してトークンを返す
+func createShareLink(t *testing.T, router *gin.Engine, token, projectID string, body map[string]interface{}) string {
+	w := sendJSON(router, "POST", "/api/v1/projects/"+projectID+"/share", token, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("failed to create share link: %d %s", w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response["data"].(map[string]interface{})["token"].(string)
+}
+
+func TestAccessSharedProjectReturnsContent(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Private Map",
+		"content": map[string]interface{}{"blocks": []interface{}{map[string]interface{}{"id": "b1", "type": "thinking_why", "text": "なぜ？"}}},
+	})
+	shareToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{"permission": "view"})
+
+	w := sendJSON(router, "GET", "/api/v1/share/"+shareToken, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	data := response["data"].(map[string]interface{})
+	assert.Equal(t, "view", data["permission"])
+	project := data["project"].(map[string]interface{})
+	assert.Equal(t, projectID, project["id"])
+	assert.NotEmpty(t, project["content"])
+
+	w = sendJSON(router, "GET", "/api/v1/share/unknown-token", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUpdateSharedProjectRequiresEditPermission(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Workshop Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+	viewToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{"permission": "view"})
+	editToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{"permission": "edit"})
+
+	update := map[string]interface{}{
+		"title":   "Edited via link",
+		"content": map[string]interface{}{"blocks": []interface{}{map[string]interface{}{"id": "b1", "type": "thinking_why", "text": "なぜ？"}}},
+	}
+
+	w := sendJSON(router, "PUT", "/api/v1/share/"+viewToken, "", update)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendJSON(router, "PUT", "/api/v1/share/"+editToken, "", update)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Edited via link", response["data"].(map[string]interface{})["title"])
+}
+
+func TestExhaustedShareLinkKeepsOpenAccess(t *testing.T) {
+	router, handler, server := setupSocketServer(t)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Workshop Map",
+		"content": contentWithText("共有"),
+	})
+	editToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{
+		"permission": "edit",
+		"max_uses":   1,
+	})
+
+	guest, _ := dialSocket(t, server, "/ws/"+projectID+"?share_token="+editToken, nil)
+	require.NotNil(t, guest)
+	guest.next()
+
+	// 最後の1回を使って開いた人は、そのまま保存できる
+	w := sendJSON(router, "GET", "/api/v1/share/"+editToken, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = sendJSON(router, "PUT", "/api/v1/share/"+editToken, "", map[string]interface{}{"title": "Edited via link"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 上限は使用を数える GET だけで適用する
+	w = sendJSON(router, "GET", "/api/v1/share/"+editToken, "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Share link usage limit reached", response["details"])
+
+	// 権限を確認し直しても、接続中のクライアントは切断されない
+	time.Sleep(100 * time.Millisecond)
+	guest.send(map[string]interface{}{
+		"type": websocket.TypeOp,
+		"data": map[string]interface{}{"op": "set_text", "block_id": "b1", "text": "使い切った後"},
+	})
+	assert.Equal(t, websocket.TypeOp, guest.next().Type)
+}
+
+func TestCreateShareLinkRejectsUnknownPermission(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+
+	w := sendJSON(router, "POST", "/api/v1/projects/"+projectID+"/share", ownerToken, map[string]interface{}{"permission": "admin"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestProjectSocketRejectsForeignShareToken(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+	router.GET("/ws/:projectId", handler.ProjectSocket(websocket.NewHub(nil, config.CollaborationConfig{})))
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+	shareToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{"permission": "edit"})
+
+	w := sendJSON(router, "GET", "/ws/another-project?share_token="+shareToken, "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAccessSharedProjectConcurrentUsageLimit(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Popular Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+
+	const maxUses = 5
+	const attempts = 50
+	shareToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{
+		"permission": "view",
+		"max_uses":   maxUses,
+	})
+
+	var wg sync.WaitGroup
+	codes := make(chan int, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- sendJSON(router, "GET", "/api/v1/share/"+shareToken, "", nil).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, maxUses, counts[http.StatusOK])
+	assert.Equal(t, attempts-maxUses, counts[http.StatusForbidden])
+
+	w := sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/share", ownerToken, nil)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	link := response["data"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, float64(maxUses), link["current_uses"])
+}
+
+func TestAccessSharedProjectExpired(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Old Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+	shareToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{
+		"permission": "view",
+		"expires_at": time.Now().Add(-time.Hour),
+	})
+
+	w := sendJSON(router, "GET", "/api/v1/share/"+shareToken, "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Share link has expired", response["details"])
+}
+
+func TestShareLinkLifecycle(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Leaky Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+	shareToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{
+		"permission": "view",
+		"max_uses":   3,
+	})
+	sharePath := "/api/v1/projects/" + projectID + "/share"
+
+	req, _ := http.NewRequest("GET", "/api/v1/share/"+shareToken, nil)
+	req.Header.Set("User-Agent", "workshop-browser")
+	req.RemoteAddr = "203.0.113.7:52100"
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := sendJSON(router, "GET", sharePath, ownerToken, nil)
+	var listResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	link := listResponse["data"].([]interface{})[0].(map[string]interface{})
+	linkID := link["id"].(string)
+	assert.Equal(t, float64(2), link["remaining_uses"])
+	assert.Equal(t, "active", link["status"])
+	assert.Equal(t, false, link["expired"])
+
+	// アクセス履歴
+	w = sendJSON(router, "GET", sharePath+"/"+linkID+"/accesses", ownerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var accessResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &accessResponse)
+	accesses := accessResponse["data"].([]interface{})
+	assert.Len(t, accesses, 1)
+	access := accesses[0].(map[string]interface{})
+	assert.Equal(t, "workshop-browser", access["user_agent"])
+	assert.Equal(t, float64(http.StatusOK), access["status"])
+	assert.Equal(t, "203.0.113.7", access["ip_address"])
+
+	// 権限の変更と使用回数上限の解除
+	w = sendJSON(router, "PATCH", sharePath+"/"+linkID, ownerToken, map[string]interface{}{
+		"permission": "edit",
+		"max_uses":   nil,
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var patchResponse map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &patchResponse)
+	patched := patchResponse["data"].(map[string]interface{})
+	assert.Equal(t, "edit", patched["permission"])
+	assert.Nil(t, patched["remaining_uses"])
+
+	w = sendJSON(router, "PATCH", sharePath+"/"+linkID, ownerToken, map[string]interface{}{"permission": "owner"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 期限切れに変更すると状態に反映される
+	w = sendJSON(router, "PATCH", sharePath+"/"+linkID, ownerToken, map[string]interface{}{
+		"expires_at": time.Now().Add(-time.Minute),
+	})
+	json.Unmarshal(w.Body.Bytes(), &patchResponse)
+	assert.Equal(t, "expired", patchResponse["data"].(map[string]interface{})["status"])
+
+	// 失効後はアクセスできない
+	w = sendJSON(router, "DELETE", sharePath+"/"+linkID, ownerToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendJSON(router, "GET", "/api/v1/share/"+shareToken, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = sendJSON(router, "GET", sharePath, ownerToken, nil)
+	json.Unmarshal(w.Body.Bytes(), &listResponse)
+	assert.Len(t, listResponse["data"].([]interface{}), 0)
+}
+
+func TestPasswordProtectedShareLink(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Client Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+	shareToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{
+		"permission": "view",
+		"password":   "client-secret",
+	})
+
+	access := func(password string) (int, string) {
+		req, _ := http.NewRequest("GET", "/api/v1/share/"+shareToken, nil)
+		if password != "" {
+			req.Header.Set(api.SharePasswordHeader, password)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		errorCode, _ := response["error_code"].(string)
+		return w.Code, errorCode
+	}
+
+	code, errorCode := access("")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, api.ErrCodeSharePasswordRequired, errorCode)
+
+	code, errorCode = access("wrong-secret")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, api.ErrCodeSharePasswordInvalid, errorCode)
+
+	code, _ = access("client-secret")
+	assert.Equal(t, http.StatusOK, code)
+
+	// ハッシュは一覧に出さない
+	w := sendJSON(router, "GET", "/api/v1/projects/"+projectID+"/share", ownerToken, nil)
+	assert.NotContains(t, w.Body.String(), "password_hash")
+	assert.Contains(t, w.Body.String(), `"password_protected":true`)
+}
+
+func TestDomainRestrictedShareLink(t *testing.T) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Client Map",
+		"content": map[string]interface{}{"blocks": []interface{}{}},
+	})
+	partnerToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{
+		"permission":     "view",
+		"allowed_domain": "@Partner.co.jp",
+	})
+	exampleToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{
+		"permission":     "view",
+		"allowed_domain": "example.com",
+	})
+	_, userToken := registerTestUser(t, handler, "guest")
+
+	errorCodeOf := func(w *httptest.ResponseRecorder) string {
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		errorCode, _ := response["error_code"].(string)
+		return errorCode
+	}
+
+	w := sendJSON(router, "GET", "/api/v1/share/"+partnerToken, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, api.ErrCodeShareLoginRequired, errorCodeOf(w))
+
+	w = sendJSON(router, "GET", "/api/v1/share/"+partnerToken, userToken, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, api.ErrCodeShareDomainForbidden, errorCodeOf(w))
+
+	w = sendJSON(router, "GET", "/api/v1/share/"+exampleToken, userToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = sendJSON(router, "POST", "/api/v1/projects/"+projectID+"/share", ownerToken, map[string]interface{}{
+		"allowed_domain": "not a domain",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
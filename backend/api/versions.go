@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ErrorCodeVersionConflict - 更新元のバージョンが古い場合のエラーコード
+const ErrorCodeVersionConflict = "version_conflict"
+
+// versionConflict - 更新元のバージョンがサーバーの最新と一致しない
+type versionConflict struct {
+	current *database.Project
+}
+
+func (e *versionConflict) Error() string {
+	return "project version " + strconv.Itoa(e.current.Version) + " does not match"
+}
+
+// projectETag - プロジェクトのバージョンを表すETag
+func projectETag(project *database.Project) string {
+	return `"` + strconv.Itoa(project.Version) + `"`
+}
+
+// setProjectETag - レスポンスにETagを付与
+func setProjectETag(c *gin.Context, project *database.Project) {
+	c.Header("ETag", projectETag(project))
+}
+
+// expectedVersion - If-Match ヘッダーから更新元のバージョンを取得
+// ヘッダーがない場合や "*" の場合は0（バージョンを確認しない）を返す
+func expectedVersion(c *gin.Context) (int, *utils.AppError) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.Atoi(tag)
+	if err != nil || version < 1 {
+		return 0, utils.NewBadRequestError("If-Match must be an ETag returned by the server")
+	}
+	return version, nil
+}
+
+// checkVersion - ロック済みのプロジェクトが更新元のバージョンのままか（expected が0の場合は確認しない）
+func checkVersion(locked *database.Project, expected int) error {
+	if expected != 0 && locked.Version != expected {
+		return &versionConflict{current: locked}
+	}
+	return nil
+}
+
+// updateProjectVersion - ロック済みのプロジェクトのバージョンを確認してから更新し、バージョンを1つ進める
+// expected が0の場合は確認しない
+func updateProjectVersion(tx *gorm.DB, locked *database.Project, expected int, updates map[string]interface{}) error {
+	if err := checkVersion(locked, expected); err != nil {
+		return err
+	}
+	updates["version"] = gorm.Expr("version + ?", 1)
+	return tx.Model(locked).Updates(updates).Error
+}
+
+// respondUpdateError - 更新トランザクションのエラーを返す
+// トランザクション内で返した AppError はそのまま返す
+// バージョンの不一致は409とし、クライアントがマージできるようにサーバーの最新の内容を含める
+func respondUpdateError(c *gin.Context, err error, message string) {
+	var appErr *utils.AppError
+	if errors.As(err, &appErr) {
+		respondError(c, appErr)
+		return
+	}
+	var conflict *versionConflict
+	if !errors.As(err, &conflict) {
+		respondError(c, utils.NewInternalServerError(message))
+		return
+	}
+
+	appErr = utils.NewConflictError("Project has been modified; current version is " + strconv.Itoa(conflict.current.Version)).
+		WithErrorCode(ErrorCodeVersionConflict)
+	response := utils.NewErrorResponse(appErr)
+
+	setProjectETag(c, conflict.current)
+	c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+		"success":    response.Success,
+		"error":      response.Error,
+		"details":    response.Details,
+		"code":       response.Code,
+		"error_code": response.ErrorCode,
+		"current":    conflict.current,
+	})
+}
@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// sendWithHeaders - 任意のヘッダー付きでJSONリクエストを送る
+func sendWithHeaders(router *gin.Engine, method, path, token string, headers map[string]string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	if body == nil {
+		jsonData = nil
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+type conflictResponse struct {
+	ErrorCode string `json:"error_code"`
+	Current   struct {
+		Title   string `json:"title"`
+		Version int    `json:"version"`
+	} `json:"current"`
+}
+
+func TestUpdateProjectVersionConflict(t *testing.T) {
+	router, handler := setupRevisionRoutes(0)
+	token := issueToken(t, handler, "owner")
+
+	w := sendJSON(router, "POST", "/api/v1/projects", token, map[string]interface{}{
+		"title":   "Shared map",
+		"content": contentWithText("最初"),
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+	var created struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path := "/api/v1/projects/" + created.Data.ID
+
+	w = sendJSON(router, "GET", path, token, nil)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+	w = sendWithHeaders(router, "GET", path, token, map[string]string{"If-None-Match": `"1"`}, nil)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// 1つ目のタブが保存するとバージョンが進む
+	w = sendWithHeaders(router, "PUT", path, token, map[string]string{"If-Match": `"1"`},
+		map[string]interface{}{"title": "Tab A"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var updated struct {
+		Data struct {
+			Title   string `json:"title"`
+			Version int    `json:"version"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.Equal(t, "Tab A", updated.Data.Title)
+	assert.Equal(t, 2, updated.Data.Version)
+
+	// 古いバージョンからの保存は409となり、最新の内容が返る
+	w = sendWithHeaders(router, "PUT", path, token, map[string]string{"If-Match": `"1"`},
+		map[string]interface{}{"title": "Tab B"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var conflict conflictResponse
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	assert.Equal(t, "version_conflict", conflict.ErrorCode)
+	assert.Equal(t, "Tab A", conflict.Current.Title)
+	assert.Equal(t, 2, conflict.Current.Version)
+
+	// 本文の version でも指定できる
+	w = sendJSON(router, "PUT", path, token, map[string]interface{}{"title": "Tab B", "version": 1})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = sendJSON(router, "PUT", path, token, map[string]interface{}{"title": "Tab B", "version": 2})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	// 復元も同じバージョンで確認する
+	w = sendWithHeaders(router, "POST", path+"/revisions/1/restore", token, map[string]string{"If-Match": `"2"`}, nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = sendWithHeaders(router, "POST", path+"/revisions/1/restore", token, map[string]string{"If-Match": `W/"3"`}, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	w = sendWithHeaders(router, "PUT", path, token, map[string]string{"If-Match": "garbage"},
+		map[string]interface{}{"title": "Tab C"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// If-Match がない場合は従来どおり上書きする
+	w = sendJSON(router, "PUT", path, token, map[string]interface{}{"title": "Tab C"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"hash/fnv"
+	"strings"
+
+	"thinking-blocks-backend/auth"
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/middleware"
+	"thinking-blocks-backend/policy"
+	"thinking-blocks-backend/thinking"
+	"thinking-blocks-backend/utils"
+	"thinking-blocks-backend/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DocumentStore - 共同編集ハブがプロジェクトの内容を読み書きするストア
+func (h *Handler) DocumentStore() websocket.Store {
+	return &projectDocumentStore{h: h}
+}
+
+type projectDocumentStore struct {
+	h *Handler
+}
+
+// LoadDocument - 保存済みの内容とバージョンを読み込む（内容が空の場合は空のドキュメント）
+func (s *projectDocumentStore) LoadDocument(projectID string) (*thinking.Document, int, error) {
+	var project database.Project
+	if err := s.h.db.First(&project, "id = ?", projectID).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(project.Content) == 0 {
+		return &thinking.Document{}, project.Version, nil
+	}
+
+	doc, appErr := thinking.Parse(project.Content)
+	if appErr != nil {
+		return nil, 0, appErr
+	}
+	return doc, project.Version, nil
+}
+
+// SaveDocument - 共同編集の結果を保存し、バージョンを進めてリビジョンを記録する
+// セッションが読み込んだ後にREST APIなどで更新されていた場合は上書きせず、
+// websocket.ErrVersionConflict を返してハブにマージさせる
+func (s *projectDocumentStore) SaveDocument(projectID string, content []byte, version int) (int, error) {
+	saved := 0
+	err := s.h.db.Transaction(func(tx *gorm.DB) error {
+		locked, err := lockProject(tx, projectID)
+		if err != nil {
+			return err
+		}
+		if locked.Version != version {
+			return websocket.ErrVersionConflict
+		}
+		if err := updateProjectVersion(tx, locked, version, map[string]interface{}{"content": content}); err != nil {
+			return err
+		}
+		saved = version + 1
+		_, err = s.h.recordRevision(tx, projectID, content, revisionMeta{Source: database.RevisionSourceLive})
+		return err
+	})
+	return saved, err
+}
+
+// ProjectSocket - プロジェクトのWebSocket接続
+// ベアラートークンまたはクッキーで認証し、プロジェクトの閲覧権限がある場合のみ接続する
+// share_token クエリがある場合はそのリンクの権限で参加し、閲覧用リンクは読み取り専用になる
+// リンクのパスワードは X-Share-Password ヘッダーかクッキーで受け取る
+// 接続中も権限を確認し直し、リンクの削除やメンバーからの除外で切断、ロールの変更で読み取り専用を切り替える
+// 再接続時は session と since（適用済みの最後の seq）で取りこぼした操作だけを受け取る
+func (h *Handler) ProjectSocket(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID := c.Param("projectId")
+		opts := websocket.JoinOptions{}
+
+		userID, appErr := h.socketUser(c)
+		if appErr != nil {
+			respondError(c, appErr)
+			return
+		}
+		if userID != "" {
+			c.Set(middleware.UserIDKey, userID)
+		}
+
+		access := func() (bool, *utils.AppError) {
+			return h.memberSocketAccess(projectID, userID)
+		}
+		if token := c.Query("share_token"); token != "" {
+			password, verified := socketSharePassword(c), ""
+			access = func() (bool, *utils.AppError) {
+				return h.shareSocketAccess(token, projectID, password, userID, &verified)
+			}
+		}
+		readOnly, appErr := access()
+		if appErr != nil {
+			respondError(c, appErr)
+			return
+		}
+		opts.ReadOnly = readOnly
+		opts.Authorize = func() (bool, error) {
+			readOnly, appErr := access()
+			if appErr != nil {
+				return false, appErr
+			}
+			return readOnly, nil
+		}
+
+		resume, err := websocket.ParseResume(c.Request.URL.Query())
+		if err != nil {
+			respondError(c, utils.NewValidationError("Invalid resume position", []utils.FieldError{
+				{Field: "since", Message: err.Error()},
+			}))
+			return
+		}
+		opts.Resume = resume
+		opts.Participant = h.participant(userID)
+
+		websocket.HandleWebSocket(hub, c.Writer, c.Request, projectID, opts)
+	}
+}
+
+// shareSocketAccess - 共有リンクで接続するクライアントの権限（閲覧用リンクは読み取り専用）
+// verified は照合済みのパスワードハッシュ。パスワードが変わらない限り bcrypt の照合を繰り返さない
+func (h *Handler) shareSocketAccess(token, projectID, password, userID string, verified *string) (bool, *utils.AppError) {
+	shareLink, appErr := h.ResolveShareLink(token)
+	if appErr != nil {
+		return false, appErr
+	}
+	restrictions := *shareLink
+	if restrictions.PasswordHash == *verified {
+		restrictions.PasswordHash = ""
+	}
+	if appErr := h.checkShareRestrictions(&restrictions, password, userID); appErr != nil {
+		return false, appErr
+	}
+	*verified = shareLink.PasswordHash
+	if shareLink.ProjectID != projectID {
+		return false, utils.NewForbiddenError("Share link is not valid for this project")
+	}
+	if err := h.db.Select("id").First(&database.Project{}, "id = ?", projectID).Error; err != nil {
+		return false, utils.NewNotFoundError("Project not found")
+	}
+	return shareLink.Permission != database.SharePermissionEdit, nil
+}
+
+// memberSocketAccess - ユーザーとして接続するクライアントの権限
+// 閲覧者・コメント投稿者と、公開プロジェクトを閲覧するだけのユーザーは読み取り専用
+func (h *Handler) memberSocketAccess(projectID, userID string) (bool, *utils.AppError) {
+	var project database.Project
+	if err := h.db.First(&project, "id = ?", projectID).Error; err != nil {
+		return false, utils.NewNotFoundError("Project not found")
+	}
+	member := h.findMembership(project.ID, userID)
+	if appErr := policy.Authorize(&project, userID, member, policy.ActionView); appErr != nil {
+		return false, appErr
+	}
+	return !policy.Can(policy.RoleOf(&project, userID, member), policy.ActionEdit), nil
+}
+
+// socketUser - WebSocket接続のユーザーID（ベアラートークン、なければクッキーで認証。どちらもなければ匿名）
+func (h *Handler) socketUser(c *gin.Context) (string, *utils.AppError) {
+	if userID := middleware.CurrentUserID(c); userID != "" {
+		return userID, nil
+	}
+
+	token := auth.SocketTokenFromRequest(c.Request)
+	if token == "" {
+		return "", nil
+	}
+	session, err := h.Auth().Authenticate(token)
+	if err != nil {
+		return "", utils.NewUnauthorizedError(err.Error())
+	}
+	return session.UserID, nil
+}
+
+// socketSharePassword - WebSocket接続で提示された共有リンクのパスワード（ヘッダー、なければクッキー）
+func socketSharePassword(c *gin.Context) string {
+	if password := c.GetHeader(SharePasswordHeader); password != "" {
+		return password
+	}
+	if cookie, err := c.Request.Cookie(SharePasswordCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// 共同編集者の表示色（ユーザーIDから決まる）
+var participantColors = []string{
+	"#E57373", "#F06292", "#BA68C8", "#7986CB", "#4FC3F7",
+	"#4DB6AC", "#81C784", "#FFB74D", "#A1887F", "#90A4AE",
+}
+
+// guestColor - ログインしていない参加者の表示色
+const guestColor = "#9E9E9E"
+
+// participant - 共同編集で他の参加者に表示する名前と色
+// 名前が未設定のユーザーはメールアドレスの@より前を表示する
+func (h *Handler) participant(userID string) websocket.Participant {
+	if userID == "" {
+		return websocket.Participant{Name: "Guest", Color: guestColor}
+	}
+
+	participant := websocket.Participant{UserID: userID, Name: "Guest"}
+	hash := fnv.New32a()
+	hash.Write([]byte(userID))
+	participant.Color = participantColors[hash.Sum32()%uint32(len(participantColors))]
+
+	var user database.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err == nil {
+		participant.Name = user.Name
+		if participant.Name == "" {
+			participant.Name, _, _ = strings.Cut(user.Email, "@")
+		}
+	}
+	return participant
+}
@@ -0,0 +1,323 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"thinking-blocks-backend/api"
+	"thinking-blocks-backend/auth"
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/websocket"
+
+	"github.com/gin-gonic/gin"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const allowedOrigin = "http://app.example"
+
+// setupSocketServer - 共同編集ハブとWebSocketのルートを持つテストサーバー
+func setupSocketServer(t *testing.T) (*gin.Engine, *api.Handler, *httptest.Server) {
+	router, handler := setupTestRouter()
+	setupShareRoutes(router, handler)
+	setupMemberRoutes(router, handler)
+
+	hub := websocket.NewHub(handler.DocumentStore(), config.CollaborationConfig{
+		AllowedOrigins: []string{allowedOrigin},
+		AccessInterval: 20 * time.Millisecond,
+	})
+	go hub.Run()
+	t.Cleanup(hub.Close)
+	router.GET("/ws/:projectId", handler.ProjectSocket(hub))
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return router, handler, server
+}
+
+// socketPeer - バッチで届いたフレームをメッセージに分けて読むWebSocketクライアント
+type socketPeer struct {
+	t       *testing.T
+	conn    *gorilla.Conn
+	pending []websocket.Message
+}
+
+func dialSocket(t *testing.T, server *httptest.Server, path string, header http.Header) (*socketPeer, int) {
+	t.Helper()
+	conn, resp, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+	if err != nil {
+		require.NotNil(t, resp, err.Error())
+		return nil, resp.StatusCode
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &socketPeer{t: t, conn: conn}, resp.StatusCode
+}
+
+func (p *socketPeer) next() websocket.Message {
+	p.t.Helper()
+	for len(p.pending) == 0 {
+		p.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, frame, err := p.conn.ReadMessage()
+		require.NoError(p.t, err)
+		for _, line := range bytes.Split(frame, []byte{'\n'}) {
+			var message websocket.Message
+			require.NoError(p.t, json.Unmarshal(line, &message))
+			p.pending = append(p.pending, message)
+		}
+	}
+	message := p.pending[0]
+	p.pending = p.pending[1:]
+	return message
+}
+
+func (p *socketPeer) send(message map[string]interface{}) {
+	p.t.Helper()
+	require.NoError(p.t, p.conn.WriteJSON(message))
+}
+
+func TestProjectSocketRequiresAccess(t *testing.T) {
+	router, handler, server := setupSocketServer(t)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Private Map",
+		"content": contentWithText("秘密"),
+	})
+	path := "/ws/" + projectID
+
+	_, status := dialSocket(t, server, path, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	stranger := http.Header{"Authorization": {"Bearer " + issueToken(t, handler, "stranger")}}
+	_, status = dialSocket(t, server, path, stranger)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	badCookie := http.Header{"Cookie": {auth.TokenCookie + "=not-a-token"}}
+	_, status = dialSocket(t, server, path, badCookie)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	_, status = dialSocket(t, server, "/ws/missing", http.Header{"Authorization": {"Bearer " + ownerToken}})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// 許可されていないオリジンからのブラウザ接続は拒否する
+	owner := http.Header{"Cookie": {auth.TokenCookie + "=" + ownerToken}, "Origin": {"http://evil.example"}}
+	_, status = dialSocket(t, server, path, owner)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	owner.Set("Origin", allowedOrigin)
+	conn, _ := dialSocket(t, server, path, owner)
+	require.NotNil(t, conn)
+	assert.Equal(t, websocket.TypeSnapshot, conn.next().Type)
+}
+
+func TestProjectSocketUsesAuthenticatedIdentity(t *testing.T) {
+	router, handler, server := setupSocketServer(t)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Team Map",
+		"content": contentWithText("共有"),
+	})
+	viewerToken, _ := addMember(t, router, handler, projectID, ownerToken, "viewer", "viewer")
+	path := "/ws/" + projectID
+
+	owner, _ := dialSocket(t, server, path, http.Header{"Authorization": {"Bearer " + ownerToken}})
+	require.NotNil(t, owner)
+	owner.next()
+	viewer, _ := dialSocket(t, server, path, http.Header{"Authorization": {"Bearer " + viewerToken}})
+	require.NotNil(t, viewer)
+	viewer.next()
+
+	joined := owner.next()
+	assert.Equal(t, websocket.TypeJoin, joined.Type)
+	viewerID := joined.UserID
+	assert.Contains(t, string(joined.Data), `"name":"viewer"`)
+
+	// 他のユーザーを名乗ったメッセージも接続したユーザーとして配信する
+	viewer.send(map[string]interface{}{"type": websocket.TypeSelect, "user_id": "owner", "data": map[string]string{"block_id": "b1"}})
+	selected := owner.next()
+	assert.Equal(t, websocket.TypeSelect, selected.Type)
+	assert.Equal(t, viewerID, selected.UserID)
+
+	// 閲覧者の編集とコメントは拒否する
+	viewer.send(map[string]interface{}{"type": websocket.TypeComment, "data": map[string]string{"text": "hi"}})
+	assert.Equal(t, websocket.TypeOpRejected, viewer.next().Type)
+	viewer.send(map[string]interface{}{
+		"type": websocket.TypeOp,
+		"data": map[string]interface{}{"op": "set_text", "block_id": "b1", "text": "改ざん", "client_op_id": "v1"},
+	})
+	rejected := viewer.next()
+	assert.Equal(t, websocket.TypeOpRejected, rejected.Type)
+	assert.Contains(t, string(rejected.Data), `"client_op_id":"v1"`)
+
+	owner.send(map[string]interface{}{
+		"type": websocket.TypeOp,
+		"data": map[string]interface{}{"op": "set_text", "block_id": "b1", "text": "更新"},
+	})
+	accepted := owner.next()
+	assert.Equal(t, websocket.TypeOp, accepted.Type)
+	assert.Equal(t, uint64(1), accepted.Seq)
+}
+
+func TestProjectSocketSharePasswordFromHeaderOrCookie(t *testing.T) {
+	router, handler, server := setupSocketServer(t)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Workshop Map",
+		"content": contentWithText("共有"),
+	})
+	shareToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{
+		"permission": "edit",
+		"password":   "open-sesame",
+	})
+	path := "/ws/" + projectID + "?share_token=" + shareToken
+
+	// ログに残るクエリのパスワードは受け付けない
+	_, status := dialSocket(t, server, path+"&share_password=open-sesame", nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	_, status = dialSocket(t, server, path, http.Header{api.SharePasswordHeader: {"wrong"}})
+	assert.Equal(t, http.StatusForbidden, status)
+
+	conn, _ := dialSocket(t, server, path, http.Header{api.SharePasswordHeader: {"open-sesame"}})
+	require.NotNil(t, conn)
+	assert.Equal(t, websocket.TypeSnapshot, conn.next().Type)
+
+	conn, _ = dialSocket(t, server, path, http.Header{"Cookie": {api.SharePasswordCookie + "=open-sesame"}})
+	require.NotNil(t, conn)
+	assert.Equal(t, websocket.TypeSnapshot, conn.next().Type)
+}
+
+func TestProjectSocketKeepsRESTUpdatesMadeDuringSession(t *testing.T) {
+	router, handler, server := setupSocketServer(t)
+	router.GET("/api/v1/projects/:id", handler.GetProject)
+	router.PUT("/api/v1/projects/:id", handler.UpdateProject)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Team Map",
+		"content": contentWithText("共有"),
+	})
+
+	owner, _ := dialSocket(t, server, "/ws/"+projectID, http.Header{"Authorization": {"Bearer " + ownerToken}})
+	require.NotNil(t, owner)
+	owner.next()
+	owner.send(map[string]interface{}{
+		"type": websocket.TypeOp,
+		"data": map[string]interface{}{"op": "set_text", "block_id": "b1", "text": "最新の共有"},
+	})
+	assert.Equal(t, uint64(1), owner.next().Seq)
+
+	// 共同編集中にREST APIで保存した変更
+	w := sendJSON(router, "PUT", "/api/v1/projects/"+projectID, ownerToken, map[string]interface{}{
+		"content": map[string]interface{}{
+			"thinking_structure": map[string]interface{}{
+				"blocks": []interface{}{
+					map[string]interface{}{"id": "b1", "type": "thinking_why", "text": "共有する"},
+					map[string]interface{}{"id": "b2", "type": "thinking_how", "text": "RESTで追加"},
+				},
+			},
+		},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// 最後の参加者が抜けて保存されても、REST APIの変更は上書きされずにマージされる
+	owner.conn.Close()
+	assert.Eventually(t, func() bool {
+		w := sendJSON(router, "GET", "/api/v1/projects/"+projectID, ownerToken, nil)
+		var response struct {
+			Data struct {
+				Content json.RawMessage `json:"content"`
+				Version int             `json:"version"`
+			} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		var content []byte
+		json.Unmarshal(response.Data.Content, &content)
+		return response.Data.Version == 3 &&
+			strings.Contains(string(content), `"text":"最新の共有する"`) &&
+			strings.Contains(string(content), `"text":"RESTで追加"`)
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+// closed - サーバーが接続を閉じるまで読み進め、閉じる前に届いたメッセージの種類を返す
+func (p *socketPeer) closed() []string {
+	p.t.Helper()
+	var types []string
+	for _, message := range p.pending {
+		types = append(types, message.Type)
+	}
+	p.pending = nil
+	for {
+		p.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, frame, err := p.conn.ReadMessage()
+		if err != nil {
+			require.True(p.t, gorilla.IsCloseError(err, gorilla.CloseNoStatusReceived), err.Error())
+			return types
+		}
+		for _, line := range bytes.Split(frame, []byte{'\n'}) {
+			var message websocket.Message
+			require.NoError(p.t, json.Unmarshal(line, &message))
+			types = append(types, message.Type)
+		}
+	}
+}
+
+func TestProjectSocketFollowsRevokedAccess(t *testing.T) {
+	router, handler, server := setupSocketServer(t)
+
+	ownerToken := issueToken(t, handler, "owner")
+	projectID := createTestProject(t, router, ownerToken, map[string]interface{}{
+		"title":   "Team Map",
+		"content": contentWithText("共有"),
+	})
+	editorToken, memberID := addMember(t, router, handler, projectID, ownerToken, "editor", "editor")
+	shareToken := createShareLink(t, router, ownerToken, projectID, map[string]interface{}{"permission": "edit"})
+	sharePath := "/api/v1/projects/" + projectID + "/share"
+	w := sendJSON(router, "GET", sharePath, ownerToken, nil)
+	var links map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &links)
+	linkID := links["data"].([]interface{})[0].(map[string]interface{})["id"].(string)
+
+	path := "/ws/" + projectID
+	editor, _ := dialSocket(t, server, path, http.Header{"Authorization": {"Bearer " + editorToken}})
+	require.NotNil(t, editor)
+	editor.next()
+	guest, _ := dialSocket(t, server, path+"?share_token="+shareToken, nil)
+	require.NotNil(t, guest)
+	guest.next()
+
+	// 共有リンクを閲覧用に変えると、接続中のクライアントも読み取り専用になる
+	w = sendJSON(router, "PATCH", sharePath+"/"+linkID, ownerToken, map[string]interface{}{"permission": "view"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Eventually(t, func() bool {
+		guest.send(map[string]interface{}{
+			"type": websocket.TypeOp,
+			"data": map[string]interface{}{"op": "move", "block_id": "b1", "position": map[string]float64{"x": 1, "y": 1}},
+		})
+		for {
+			switch guest.next().Type {
+			case websocket.TypeOpRejected:
+				return true
+			case websocket.TypeOp:
+				return false
+			}
+		}
+	}, 2*time.Second, 50*time.Millisecond)
+
+	// 共有リンクの削除とメンバーからの除外で接続を切る
+	w = sendJSON(router, "DELETE", sharePath+"/"+linkID, ownerToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, guest.closed(), websocket.TypeError)
+
+	w = sendJSON(router, "DELETE", "/api/v1/projects/"+projectID+"/members/"+memberID, ownerToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, editor.closed(), websocket.TypeError)
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"thinking-blocks-backend/database"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrSessionRevoked = errors.New("session has been revoked")
+	ErrSessionExpired = errors.New("session has expired")
+)
+
+// Manager - セッショントークンの発行・検証・失効を管理
+type Manager struct {
+	db     *gorm.DB
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewManager(db *gorm.DB, secret string, ttl time.Duration) *Manager {
+	return &Manager{
+		db:     db,
+		secret: []byte(secret),
+		ttl:    ttl,
+	}
+}
+
+// Issue - セッションを作成し、署名付きトークンを発行
+func (m *Manager) Issue(userID string) (string, *database.Session, error) {
+	now := time.Now()
+	session := database.Session{
+		UserID:    userID,
+		ExpiresAt: now.Add(m.ttl),
+	}
+	if err := m.db.Create(&session).Error; err != nil {
+		return "", nil, err
+	}
+
+	claims := jwt.RegisteredClaims{
+		ID:        session.ID,
+		Subject:   userID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &session, nil
+}
+
+// Authenticate - トークンを検証し、有効なセッションを返す
+func (m *Manager) Authenticate(tokenString string) (*database.Session, error) {
+	if tokenString == "" {
+		return nil, ErrInvalidToken
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrSessionExpired
+		}
+		return nil, ErrInvalidToken
+	}
+
+	var session database.Session
+	if err := m.db.First(&session, "id = ?", claims.ID).Error; err != nil {
+		return nil, ErrInvalidToken
+	}
+	if session.UserID != claims.Subject {
+		return nil, ErrInvalidToken
+	}
+	if session.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+	if session.ExpiresAt.Before(time.Now()) {
+		return nil, ErrSessionExpired
+	}
+
+	return &session, nil
+}
+
+// Revoke - セッションを失効させる
+func (m *Manager) Revoke(sessionID string) error {
+	return m.db.Model(&database.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// TokenFromRequest - Authorizationヘッダーからベアラートークンを取り出す
+func TokenFromRequest(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// TokenCookie - ブラウザのWebSocket接続でトークンを送るクッキー
+// ブラウザはWebSocketの接続時にヘッダーを設定できないため、接続時に限りクッキーも受け付ける
+const TokenCookie = "thinking_blocks_token"
+
+// SocketTokenFromRequest - WebSocket接続のトークン（ベアラートークン、なければクッキー）
+func SocketTokenFromRequest(r *http.Request) string {
+	if token := TokenFromRequest(r); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(TokenCookie); err == nil {
+		return strings.TrimSpace(cookie.Value)
+	}
+	return ""
+}
@@ -1,22 +1,88 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Config struct {
-	DatabaseURL string
-	RedisURL    string
-	JWTSecret   string
-	Port        string
-	Environment string
+	DatabaseURL   string
+	RedisURL      string
+	JWTSecret     string
+	SessionTTL    time.Duration
+	RevisionLimit int // プロジェクトごとに保持するリビジョン数（0は無制限）
+	Port          string
+	Environment   string
+	AI            AIConfig
+	Analytics     AnalyticsConfig
+	Collaboration CollaborationConfig
+}
+
+// CollaborationConfig - WebSocketによる共同編集の設定
+type CollaborationConfig struct {
+	PersistInterval time.Duration // 編集中のドキュメントを保存する間隔
+	OpLogSize       int           // 再接続時の差分送信に使う、プロジェクトごとに保持する直近の操作数
+	CursorInterval  time.Duration // クライアントごとにカーソル位置を配信する最短の間隔
+	AccessInterval  time.Duration // 接続中のクライアントの権限を確認し直す間隔（0は確認しない）
+	AllowedOrigins  []string      // 接続を許可するブラウザのオリジン（"*" はすべて）
+}
+
+// AnalyticsConfig - アナリティクスイベントの書き込み・集計・保持期間の設定
+// Retention が0の場合、生イベントを削除しない
+type AnalyticsConfig struct {
+	BufferSize          int
+	BatchSize           int
+	FlushInterval       time.Duration
+	Retention           time.Duration
+	MaintenanceInterval time.Duration
+}
+
+// AIConfig - 思考分析プロバイダーの設定
+// Provider が "http" の場合は Endpoint のLLM APIを呼び出し、それ以外はルールベースで分析する
+type AIConfig struct {
+	Provider     string
+	Endpoint     string
+	APIKey       string
+	Model        string
+	Timeout      time.Duration
+	MaxRetries   int
+	RetryBackoff time.Duration
 }
 
 func Load() *Config {
 	return &Config{
-		DatabaseURL: getEnv("DATABASE_URL", "postgres://localhost/thinking_blocks?sslmode=disable"),
-		RedisURL:    getEnv("REDIS_URL", "localhost:6379"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		Port:        getEnv("PORT", "8080"),
-		Environment: getEnv("ENVIRONMENT", "development"),
+		DatabaseURL:   getEnv("DATABASE_URL", "postgres://localhost/thinking_blocks?sslmode=disable"),
+		RedisURL:      getEnv("REDIS_URL", "localhost:6379"),
+		JWTSecret:     getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		SessionTTL:    getEnvDuration("SESSION_TTL", 7*24*time.Hour),
+		RevisionLimit: getEnvInt("REVISION_LIMIT", 100),
+		Port:          getEnv("PORT", "8080"),
+		Environment:   getEnv("ENVIRONMENT", "development"),
+		AI: AIConfig{
+			Provider:     getEnv("AI_PROVIDER", "rule"),
+			Endpoint:     getEnv("AI_ENDPOINT", "https://api.openai.com/v1/chat/completions"),
+			APIKey:       getEnv("AI_API_KEY", ""),
+			Model:        getEnv("AI_MODEL", "gpt-4o-mini"),
+			Timeout:      getEnvDuration("AI_TIMEOUT", 15*time.Second),
+			MaxRetries:   getEnvInt("AI_MAX_RETRIES", 2),
+			RetryBackoff: getEnvDuration("AI_RETRY_BACKOFF", 500*time.Millisecond),
+		},
+		Analytics: AnalyticsConfig{
+			BufferSize:          getEnvInt("ANALYTICS_BUFFER_SIZE", 10000),
+			BatchSize:           getEnvInt("ANALYTICS_BATCH_SIZE", 500),
+			FlushInterval:       getEnvDuration("ANALYTICS_FLUSH_INTERVAL", 2*time.Second),
+			Retention:           getEnvDuration("ANALYTICS_RETENTION", 90*24*time.Hour),
+			MaintenanceInterval: getEnvDuration("ANALYTICS_MAINTENANCE_INTERVAL", time.Hour),
+		},
+		Collaboration: CollaborationConfig{
+			PersistInterval: getEnvDuration("COLLAB_PERSIST_INTERVAL", 5*time.Second),
+			OpLogSize:       getEnvInt("COLLAB_OP_LOG_SIZE", 1000),
+			CursorInterval:  getEnvDuration("COLLAB_CURSOR_INTERVAL", 50*time.Millisecond),
+			AccessInterval:  getEnvDuration("COLLAB_ACCESS_INTERVAL", 10*time.Second),
+			AllowedOrigins:  getEnvList("COLLAB_ALLOWED_ORIGINS", []string{"http://localhost:3000"}),
+		},
 	}
 }
 
@@ -26,3 +92,36 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList - カンマ区切りの値を読み込む（空の要素は無視）
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
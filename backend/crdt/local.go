@@ -0,0 +1,136 @@
+package crdt
+
+import (
+	"thinking-blocks-backend/thinking"
+)
+
+// local - このレプリカで発生した編集を操作に変換して適用する
+// 返した操作を他のレプリカに配信すると、同じ編集が取り込まれる
+func (r *Replica) local(op Op) Op {
+	op.ID = ID{Counter: r.clock + 1, Replica: r.id}
+	// 自分で組み立てた操作は常に妥当で、依存する文字も手元にある
+	_ = r.Apply(op)
+	return op
+}
+
+// Load - ドキュメントの内容をこのレプリカの操作として取り込む
+func (r *Replica) Load(doc *thinking.Document) []Op {
+	var ops []Op
+	for _, block := range doc.Blocks() {
+		ops = append(ops, r.CreateBlock(block)...)
+	}
+	return ops
+}
+
+// CreateBlock - ブロックを作成（テキストと接続も含む）
+func (r *Replica) CreateBlock(block thinking.Block) []Op {
+	position := block.Position
+	ops := []Op{r.local(Op{
+		Kind:     KindCreate,
+		Block:    block.ID,
+		Type:     block.Type,
+		Position: &position,
+		Parent:   block.Parent,
+		Depth:    block.Depth,
+	})}
+	if block.Text != "" {
+		ops = append(ops, r.local(Op{Kind: KindInsertText, Block: block.ID, Text: block.Text}))
+	}
+	for _, target := range block.Connections {
+		ops = append(ops, r.Connect(block.ID, target))
+	}
+	return ops
+}
+
+// DeleteBlock - ブロックを削除
+func (r *Replica) DeleteBlock(blockID string) Op {
+	return r.local(Op{Kind: KindDelete, Block: blockID})
+}
+
+// SetType - ブロックの種類を変更
+func (r *Replica) SetType(blockID, blockType string) Op {
+	return r.local(Op{Kind: KindSetType, Block: blockID, Type: blockType})
+}
+
+// Move - ブロックを移動
+func (r *Replica) Move(blockID string, position thinking.Position) Op {
+	return r.local(Op{Kind: KindMove, Block: blockID, Position: &position})
+}
+
+// SetParent - 親ブロックを変更（空はルートに戻す）
+func (r *Replica) SetParent(blockID, parent string) Op {
+	return r.local(Op{Kind: KindSetParent, Block: blockID, Parent: parent})
+}
+
+// Connect - 接続を追加
+func (r *Replica) Connect(blockID, target string) Op {
+	return r.local(Op{Kind: KindConnect, Block: blockID, Target: target})
+}
+
+// Disconnect - 接続を削除
+func (r *Replica) Disconnect(blockID, target string) Op {
+	return r.local(Op{Kind: KindDisconnect, Block: blockID, Target: target})
+}
+
+// EditText - テキストを text に書き換える
+// seen は編集者が観測していた操作（nil はすべて）。編集者が見ていたテキストとの差分だけを
+// 挿入と削除にするので、編集者が観測していない同時編集は失われない
+func (r *Replica) EditText(blockID, text string, seen func(ID) bool) []Op {
+	edit := r.textEdit(blockID, text, seen)
+
+	var ops []Op
+	if len(edit.removed) > 0 {
+		elements := make([]ID, len(edit.removed))
+		for i, e := range edit.removed {
+			elements[i] = e.id
+		}
+		ops = append(ops, r.local(Op{Kind: KindDeleteText, Block: blockID, Elements: elements}))
+	}
+	if len(edit.inserted) > 0 {
+		ops = append(ops, r.local(Op{Kind: KindInsertText, Block: blockID, After: edit.after, Text: string(edit.inserted)}))
+	}
+	return ops
+}
+
+// TextLength - EditText で書き換えた後のテキストの文字数（レプリカは変更しない）
+func (r *Replica) TextLength(blockID, text string, seen func(ID) bool) int {
+	edit := r.textEdit(blockID, text, seen)
+	length := len([]rune(r.Text(blockID))) + len(edit.inserted)
+	for _, e := range edit.removed {
+		if len(e.deletedBy) == 0 {
+			length--
+		}
+	}
+	return length
+}
+
+// textEdit - 編集者が見ていたテキストから text への書き換え
+type textEdit struct {
+	removed  []*element
+	after    ID // 挿入位置の直前の文字（ゼロは先頭）
+	inserted []rune
+}
+
+func (r *Replica) textEdit(blockID, text string, seen func(ID) bool) textEdit {
+	var base []*element
+	if b, ok := r.blocks[blockID]; ok {
+		base = b.visibleText(seen)
+	}
+	next := []rune(text)
+
+	prefix := 0
+	for prefix < len(base) && prefix < len(next) && base[prefix].char == next[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(base)-prefix && suffix < len(next)-prefix &&
+		base[len(base)-1-suffix].char == next[len(next)-1-suffix] {
+		suffix++
+	}
+
+	edit := textEdit{removed: base[prefix : len(base)-suffix], inserted: next[prefix : len(next)-suffix]}
+	if prefix > 0 {
+		edit.after = base[prefix-1].id
+	}
+	return edit
+}
@@ -0,0 +1,441 @@
+// Package crdt - 思考ブロックの木を複数のレプリカで同時に編集するためのCRDT
+//
+// ブロックの存在は削除優先（一度削除したIDは復活しない）、種類・位置・親は
+// Lamportタイムスタンプによる後勝ちのレジスタ、テキストはRGA、接続は後勝ちの集合で表す。
+// 同じ操作の集合を受け取ったレプリカは、受け取った順序によらず同じドキュメントになる。
+package crdt
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"unicode/utf8"
+
+	"thinking-blocks-backend/thinking"
+)
+
+// ID - Lamportタイムスタンプ。操作とテキストの1文字を一意に識別する
+type ID struct {
+	Counter uint64 `json:"counter"`
+	Replica string `json:"replica"`
+}
+
+// Less - カウンタ、同じならレプリカIDで比較した全順序
+func (id ID) Less(other ID) bool {
+	if id.Counter != other.Counter {
+		return id.Counter < other.Counter
+	}
+	return id.Replica < other.Replica
+}
+
+// IsZero - テキストの先頭を表すゼロ値か
+func (id ID) IsZero() bool {
+	return id == ID{}
+}
+
+// 操作の種類
+const (
+	KindCreate     = "create"
+	KindDelete     = "delete"
+	KindSetType    = "set_type"
+	KindMove       = "move"
+	KindSetParent  = "set_parent"
+	KindInsertText = "insert_text"
+	KindDeleteText = "delete_text"
+	KindConnect    = "connect"
+	KindDisconnect = "disconnect"
+)
+
+// Op - レプリカ間で交換する操作
+type Op struct {
+	ID    ID     `json:"id"`
+	Kind  string `json:"kind"`
+	Block string `json:"block"`
+
+	// create, set_type
+	Type string `json:"type,omitempty"`
+	// create, move
+	Position *thinking.Position `json:"position,omitempty"`
+	// create, set_parent（空はルート）
+	Parent string `json:"parent,omitempty"`
+	// create
+	Depth int `json:"depth,omitempty"`
+	// connect, disconnect
+	Target string `json:"target,omitempty"`
+
+	// insert_text - After の文字の直後に Text を挿入する（ゼロ値は先頭）
+	// 挿入した文字には ID から順に連続したカウンタを割り当てる
+	After ID     `json:"after"`
+	Text  string `json:"text,omitempty"`
+	// delete_text - 削除する文字
+	Elements []ID `json:"elements,omitempty"`
+}
+
+// span - 操作が消費するカウンタの数
+func (op Op) span() uint64 {
+	if op.Kind == KindInsertText {
+		return uint64(utf8.RuneCountInString(op.Text))
+	}
+	return 1
+}
+
+func (op Op) validate() error {
+	if op.ID.Counter == 0 {
+		return errors.New("op id is required")
+	}
+	if op.Block == "" {
+		return errors.New("block is required")
+	}
+	switch op.Kind {
+	case KindCreate, KindDelete, KindSetType, KindMove, KindSetParent:
+	case KindInsertText:
+		if op.Text == "" {
+			return errors.New("text is required")
+		}
+	case KindDeleteText:
+		if len(op.Elements) == 0 {
+			return errors.New("elements are required")
+		}
+	case KindConnect, KindDisconnect:
+		if op.Target == "" {
+			return errors.New("target is required")
+		}
+	default:
+		return errors.New("unknown op kind " + op.Kind)
+	}
+	return nil
+}
+
+// register - 後勝ちのレジスタ（タイムスタンプが大きい書き込みが勝つ）
+type register[T any] struct {
+	value T
+	stamp ID
+}
+
+func (r *register[T]) set(value T, stamp ID) {
+	if r.stamp.Less(stamp) {
+		r.value = value
+		r.stamp = stamp
+	}
+}
+
+// element - テキストの1文字
+type element struct {
+	id        ID
+	op        ID // 挿入した操作
+	char      rune
+	deletedBy []ID
+}
+
+type blockState struct {
+	created     ID // 最初の create。ゼロなら未作成
+	deleted     bool
+	typ         register[string]
+	position    register[thinking.Position]
+	parent      register[string]
+	depth       register[int]
+	text        []*element
+	connections map[string]*register[bool]
+}
+
+// Replica - 1つのドキュメントのレプリカ
+type Replica struct {
+	id       string
+	clock    uint64
+	blocks   map[string]*blockState
+	elements map[ID]string // 文字のIDからブロックID
+	applied  map[ID]bool
+	pending  []Op // 依存する文字が未着の操作
+}
+
+// NewReplica - 空のレプリカを作成。id はレプリカ間で一意であること
+func NewReplica(id string) *Replica {
+	return &Replica{
+		id:       id,
+		blocks:   make(map[string]*blockState),
+		elements: make(map[ID]string),
+		applied:  make(map[ID]bool),
+	}
+}
+
+// Clock - 観測した最大のカウンタ
+func (r *Replica) Clock() uint64 {
+	return r.clock
+}
+
+// Pending - 依存する操作の到着を待っている操作の数
+func (r *Replica) Pending() int {
+	return len(r.pending)
+}
+
+// Exists - ブロックが作成済みで削除されていないか
+func (r *Replica) Exists(blockID string) bool {
+	b, ok := r.blocks[blockID]
+	return ok && !b.created.IsZero() && !b.deleted
+}
+
+// Deleted - ブロックが削除済みか（削除したIDは再利用できない）
+func (r *Replica) Deleted(blockID string) bool {
+	b, ok := r.blocks[blockID]
+	return ok && b.deleted
+}
+
+// Parent - ブロックの親（未設定か削除済みの親は空）
+func (r *Replica) Parent(blockID string) string {
+	b, ok := r.blocks[blockID]
+	if !ok || b.parent.value == blockID || !r.Exists(b.parent.value) {
+		return ""
+	}
+	return b.parent.value
+}
+
+// Text - ブロックの現在のテキスト
+func (r *Replica) Text(blockID string) string {
+	b, ok := r.blocks[blockID]
+	if !ok {
+		return ""
+	}
+	var text []rune
+	for _, e := range b.visibleText(nil) {
+		text = append(text, e.char)
+	}
+	return string(text)
+}
+
+// Apply - 他のレプリカの操作を取り込む
+// 同じ操作の再適用は無視し、依存する文字が未着の操作は到着まで保留する
+func (r *Replica) Apply(op Op) error {
+	if err := op.validate(); err != nil {
+		return err
+	}
+	if end := op.ID.Counter + op.span() - 1; end > r.clock {
+		r.clock = end
+	}
+	if r.applied[op.ID] {
+		return nil
+	}
+	if !r.ready(op) {
+		r.pending = append(r.pending, op)
+		return nil
+	}
+	r.integrate(op)
+
+	// 保留中の操作を適用できなくなるまで取り込む
+	for progress := true; progress; {
+		progress = false
+		kept := r.pending[:0]
+		for _, p := range r.pending {
+			switch {
+			case r.applied[p.ID]:
+			case r.ready(p):
+				r.integrate(p)
+				progress = true
+			default:
+				kept = append(kept, p)
+			}
+		}
+		r.pending = kept
+	}
+	return nil
+}
+
+func (r *Replica) ready(op Op) bool {
+	switch op.Kind {
+	case KindInsertText:
+		return op.After.IsZero() || r.elements[op.After] == op.Block
+	case KindDeleteText:
+		for _, id := range op.Elements {
+			if r.elements[id] != op.Block {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r *Replica) block(id string) *blockState {
+	b, ok := r.blocks[id]
+	if !ok {
+		b = &blockState{connections: make(map[string]*register[bool])}
+		r.blocks[id] = b
+	}
+	return b
+}
+
+func (r *Replica) integrate(op Op) {
+	r.applied[op.ID] = true
+	b := r.block(op.Block)
+
+	switch op.Kind {
+	case KindCreate:
+		if b.created.IsZero() || op.ID.Less(b.created) {
+			b.created = op.ID
+		}
+		var position thinking.Position
+		if op.Position != nil {
+			position = *op.Position
+		}
+		b.typ.set(op.Type, op.ID)
+		b.position.set(position, op.ID)
+		b.parent.set(op.Parent, op.ID)
+		b.depth.set(op.Depth, op.ID)
+	case KindDelete:
+		b.deleted = true
+	case KindSetType:
+		b.typ.set(op.Type, op.ID)
+	case KindMove:
+		if op.Position != nil {
+			b.position.set(*op.Position, op.ID)
+		}
+	case KindSetParent:
+		b.parent.set(op.Parent, op.ID)
+	case KindInsertText:
+		after := op.After
+		counter := op.ID.Counter
+		for _, char := range op.Text {
+			e := &element{id: ID{Counter: counter, Replica: op.ID.Replica}, op: op.ID, char: char}
+			b.insert(after, e)
+			r.elements[e.id] = op.Block
+			after = e.id
+			counter++
+		}
+	case KindDeleteText:
+		for _, id := range op.Elements {
+			if e := b.element(id); e != nil {
+				e.deletedBy = append(e.deletedBy, op.ID)
+			}
+		}
+	case KindConnect, KindDisconnect:
+		c, ok := b.connections[op.Target]
+		if !ok {
+			c = &register[bool]{}
+			b.connections[op.Target] = c
+		}
+		c.set(op.Kind == KindConnect, op.ID)
+	}
+}
+
+// insert - RGA の挿入。after の直後から、より新しい文字を読み飛ばした位置に置く
+func (b *blockState) insert(after ID, e *element) {
+	i := 0
+	if !after.IsZero() {
+		i = slices.IndexFunc(b.text, func(x *element) bool { return x.id == after }) + 1
+	}
+	for i < len(b.text) && e.id.Less(b.text[i].id) {
+		i++
+	}
+	b.text = slices.Insert(b.text, i, e)
+}
+
+func (b *blockState) element(id ID) *element {
+	for _, e := range b.text {
+		if e.id == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// visibleText - seen が観測した操作だけを見たときのテキスト（nil はすべて観測済み）
+func (b *blockState) visibleText(seen func(ID) bool) []*element {
+	var visible []*element
+	for _, e := range b.text {
+		if seen != nil && !seen(e.op) {
+			continue
+		}
+		deleted := false
+		for _, d := range e.deletedBy {
+			if seen == nil || seen(d) {
+				deleted = true
+				break
+			}
+		}
+		if !deleted {
+			visible = append(visible, e)
+		}
+	}
+	return visible
+}
+
+// Document - 現在の状態をドキュメントとして取り出す
+// ブロックは作成順、接続は接続した順に並べる。削除済みのブロックへの親と接続は外し、
+// 親の循環は循環内で最も新しい親の変更を外して解消する
+func (r *Replica) Document() *thinking.Document {
+	ids := make([]string, 0, len(r.blocks))
+	for id := range r.blocks {
+		if r.Exists(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return r.blocks[ids[i]].created.Less(r.blocks[ids[j]].created)
+	})
+
+	parents := make(map[string]string)
+	for _, id := range ids {
+		if parent := r.blocks[id].parent.value; parent != id && r.Exists(parent) {
+			parents[id] = parent
+		}
+	}
+	r.breakCycles(ids, parents)
+
+	blocks := make([]thinking.Block, 0, len(ids))
+	for _, id := range ids {
+		b := r.blocks[id]
+		blocks = append(blocks, thinking.Block{
+			ID:          id,
+			Type:        b.typ.value,
+			Text:        r.Text(id),
+			Position:    b.position.value,
+			Connections: r.connections(id, b),
+			Parent:      parents[id],
+			Depth:       b.depth.value,
+		})
+	}
+	return &thinking.Document{ThinkingStructure: thinking.Structure{Blocks: blocks}}
+}
+
+func (r *Replica) connections(id string, b *blockState) []string {
+	var targets []string
+	for target, c := range b.connections {
+		if c.value && target != id && r.Exists(target) {
+			targets = append(targets, target)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return b.connections[targets[i]].stamp.Less(b.connections[targets[j]].stamp)
+	})
+	return targets
+}
+
+func (r *Replica) breakCycles(ids []string, parents map[string]string) {
+	for _, start := range ids {
+		for {
+			cycle := findCycle(parents, start)
+			if cycle == nil {
+				break
+			}
+			newest := cycle[0]
+			for _, id := range cycle[1:] {
+				if r.blocks[newest].parent.stamp.Less(r.blocks[id].parent.stamp) {
+					newest = id
+				}
+			}
+			delete(parents, newest)
+		}
+	}
+}
+
+// findCycle - start から親をたどって見つかった循環のブロック
+func findCycle(parents map[string]string, start string) []string {
+	position := map[string]int{}
+	var path []string
+	for current, ok := start, true; ok; current, ok = parents[current] {
+		if i, seen := position[current]; seen {
+			return path[i:]
+		}
+		position[current] = len(path)
+		path = append(path, current)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package crdt_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"thinking-blocks-backend/crdt"
+	"thinking-blocks-backend/thinking"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func applyAll(t testing.TB, r *crdt.Replica, ops []crdt.Op) {
+	for _, op := range ops {
+		require.NoError(t, r.Apply(op))
+	}
+}
+
+func block(t *testing.T, r *crdt.Replica, id string) thinking.Block {
+	b, ok := r.Document().Block(id)
+	require.True(t, ok, id)
+	return *b
+}
+
+func TestConcurrentTextEditsAreMerged(t *testing.T) {
+	alice := crdt.NewReplica("alice")
+	bob := crdt.NewReplica("bob")
+	applyAll(t, bob, alice.CreateBlock(thinking.Block{ID: "a", Type: thinking.TypeWhy, Text: "なぜ考える"}))
+
+	fromAlice := alice.EditText("a", "なぜ深く考える", nil)
+	fromBob := bob.EditText("a", "なぜ考えるのか", nil)
+	applyAll(t, alice, fromBob)
+	applyAll(t, bob, fromAlice)
+
+	assert.Equal(t, "なぜ深く考えるのか", block(t, alice, "a").Text)
+	assert.Equal(t, alice.Document(), bob.Document())
+}
+
+func TestEditTextAgainstEarlierView(t *testing.T) {
+	r := crdt.NewReplica("hub")
+	r.CreateBlock(thinking.Block{ID: "a", Type: thinking.TypeWhy, Text: "abc"})
+	seenUpTo := r.Clock()
+	r.EditText("a", "abcd", nil)
+
+	// 末尾の d を観測していない編集者の変更は d を消さない
+	r.EditText("a", "xbc", func(id crdt.ID) bool { return id.Counter <= seenUpTo })
+	assert.Equal(t, "xbcd", block(t, r, "a").Text)
+}
+
+func TestDeleteWinsOverConcurrentEdits(t *testing.T) {
+	alice := crdt.NewReplica("alice")
+	bob := crdt.NewReplica("bob")
+	applyAll(t, bob, alice.CreateBlock(thinking.Block{ID: "a", Type: thinking.TypeWhy}))
+	applyAll(t, bob, alice.CreateBlock(thinking.Block{ID: "b", Type: thinking.TypeHow}))
+
+	fromAlice := []crdt.Op{alice.DeleteBlock("a")}
+	fromBob := append(bob.EditText("a", "残したい", nil), bob.Connect("b", "a"), bob.SetParent("b", "a"))
+	applyAll(t, alice, fromBob)
+	applyAll(t, bob, fromAlice)
+
+	doc := bob.Document()
+	assert.Equal(t, alice.Document(), doc)
+	require.Len(t, doc.Blocks(), 1)
+	assert.Empty(t, doc.Blocks()[0].Connections)
+	assert.Empty(t, doc.Blocks()[0].Parent)
+	assert.False(t, bob.Exists("a"))
+	assert.True(t, bob.Deleted("a"))
+}
+
+func TestConcurrentReparentingBreaksCycles(t *testing.T) {
+	alice := crdt.NewReplica("alice")
+	bob := crdt.NewReplica("bob")
+	applyAll(t, bob, alice.CreateBlock(thinking.Block{ID: "a", Type: thinking.TypeWhy}))
+	applyAll(t, bob, alice.CreateBlock(thinking.Block{ID: "b", Type: thinking.TypeHow}))
+
+	// 同時に互いを親にすると循環するので、新しい方の変更を外す
+	fromAlice := alice.SetParent("a", "b")
+	fromBob := bob.SetParent("b", "a")
+	applyAll(t, alice, []crdt.Op{fromBob})
+	applyAll(t, bob, []crdt.Op{fromAlice})
+
+	doc := alice.Document()
+	assert.Equal(t, bob.Document(), doc)
+	assert.Nil(t, doc.Validate())
+	assert.Equal(t, "b", block(t, alice, "a").Parent)
+	assert.Empty(t, block(t, alice, "b").Parent)
+}
+
+func TestApplyBuffersOpsUntilDependenciesArrive(t *testing.T) {
+	source := crdt.NewReplica("alice")
+	ops := source.CreateBlock(thinking.Block{ID: "a", Type: thinking.TypeWhy, Text: "ab"})
+	ops = append(ops, source.EditText("a", "abc", nil)...)
+	ops = append(ops, source.EditText("a", "c", nil)...)
+
+	r := crdt.NewReplica("bob")
+	for i := len(ops) - 1; i >= 0; i-- {
+		require.NoError(t, r.Apply(ops[i]))
+	}
+	applyAll(t, r, ops) // 重複して届いても変わらない
+
+	assert.Zero(t, r.Pending())
+	assert.Equal(t, source.Document(), r.Document())
+	assert.Equal(t, "c", block(t, r, "a").Text)
+}
+
+func TestApplyRejectsMalformedOps(t *testing.T) {
+	r := crdt.NewReplica("bob")
+	assert.Error(t, r.Apply(crdt.Op{Kind: crdt.KindMove, Block: "a"}))
+	assert.Error(t, r.Apply(crdt.Op{ID: crdt.ID{Counter: 1, Replica: "x"}, Kind: "rotate", Block: "a"}))
+	assert.Error(t, r.Apply(crdt.Op{ID: crdt.ID{Counter: 1, Replica: "x"}, Kind: crdt.KindConnect, Block: "a"}))
+}
+
+var fuzzTypes = []string{thinking.TypeWhy, thinking.TypeHow, thinking.TypeWhat, thinking.TypeReflect}
+
+// randomEdit - レプリカの現在の状態に対してランダムな編集を1つ行う
+func randomEdit(rng *rand.Rand, r *crdt.Replica, nextID *int) []crdt.Op {
+	blocks := r.Document().Blocks()
+	if len(blocks) == 0 || rng.Intn(5) == 0 {
+		*nextID++
+		return r.CreateBlock(thinking.Block{
+			ID:       fmt.Sprintf("b%d", *nextID),
+			Type:     fuzzTypes[rng.Intn(len(fuzzTypes))],
+			Text:     randomText(rng, 3),
+			Position: thinking.Position{X: float64(rng.Intn(100)), Y: float64(rng.Intn(100))},
+		})
+	}
+
+	b := blocks[rng.Intn(len(blocks))]
+	other := blocks[rng.Intn(len(blocks))].ID
+	switch rng.Intn(8) {
+	case 0:
+		return []crdt.Op{r.DeleteBlock(b.ID)}
+	case 1:
+		return []crdt.Op{r.Move(b.ID, thinking.Position{X: float64(rng.Intn(100)), Y: float64(rng.Intn(100))})}
+	case 2:
+		return []crdt.Op{r.SetType(b.ID, fuzzTypes[rng.Intn(len(fuzzTypes))])}
+	case 3:
+		return []crdt.Op{r.SetParent(b.ID, other)}
+	case 4:
+		return []crdt.Op{r.Connect(b.ID, other)}
+	case 5:
+		return []crdt.Op{r.Disconnect(b.ID, other)}
+	default:
+		text := []rune(b.Text)
+		at := rng.Intn(len(text) + 1)
+		end := at + rng.Intn(len(text)-at+1)
+		edited := string(text[:at]) + randomText(rng, 3) + string(text[end:])
+		return r.EditText(b.ID, edited, nil)
+	}
+}
+
+func randomText(rng *rand.Rand, max int) string {
+	letters := []rune("abcあいう")
+	text := make([]rune, rng.Intn(max+1))
+	for i := range text {
+		text[i] = letters[rng.Intn(len(letters))]
+	}
+	return string(text)
+}
+
+// checkConvergence - 複数のレプリカが部分的に同期しながら編集した後、
+// 残りの操作をレプリカごとに異なる順序で配信しても同じドキュメントになることを確認する
+func checkConvergence(t *testing.T, seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	replicas := []*crdt.Replica{crdt.NewReplica("r0"), crdt.NewReplica("r1"), crdt.NewReplica("r2")}
+	var log []crdt.Op
+	nextID := 0
+
+	for step := 0; step < 60; step++ {
+		r := replicas[rng.Intn(len(replicas))]
+		if rng.Intn(4) == 0 {
+			// 他のレプリカの操作の一部を任意の順序で受け取る
+			for _, i := range rng.Perm(len(log)) {
+				if rng.Intn(2) == 0 {
+					require.NoError(t, r.Apply(log[i]))
+				}
+			}
+			continue
+		}
+		log = append(log, randomEdit(rng, r, &nextID)...)
+	}
+
+	for _, r := range replicas {
+		for _, i := range rng.Perm(len(log)) {
+			require.NoError(t, r.Apply(log[i]))
+		}
+		require.Zero(t, r.Pending())
+	}
+
+	want, err := json.Marshal(replicas[0].Document())
+	require.NoError(t, err)
+	assert.Nil(t, replicas[0].Document().Validate())
+	for _, r := range replicas[1:] {
+		got, err := json.Marshal(r.Document())
+		require.NoError(t, err)
+		require.JSONEq(t, string(want), string(got), "seed %d", seed)
+	}
+}
+
+func TestReplicasConverge(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		checkConvergence(t, seed)
+	}
+}
+
+func FuzzReplicasConverge(f *testing.F) {
+	for _, seed := range []int64{1, 42, 2024} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		checkConvergence(t, seed)
+	})
+}
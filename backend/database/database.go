@@ -2,12 +2,15 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"os"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -32,12 +35,95 @@ func Connect() (*gorm.DB, error) {
 
 // データベースマイグレーション
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		&Project{},
+		&ProjectMember{},
 		&ShareLink{},
+		&ShareLinkAccess{},
 		&User{},
+		&Session{},
+		&ProjectRevision{},
+		&ProjectAnalysis{},
 		&AnalyticsEvent{},
-	)
+		&AnalyticsDailyRollup{},
+		&AnalyticsRollupState{},
+	); err != nil {
+		return err
+	}
+
+	if err := migrateCollaborators(db); err != nil {
+		return err
+	}
+
+	return backfillRevisions(db)
+}
+
+// migrateCollaborators - 旧 projects.collaborators 列を承認済みの editor メンバーに移行して削除
+func migrateCollaborators(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Project{}, "collaborators") {
+		return nil
+	}
+
+	var rows []struct {
+		ID            string
+		Collaborators string
+	}
+	if err := db.Table("projects").
+		Select("id, collaborators").
+		Where("collaborators IS NOT NULL").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, row := range rows {
+		var userIDs []string
+		if err := json.Unmarshal([]byte(row.Collaborators), &userIDs); err != nil {
+			log.Printf("Skipping unreadable collaborators for project %s: %v", row.ID, err)
+			continue
+		}
+
+		for _, userID := range userIDs {
+			var user User
+			if err := db.First(&user, "id = ?", userID).Error; err != nil {
+				continue
+			}
+			member := ProjectMember{
+				ProjectID:  row.ID,
+				UserID:     user.ID,
+				Email:      user.Email,
+				Role:       "editor",
+				Status:     MemberStatusAccepted,
+				AcceptedAt: &now,
+			}
+			if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return db.Migrator().DropColumn(&Project{}, "collaborators")
+}
+
+// backfillRevisions - 履歴を持たないプロジェクトに現在の内容を最初のリビジョンとして記録
+func backfillRevisions(db *gorm.DB) error {
+	var projects []Project
+	return db.Where("NOT EXISTS (?)",
+		db.Model(&ProjectRevision{}).Select("1").Where("project_revisions.project_id = projects.id"),
+	).FindInBatches(&projects, 100, func(tx *gorm.DB, batch int) error {
+		revisions := make([]ProjectRevision, 0, len(projects))
+		for _, project := range projects {
+			revisions = append(revisions, ProjectRevision{
+				ProjectID: project.ID,
+				Number:    1,
+				Content:   project.Content,
+				AuthorID:  project.OwnerID,
+				Source:    RevisionSourceBaseline,
+				CreatedAt: project.UpdatedAt,
+			})
+		}
+		return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revisions).Error
+	}).Error
 }
 
 // Redisクライアント
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 集計の時間単位
+const (
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+// TimeBucket - 時刻のカラムをUTCの日・週（月曜始まり）単位の "YYYY-MM-DD" に丸めるSQL式
+// PostgreSQLとSQLiteで関数が異なるため、接続先に応じて組み立てる
+func TimeBucket(db *gorm.DB, column, unit string) string {
+	if db.Dialector.Name() == "sqlite" {
+		if unit == BucketWeek {
+			// 次の日曜（当日が日曜ならその日）から6日戻して月曜にする
+			return fmt.Sprintf("date(%s, 'weekday 0', '-6 days')", column)
+		}
+		return fmt.Sprintf("date(%s)", column)
+	}
+
+	return fmt.Sprintf("to_char(date_trunc('%s', %s AT TIME ZONE 'UTC'), 'YYYY-MM-DD')", unit, column)
+}
+
+// IsUniqueViolation - 一意制約の違反によるエラーか
+// ドライバーごとにエラーの型が異なるため、PostgreSQL（SQLSTATE 23505）とSQLiteのメッセージで判定する
+func IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "SQLSTATE 23505") ||
+		strings.Contains(message, "duplicate key value violates unique constraint") ||
+		strings.Contains(message, "UNIQUE constraint failed")
+}
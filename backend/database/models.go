@@ -1,6 +1,7 @@
 package database
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,18 +10,18 @@ import (
 
 // Project モデル
 type Project struct {
-	ID            string         `gorm:"primaryKey" json:"id"`
-	Title         string         `gorm:"not null" json:"title"`
-	Description   string         `json:"description"`
-	Content       []byte         `gorm:"type:jsonb" json:"content"`
-	Theme         string         `gorm:"default:creative" json:"theme"`
-	OwnerID       string         `json:"owner_id"`
-	IsPublic      bool           `gorm:"default:false" json:"is_public"`
-	Collaborators []string       `gorm:"type:jsonb" json:"collaborators"`
-	Tags          []string       `gorm:"type:jsonb" json:"tags"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	ID          string         `gorm:"primaryKey" json:"id"`
+	Title       string         `gorm:"not null" json:"title"`
+	Description string         `json:"description"`
+	Content     []byte         `gorm:"type:jsonb" json:"content"`
+	Theme       string         `gorm:"default:creative" json:"theme"`
+	OwnerID     string         `json:"owner_id"`
+	IsPublic    bool           `gorm:"default:false" json:"is_public"`
+	Tags        []string       `gorm:"type:jsonb;serializer:json" json:"tags"`
+	Version     int            `gorm:"not null;default:1" json:"version"` // 更新のたびに1つ進める（ETag）
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // BeforeCreate - IDの自動生成
@@ -31,17 +32,56 @@ func (p *Project) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// メンバーシップの状態
+const (
+	MemberStatusPending  = "pending"
+	MemberStatusAccepted = "accepted"
+)
+
+// ProjectMember モデル - プロジェクトのメンバーと招待状態
+type ProjectMember struct {
+	ID          string     `gorm:"primaryKey" json:"id"`
+	ProjectID   string     `gorm:"not null;uniqueIndex:idx_project_member_email" json:"project_id"`
+	UserID      string     `gorm:"index" json:"user_id"`
+	Email       string     `gorm:"not null;uniqueIndex:idx_project_member_email" json:"email"`
+	Role        string     `gorm:"not null;default:viewer" json:"role"`    // owner, editor, commenter, viewer
+	Status      string     `gorm:"not null;default:pending" json:"status"` // pending, accepted
+	InvitedBy   string     `json:"invited_by"`
+	InviteToken string     `gorm:"index" json:"-"` // 招待の承認に必要な使い捨てトークン（承認時に消す）
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (m *ProjectMember) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	if m.Status == MemberStatusPending && m.InviteToken == "" {
+		m.InviteToken = generateToken()
+	}
+	return nil
+}
+
+// 共有リンクの権限
+const (
+	SharePermissionView = "view"
+	SharePermissionEdit = "edit"
+)
+
 // ShareLink モデル
 type ShareLink struct {
-	ID          string         `gorm:"primaryKey" json:"id"`
-	ProjectID   string         `gorm:"not null;index" json:"project_id"`
-	Token       string         `gorm:"uniqueIndex;not null" json:"token"`
-	Permission  string         `gorm:"default:view" json:"permission"` // view, edit
-	ExpiresAt   *time.Time     `json:"expires_at"`
-	MaxUses     *int           `json:"max_uses"`
-	CurrentUses int            `gorm:"default:0" json:"current_uses"`
-	CreatedAt   time.Time      `json:"created_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            string         `gorm:"primaryKey" json:"id"`
+	ProjectID     string         `gorm:"not null;index" json:"project_id"`
+	Token         string         `gorm:"uniqueIndex;not null" json:"token"`
+	Permission    string         `gorm:"default:view" json:"permission"` // view, edit
+	ExpiresAt     *time.Time     `json:"expires_at"`
+	MaxUses       *int           `json:"max_uses"`
+	CurrentUses   int            `gorm:"default:0" json:"current_uses"`
+	PasswordHash  string         `json:"-"`              // X-Share-Password で提示させるパスワード（bcrypt）
+	AllowedDomain string         `json:"allowed_domain"` // 指定時はこのドメインで認証したユーザーのみ
+	CreatedAt     time.Time      `json:"created_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 func (s *ShareLink) BeforeCreate(tx *gorm.DB) error {
@@ -54,6 +94,25 @@ func (s *ShareLink) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// ShareLinkAccess モデル - 共有リンクのアクセス履歴
+type ShareLinkAccess struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	ShareLinkID string    `gorm:"not null;index" json:"share_link_id"`
+	ProjectID   string    `gorm:"not null;index" json:"project_id"`
+	UserID      string    `json:"user_id"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	Status      int       `json:"status"` // レスポンスのHTTPステータス
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+}
+
+func (a *ShareLinkAccess) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
+}
+
 // User モデル
 type User struct {
 	ID        string         `gorm:"primaryKey" json:"id"`
@@ -73,6 +132,75 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Session モデル - 発行済みセッショントークン（ログアウトで失効）
+type Session struct {
+	ID        string     `gorm:"primaryKey" json:"id"`
+	UserID    string     `gorm:"not null;index" json:"user_id"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// リビジョンの作成元
+const (
+	RevisionSourceBaseline = "baseline" // 履歴導入前の内容
+	RevisionSourceCreate   = "create"
+	RevisionSourceUpdate   = "update"
+	RevisionSourceShare    = "share" // 共有リンク経由の編集
+	RevisionSourceRestore  = "restore"
+	RevisionSourceLive     = "live" // WebSocketの共同編集セッションからの保存
+)
+
+// ProjectRevision - プロジェクトの内容の履歴
+type ProjectRevision struct {
+	ID           string          `gorm:"primaryKey" json:"id"`
+	ProjectID    string          `gorm:"not null;uniqueIndex:idx_project_revision_number" json:"project_id"`
+	Number       int             `gorm:"not null;uniqueIndex:idx_project_revision_number" json:"number"`
+	Content      json.RawMessage `gorm:"type:jsonb" json:"content,omitempty"`
+	AuthorID     string          `json:"author_id"`
+	ShareLinkID  string          `json:"share_link_id,omitempty"`
+	Source       string          `json:"source"`
+	RestoredFrom *int            `json:"restored_from,omitempty"` // 復元元のリビジョン番号
+	CreatedAt    time.Time       `gorm:"index" json:"created_at"`
+}
+
+func (r *ProjectRevision) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// ProjectAnalysis - プロジェクトの分析履歴
+// 同じ内容の再分析は ContentHash で判定して保存済みの結果を返す
+type ProjectAnalysis struct {
+	ID           string          `gorm:"primaryKey" json:"id"`
+	ProjectID    string          `gorm:"not null;index:idx_project_analysis_hash" json:"project_id"`
+	ContentHash  string          `gorm:"not null;index:idx_project_analysis_hash" json:"content_hash"`
+	UserID       string          `json:"user_id"`
+	AnalysisType string          `json:"analysis_type"`
+	Provider     string          `json:"provider"`
+	TotalBlocks  int             `json:"total_blocks"`
+	MaxDepth     int             `json:"max_depth"`
+	AverageDepth float64         `json:"average_depth"`
+	Result       json.RawMessage `gorm:"type:jsonb" json:"result"`
+	CreatedAt    time.Time       `gorm:"index" json:"created_at"`
+}
+
+func (a *ProjectAnalysis) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return nil
+}
+
 // AnalyticsEvent モデル
 type AnalyticsEvent struct {
 	ID        string    `gorm:"primaryKey" json:"id"`
@@ -94,3 +222,20 @@ func (a *AnalyticsEvent) BeforeCreate(tx *gorm.DB) error {
 func generateToken() string {
 	return uuid.New().String()
 }
+
+// AnalyticsDailyRollup - イベントの日次集計（UTCの日・種別・プロジェクト・ユーザーごとの件数）
+// 保持期間を過ぎて生イベントを削除した後も、集計はこのテーブルから読める
+type AnalyticsDailyRollup struct {
+	Day       time.Time `gorm:"primaryKey" json:"day"`
+	EventType string    `gorm:"primaryKey" json:"event_type"`
+	ProjectID string    `gorm:"primaryKey" json:"project_id"`
+	UserID    string    `gorm:"primaryKey" json:"user_id"`
+	Count     int64     `gorm:"not null" json:"count"`
+}
+
+// AnalyticsRollupState - 日次集計の進捗
+type AnalyticsRollupState struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	RolledUpTo time.Time `json:"rolled_up_to"` // この時刻（UTCの0時）より前の日は集計済み
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,409 @@
+// Package jsonpatch - RFC 6902 JSON Patch の適用
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 操作の種類
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+	OpMove    = "move"
+	OpCopy    = "copy"
+	OpTest    = "test"
+)
+
+// ErrTestFailed - test 操作の値が一致しない
+var ErrTestFailed = errors.New("test operation failed")
+
+// Operation - パッチの1操作
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  *string         `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch - 順に適用する操作の一覧
+type Patch []Operation
+
+// Error - 不正または適用できなかった操作
+// Index は操作の位置、Field は原因となったメンバー（op, path, from, value）
+type Error struct {
+	Index int
+	Field string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Decode - パッチを読み込み、各操作に必要なメンバーがあるか検証する
+func Decode(raw []byte) (Patch, error) {
+	var patch Patch
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, errors.New("patch must be an array of operations")
+	}
+
+	for i, op := range patch {
+		if err := op.validate(); err != nil {
+			err.Index = i
+			return nil, err
+		}
+	}
+	return patch, nil
+}
+
+func (op Operation) validate() *Error {
+	fail := func(field, message string) *Error {
+		return &Error{Field: field, Err: errors.New(message)}
+	}
+
+	switch op.Op {
+	case OpAdd, OpReplace, OpTest:
+		if op.Value == nil {
+			return fail("value", "is required")
+		}
+	case OpMove, OpCopy:
+		if op.From == nil {
+			return fail("from", "is required")
+		}
+		if _, err := parsePointer(*op.From); err != nil {
+			return fail("from", err.Error())
+		}
+	case OpRemove:
+	case "":
+		return fail("op", "is required")
+	default:
+		return fail("op", "must be one of add, remove, replace, move, copy, test")
+	}
+
+	if _, err := parsePointer(op.Path); err != nil {
+		return fail("path", err.Error())
+	}
+	if op.Op == OpMove && (*op.From == op.Path || strings.HasPrefix(op.Path, *op.From+"/")) {
+		return fail("from", "must not be a prefix of path")
+	}
+	return nil
+}
+
+// Apply - ドキュメントにパッチを適用する
+// いずれかの操作が失敗した場合は元のドキュメントを変更せずにエラーを返す
+func (p Patch) Apply(doc []byte) ([]byte, error) {
+	root, err := decodeValue(doc)
+	if err != nil {
+		return nil, errors.New("document is not valid JSON")
+	}
+
+	for i, op := range p {
+		if root, err = op.apply(root); err != nil {
+			field := "path"
+			if errors.Is(err, errFromNotFound) {
+				field = "from"
+			}
+			return nil, &Error{Index: i, Field: field, Err: err}
+		}
+	}
+	return json.Marshal(root)
+}
+
+var errFromNotFound = errors.New("from location does not exist")
+
+func (op Operation) apply(root interface{}) (interface{}, error) {
+	path, _ := parsePointer(op.Path)
+
+	switch op.Op {
+	case OpAdd:
+		value, err := decodeValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, value)
+	case OpRemove:
+		root, _, err := remove(root, path)
+		return root, err
+	case OpReplace:
+		value, err := decodeValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if root, _, err = remove(root, path); err != nil {
+			return nil, err
+		}
+		return add(root, path, value)
+	case OpMove:
+		from, _ := parsePointer(*op.From)
+		root, value, err := remove(root, from)
+		if err != nil {
+			return nil, errFromNotFound
+		}
+		return add(root, path, value)
+	case OpCopy:
+		from, _ := parsePointer(*op.From)
+		value, err := get(root, from)
+		if err != nil {
+			return nil, errFromNotFound
+		}
+		return add(root, path, deepCopy(value))
+	case OpTest:
+		expected, err := decodeValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(actual, expected) {
+			return nil, ErrTestFailed
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer - RFC 6901 JSON Pointer をトークンに分割
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("must be a JSON Pointer starting with /")
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		if strings.Contains(strings.ReplaceAll(strings.ReplaceAll(token, "~0", ""), "~1", ""), "~") {
+			return nil, errors.New("contains an invalid ~ escape")
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// get - パスの値を取得
+func get(root interface{}, path []string) (interface{}, error) {
+	current := root
+	for _, token := range path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, errors.New("path does not exist")
+		}
+	}
+	return current, nil
+}
+
+// add - パスに値を追加（配列の場合は挿入、"-" は末尾に追加）
+func add(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+		return root, nil
+	case []interface{}:
+		index := len(node)
+		if token != "-" {
+			if index, err = arrayIndex(token, len(node), true); err != nil {
+				return nil, err
+			}
+		}
+		node = append(node, nil)
+		copy(node[index+1:], node[index:])
+		node[index] = value
+		return replaceContainer(root, path[:len(path)-1], node)
+	default:
+		return nil, errors.New("parent is not an object or array")
+	}
+}
+
+// remove - パスの値を削除し、削除した値を返す
+func remove(root interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, root, nil
+	}
+
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q does not exist", token)
+		}
+		delete(node, token)
+		return root, value, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[index]
+		node = append(node[:index:index], node[index+1:]...)
+		root, err = replaceContainer(root, path[:len(path)-1], node)
+		return root, value, err
+	default:
+		return nil, nil, errors.New("parent is not an object or array")
+	}
+}
+
+// replaceContainer - 長さが変わった配列を親に設定し直す
+func replaceContainer(root interface{}, path []string, value []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	}
+	return root, nil
+}
+
+// arrayIndex - 配列のインデックスを解釈する（先頭の0や負の数は不可）
+func arrayIndex(token string, length int, insert bool) (int, error) {
+	if token == "-" {
+		return 0, errors.New("index - refers to a nonexistent element")
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	limit := length - 1
+	if insert {
+		limit = length
+	}
+	if index > limit {
+		return 0, fmt.Errorf("array index %d is out of bounds", index)
+	}
+	return index, nil
+}
+
+// decodeValue - 数値の精度を保ったままJSONを読み込む
+func decodeValue(raw []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopy(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopy(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// equal - JSONとして等しいか（数値は値で比較）
+func equal(a, b interface{}) bool {
+	na, aNumber := a.(json.Number)
+	nb, bNumber := b.(json.Number)
+	if aNumber && bNumber {
+		fa, errA := na.Float64()
+		fb, errB := nb.Float64()
+		if errA == nil && errB == nil {
+			return fa == fb
+		}
+		return na == nb
+	}
+
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for key, item := range va {
+			other, ok := vb[key]
+			if !ok || !equal(item, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !equal(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
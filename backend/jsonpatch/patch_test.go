@@ -0,0 +1,127 @@
+package jsonpatch_test
+
+import (
+	"errors"
+	"testing"
+
+	"thinking-blocks-backend/jsonpatch"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func apply(t *testing.T, doc, patch string) (string, error) {
+	t.Helper()
+	p, err := jsonpatch.Decode([]byte(patch))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	result, err := p.Apply([]byte(doc))
+	return string(result), err
+}
+
+// RFC 6902 Appendix A の例
+func TestApply(t *testing.T) {
+	cases := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"test passes", `{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`},
+		{"null value", `{"foo":"bar"}`, `[{"op":"add","path":"/foo","value":null}]`, `{"foo":null}`},
+		{"replace root", `{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{"preserves numbers", `{"n":12345678901234567890}`, `[{"op":"add","path":"/m","value":1}]`, `{"m":1,"n":12345678901234567890}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := apply(t, tc.doc, tc.patch)
+			if assert.NoError(t, err) {
+				assert.JSONEq(t, tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestApplyFailures(t *testing.T) {
+	cases := []struct {
+		name  string
+		doc   string
+		patch string
+		index int
+		field string
+	}{
+		{"missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, 0, "path"},
+		{"out of bounds", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`, 0, "path"},
+		{"leading zero", `{"foo":["bar","baz"]}`, `[{"op":"remove","path":"/foo/01"}]`, 0, "path"},
+		{"remove missing", `{"foo":"bar"}`, `[{"op":"add","path":"/a","value":1},{"op":"remove","path":"/baz"}]`, 1, "path"},
+		{"move missing", `{"foo":"bar"}`, `[{"op":"move","from":"/nope","path":"/foo"}]`, 0, "from"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := apply(t, tc.doc, tc.patch)
+			var patchErr *jsonpatch.Error
+			if assert.True(t, errors.As(err, &patchErr)) {
+				assert.Equal(t, tc.index, patchErr.Index)
+				assert.Equal(t, tc.field, patchErr.Field)
+			}
+		})
+	}
+
+	_, err := apply(t, `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`)
+	assert.ErrorIs(t, err, jsonpatch.ErrTestFailed)
+}
+
+func TestApplyIsAtomic(t *testing.T) {
+	doc := []byte(`{"foo":["bar"]}`)
+	patch, err := jsonpatch.Decode([]byte(`[{"op":"add","path":"/foo/-","value":"baz"},{"op":"test","path":"/foo/0","value":"nope"}]`))
+	assert.NoError(t, err)
+
+	_, err = patch.Apply(doc)
+	assert.Error(t, err)
+	assert.Equal(t, `{"foo":["bar"]}`, string(doc))
+}
+
+func TestDecodeRejectsMalformedOperations(t *testing.T) {
+	cases := []struct {
+		name  string
+		patch string
+		field string
+	}{
+		{"unknown op", `[{"op":"merge","path":"/a"}]`, "op"},
+		{"missing op", `[{"path":"/a"}]`, "op"},
+		{"missing value", `[{"op":"add","path":"/a"}]`, "value"},
+		{"relative path", `[{"op":"remove","path":"a"}]`, "path"},
+		{"bad escape", `[{"op":"remove","path":"/a~2"}]`, "path"},
+		{"missing from", `[{"op":"copy","path":"/a"}]`, "from"},
+		{"move into child", `[{"op":"move","from":"/a","path":"/a/b"}]`, "from"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := jsonpatch.Decode([]byte(tc.patch))
+			var patchErr *jsonpatch.Error
+			if assert.True(t, errors.As(err, &patchErr)) {
+				assert.Equal(t, tc.field, patchErr.Field)
+			}
+		})
+	}
+
+	_, err := jsonpatch.Decode([]byte(`{"op":"add"}`))
+	assert.Error(t, err)
+}
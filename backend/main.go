@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"thinking-blocks-backend/analytics"
 	"thinking-blocks-backend/api"
+	"thinking-blocks-backend/config"
 	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/middleware"
 	"thinking-blocks-backend/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +27,8 @@ func main() {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	cfg := config.Load()
+
 	// データベース接続
 	db, err := database.Connect()
 	if err != nil {
@@ -38,12 +49,16 @@ func main() {
 	// CORS設定
 	router.Use(corsMiddleware())
 
-	// WebSocketハブの初期化
-	hub := websocket.NewHub()
+	// APIハンドラーの初期化
+	apiHandler := api.NewHandler(db, redisClient, cfg)
+
+	// WebSocketハブの初期化（編集中のドキュメントは定期的にプロジェクトへ保存）
+	hub := websocket.NewHub(apiHandler.DocumentStore(), cfg.Collaboration)
 	go hub.Run()
 
-	// APIハンドラーの初期化
-	apiHandler := api.NewHandler(db, redisClient)
+	// アナリティクスの日次集計と保持期間を過ぎたイベントの削除
+	maintenanceCtx, stopMaintenance := context.WithCancel(context.Background())
+	go analytics.RunMaintenance(maintenanceCtx, db, cfg.Analytics)
 
 	// ヘルスチェック
 	router.GET("/health", func(c *gin.Context) {
@@ -55,23 +70,46 @@ func main() {
 
 	// API Routes
 	v1 := router.Group("/api/v1")
+	v1.Use(middleware.Authenticate(apiHandler.Auth()))
+	requireAuth := middleware.RequireAuth()
 	{
-		// プロジェクト管理
+		// プロジェクト管理（公開プロジェクトの閲覧は未認証でも可）
 		projects := v1.Group("/projects")
 		{
 			projects.GET("", apiHandler.GetProjects)
-			projects.POST("", apiHandler.CreateProject)
+			projects.POST("", requireAuth, apiHandler.CreateProject)
 			projects.GET("/:id", apiHandler.GetProject)
-			projects.PUT("/:id", apiHandler.UpdateProject)
-			projects.DELETE("/:id", apiHandler.DeleteProject)
+			projects.PUT("/:id", requireAuth, apiHandler.UpdateProject)
+			projects.PATCH("/:id", requireAuth, apiHandler.UpdateProject)
+			projects.PATCH("/:id/content", requireAuth, apiHandler.PatchProjectContent)
+			projects.DELETE("/:id", requireAuth, apiHandler.DeleteProject)
 
 			// 共有機能
-			projects.POST("/:id/share", apiHandler.CreateShareLink)
-			projects.GET("/:id/share", apiHandler.GetShareLinks)
+			projects.POST("/:id/share", requireAuth, apiHandler.CreateShareLink)
+			projects.GET("/:id/share", requireAuth, apiHandler.GetShareLinks)
+			projects.PATCH("/:id/share/:linkId", requireAuth, apiHandler.UpdateShareLink)
+			projects.DELETE("/:id/share/:linkId", requireAuth, apiHandler.RevokeShareLink)
+			projects.GET("/:id/share/:linkId/accesses", requireAuth, apiHandler.GetShareLinkAccesses)
+
+			// メンバー管理
+			projects.GET("/:id/members", requireAuth, apiHandler.GetMembers)
+			projects.POST("/:id/members", requireAuth, apiHandler.InviteMember)
+			projects.POST("/:id/members/accept", requireAuth, apiHandler.AcceptInvitation)
+			projects.DELETE("/:id/members/:memberId", requireAuth, apiHandler.RemoveMember)
+
+			// リビジョン
+			projects.GET("/:id/revisions", apiHandler.GetRevisions)
+			projects.GET("/:id/revisions/:rev", apiHandler.GetRevision)
+			projects.GET("/:id/revisions/:rev/diff", apiHandler.DiffRevision)
+			projects.POST("/:id/revisions/:rev/restore", requireAuth, apiHandler.RestoreRevision)
+
+			// 分析履歴
+			projects.GET("/:id/analyses", apiHandler.GetProjectAnalyses)
 		}
 
 		// 共有アクセス
 		v1.GET("/share/:token", apiHandler.AccessSharedProject)
+		v1.PUT("/share/:token", apiHandler.UpdateSharedProject)
 
 		// AI分析
 		v1.POST("/ai/analyze", apiHandler.AnalyzeThinking)
@@ -80,34 +118,51 @@ func main() {
 		analytics := v1.Group("/analytics")
 		{
 			analytics.POST("/events", apiHandler.TrackEvent)
-			analytics.GET("/stats", apiHandler.GetAnalytics)
+			analytics.POST("/events/batch", apiHandler.TrackEvents)
+			analytics.GET("/stats", requireAuth, apiHandler.GetAnalytics)
 		}
 
-		// ユーザー認証（将来の実装用）
+		// ユーザー認証
 		auth := v1.Group("/auth")
 		{
 			auth.POST("/register", apiHandler.Register)
 			auth.POST("/login", apiHandler.Login)
-			auth.POST("/logout", apiHandler.Logout)
-			auth.GET("/me", apiHandler.GetCurrentUser)
+			auth.POST("/logout", requireAuth, apiHandler.Logout)
+			auth.GET("/me", requireAuth, apiHandler.GetCurrentUser)
 		}
 	}
 
 	// WebSocket接続
-	router.GET("/ws/:projectId", func(c *gin.Context) {
-		projectId := c.Param("projectId")
-		websocket.HandleWebSocket(hub, c.Writer, c.Request, projectId)
-	})
+	router.GET("/ws/:projectId", middleware.Authenticate(apiHandler.Auth()), apiHandler.ProjectSocket(hub))
 
 	// サーバー起動
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	srv := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: router,
 	}
+	go func() {
+		log.Printf("Starting server on port %s", cfg.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// 終了シグナルを受けたら新規リクエストを止め、編集中のドキュメントとバッファ内のイベントを書き込んでから終了
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down server...")
+	stopMaintenance()
 
-	log.Printf("Starting server on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+	hub.Close()
+	if err := apiHandler.Close(ctx); err != nil {
+		log.Printf("Failed to drain analytics events: %v", err)
 	}
 }
 
@@ -115,8 +170,9 @@ func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Share-Password, If-Match, If-None-Match")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
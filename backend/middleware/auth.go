@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+
+	"thinking-blocks-backend/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// UserIDKey - 認証済みユーザーIDのコンテキストキー
+	UserIDKey = "user_id"
+	// SessionIDKey - 認証に使われたセッションIDのコンテキストキー
+	SessionIDKey = "session_id"
+)
+
+// Authenticate - ベアラートークンを検証し、ユーザーIDをコンテキストに設定
+// トークンがない場合は匿名アクセスとして続行し、不正なトークンは401で拒否する
+func Authenticate(manager *auth.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := auth.TokenFromRequest(c.Request)
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		session, err := manager.Authenticate(token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Unauthorized",
+				"details": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set(UserIDKey, session.UserID)
+		c.Set(SessionIDKey, session.ID)
+		c.Next()
+	}
+}
+
+// RequireAuth - 認証済みユーザーのみ許可
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentUserID(c) == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Unauthorized",
+				"details": "Authentication required",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUserID - 認証済みユーザーIDを取得（匿名の場合は空文字）
+func CurrentUserID(c *gin.Context) string {
+	return c.GetString(UserIDKey)
+}
+
+// CurrentSessionID - 認証に使われたセッションIDを取得
+func CurrentSessionID(c *gin.Context) string {
+	return c.GetString(SessionIDKey)
+}
@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/utils"
+)
+
+// Action - プロジェクトに対する操作
+type Action string
+
+const (
+	ActionView    Action = "view"
+	ActionComment Action = "comment"
+	ActionEdit    Action = "edit"
+	ActionDelete  Action = "delete"
+	ActionShare   Action = "share" // 共有リンクの作成とメンバー管理
+)
+
+// Role - プロジェクトに対するユーザーの立場
+type Role string
+
+const (
+	RoleNone      Role = ""
+	RoleOwner     Role = "owner"
+	RoleEditor    Role = "editor"
+	RoleCommenter Role = "commenter"
+	RoleViewer    Role = "viewer"
+)
+
+// 各ロールに許可された操作
+var permissions = map[Role][]Action{
+	RoleOwner:     {ActionView, ActionComment, ActionEdit, ActionDelete, ActionShare},
+	RoleEditor:    {ActionView, ActionComment, ActionEdit},
+	RoleCommenter: {ActionView, ActionComment},
+	RoleViewer:    {ActionView},
+}
+
+// ValidRole - メンバーに付与できるロールか
+// オーナーはプロジェクトの owner_id だけが持ち、メンバーシップでは付与しない
+func ValidRole(role string) bool {
+	_, ok := permissions[Role(role)]
+	return ok && Role(role) != RoleOwner
+}
+
+// RoleOf - ユーザーのプロジェクトに対するロールを判定
+// member は承認済みのメンバーシップ（なければnil）
+func RoleOf(project *database.Project, userID string, member *database.ProjectMember) Role {
+	if userID == "" {
+		return RoleNone
+	}
+	if project.OwnerID == userID {
+		return RoleOwner
+	}
+	if member != nil && member.UserID == userID && member.Status == database.MemberStatusAccepted && ValidRole(member.Role) {
+		return Role(member.Role)
+	}
+	return RoleNone
+}
+
+// Can - ロールに操作が許可されているか
+func Can(role Role, action Action) bool {
+	for _, allowed := range permissions[role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize - ユーザーがプロジェクトに対して操作を行えるか検証
+// 公開プロジェクトは誰でも閲覧可能
+func Authorize(project *database.Project, userID string, member *database.ProjectMember, action Action) *utils.AppError {
+	if action == ActionView && project.IsPublic {
+		return nil
+	}
+
+	role := RoleOf(project, userID, member)
+	if Can(role, action) {
+		return nil
+	}
+
+	if userID == "" {
+		return utils.NewUnauthorizedError("Authentication required")
+	}
+	return utils.NewForbiddenError("You do not have permission to " + string(action) + " this project")
+}
@@ -0,0 +1,69 @@
+package policy_test
+
+import (
+	"net/http"
+	"testing"
+
+	"thinking-blocks-backend/database"
+	"thinking-blocks-backend/policy"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(t *testing.T) {
+	project := &database.Project{OwnerID: "owner"}
+	members := map[string]*database.ProjectMember{
+		"editor":    {UserID: "editor", Role: "editor", Status: database.MemberStatusAccepted},
+		"commenter": {UserID: "commenter", Role: "commenter", Status: database.MemberStatusAccepted},
+		"viewer":    {UserID: "viewer", Role: "viewer", Status: database.MemberStatusAccepted},
+		"invited":   {UserID: "invited", Role: "editor", Status: database.MemberStatusPending},
+		"co-owner":  {UserID: "co-owner", Role: "owner", Status: database.MemberStatusAccepted},
+	}
+
+	cases := []struct {
+		userID string
+		action policy.Action
+		code   int
+	}{
+		{"owner", policy.ActionDelete, 0},
+		{"owner", policy.ActionShare, 0},
+		{"editor", policy.ActionView, 0},
+		{"editor", policy.ActionEdit, 0},
+		{"editor", policy.ActionDelete, http.StatusForbidden},
+		{"editor", policy.ActionShare, http.StatusForbidden},
+		{"commenter", policy.ActionComment, 0},
+		{"commenter", policy.ActionEdit, http.StatusForbidden},
+		{"viewer", policy.ActionView, 0},
+		{"viewer", policy.ActionComment, http.StatusForbidden},
+		{"invited", policy.ActionView, http.StatusForbidden},
+		{"co-owner", policy.ActionShare, http.StatusForbidden},
+		{"stranger", policy.ActionView, http.StatusForbidden},
+		{"stranger", policy.ActionEdit, http.StatusForbidden},
+		{"", policy.ActionView, http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		err := policy.Authorize(project, tc.userID, members[tc.userID], tc.action)
+		if tc.code == 0 {
+			assert.Nil(t, err, "%s should be allowed to %s", tc.userID, tc.action)
+		} else if assert.NotNil(t, err, "%s should not be allowed to %s", tc.userID, tc.action) {
+			assert.Equal(t, tc.code, err.Code)
+		}
+	}
+}
+
+func TestAuthorizePublicProject(t *testing.T) {
+	project := &database.Project{OwnerID: "owner", IsPublic: true}
+
+	assert.Nil(t, policy.Authorize(project, "", nil, policy.ActionView))
+	assert.NotNil(t, policy.Authorize(project, "", nil, policy.ActionEdit))
+	assert.NotNil(t, policy.Authorize(project, "stranger", nil, policy.ActionEdit))
+}
+
+func TestValidRole(t *testing.T) {
+	assert.True(t, policy.ValidRole("editor"))
+	assert.True(t, policy.ValidRole("viewer"))
+	assert.False(t, policy.ValidRole("owner"))
+	assert.False(t, policy.ValidRole("admin"))
+	assert.False(t, policy.ValidRole(""))
+}
@@ -0,0 +1,210 @@
+package thinking
+
+import (
+	"strings"
+	"time"
+)
+
+// Analysis - 思考構造の分析結果
+// JSONのキーはNext.jsの /api/ai/analyze と同じ形にしている
+type Analysis struct {
+	Stats       Stats         `json:"stats"`
+	Patterns    []string      `json:"patterns"`
+	Suggestions []string      `json:"suggestions"`
+	Depth       DepthAnalysis `json:"depth"`
+	Timestamp   time.Time     `json:"timestamp"`
+}
+
+// Stats - ブロックの統計
+type Stats struct {
+	Total        int            `json:"total"`
+	ByType       map[string]int `json:"byType"`
+	AverageDepth float64        `json:"averageDepth"`
+	Connections  int            `json:"connections"`
+}
+
+// DepthAnalysis - 思考の深さ
+type DepthAnalysis struct {
+	MaxDepth       int    `json:"maxDepth"`
+	Quality        string `json:"quality"`
+	Recommendation string `json:"recommendation"`
+}
+
+// 思考ブロックの種類（thinking_why と旧名 why_block を同じものとして扱う）
+const (
+	kindWhy     = "why"
+	kindHow     = "how"
+	kindWhat    = "what"
+	kindObserve = "observe"
+	kindReflect = "reflect"
+	kindConnect = "connect"
+)
+
+// kindOf - ブロックの型から種類を取り出す。思考ブロック以外は空文字
+func kindOf(blockType string) string {
+	var kind string
+	switch {
+	case strings.HasPrefix(blockType, ThinkingTypePrefix):
+		if !KnownThinkingTypes[blockType] {
+			return ""
+		}
+		kind = strings.TrimPrefix(blockType, ThinkingTypePrefix)
+	case strings.HasSuffix(blockType, "_block"):
+		kind = strings.TrimSuffix(blockType, "_block")
+		if !KnownThinkingTypes[ThinkingTypePrefix+kind] {
+			return ""
+		}
+	}
+	return kind
+}
+
+// Analyze - ブロックの統計・パターン・改善提案・深さを算出
+// theme が空の場合はドキュメントのテーマを使う
+func Analyze(doc *Document, theme string) *Analysis {
+	if theme == "" {
+		theme = doc.ThinkingStructure.Theme
+	}
+
+	blocks := doc.Blocks()
+	stats := blockStats(blocks)
+
+	return &Analysis{
+		Stats:       stats,
+		Patterns:    detectPatterns(blocks),
+		Suggestions: suggestions(blocks, stats, theme),
+		Depth:       analyzeDepth(blocks),
+		Timestamp:   time.Now(),
+	}
+}
+
+func blockStats(blocks []Block) Stats {
+	stats := Stats{
+		Total:  len(blocks),
+		ByType: make(map[string]int),
+	}
+
+	depthSum := 0
+	for _, block := range blocks {
+		stats.ByType[block.Type]++
+		stats.Connections += len(block.Connections)
+		depthSum += blockDepth(block)
+	}
+	if len(blocks) > 0 {
+		stats.AverageDepth = float64(depthSum) / float64(len(blocks))
+	}
+
+	return stats
+}
+
+func detectPatterns(blocks []Block) []string {
+	patterns := []string{}
+
+	// WHY → HOW → WHAT パターン
+	if hasSequence(blocks, kindWhy, kindHow, kindWhat) {
+		patterns = append(patterns, "論理的展開パターン検出")
+	}
+
+	// OBSERVE → REFLECT パターン
+	if hasSequence(blocks, kindObserve, kindReflect) {
+		patterns = append(patterns, "振り返りサイクルパターン検出")
+	}
+
+	// 多数のCONNECTブロック
+	if countKind(blocks, kindConnect) > 3 {
+		patterns = append(patterns, "多角的思考パターン検出")
+	}
+
+	return patterns
+}
+
+func suggestions(blocks []Block, stats Stats, theme string) []string {
+	suggestions := []string{}
+
+	// ブロック数に基づく提案
+	if stats.Total < 3 {
+		suggestions = append(suggestions, "思考をさらに深掘りしてみましょう。WHYブロックを追加して根本原因を探ってみてください。")
+	}
+
+	// WHYブロックが少ない場合
+	if countKind(blocks, kindWhy) < 2 {
+		suggestions = append(suggestions, "「なぜ？」を繰り返すことで、より深い理解が得られます。")
+	}
+
+	// REFLECTブロックがない場合
+	if countKind(blocks, kindReflect) == 0 {
+		suggestions = append(suggestions, "振り返りブロックを追加して、思考プロセスを客観視してみましょう。")
+	}
+
+	// テーマに応じた提案
+	switch theme {
+	case ThemeResearch:
+		suggestions = append(suggestions, "OBSERVEブロックで観察事実を増やすと、より科学的なアプローチになります。")
+	case ThemeCreative:
+		suggestions = append(suggestions, "CONNECTブロックを使って、異なるアイデアを結びつけてみましょう。")
+	}
+
+	return suggestions
+}
+
+func analyzeDepth(blocks []Block) DepthAnalysis {
+	maxDepth := 0
+	for _, block := range blocks {
+		if d := blockDepth(block); d > maxDepth {
+			maxDepth = d
+		}
+	}
+
+	result := DepthAnalysis{MaxDepth: maxDepth}
+
+	switch {
+	case maxDepth >= 4:
+		result.Quality = "深い"
+	case maxDepth >= 2:
+		result.Quality = "中程度"
+	default:
+		result.Quality = "浅い"
+	}
+
+	if maxDepth < 3 {
+		result.Recommendation = "さらに掘り下げることで新しい発見があるかもしれません"
+	} else {
+		result.Recommendation = "十分な深さで思考が展開されています"
+	}
+
+	return result
+}
+
+// blockDepth - 深さ未指定のブロックは1として数える
+func blockDepth(block Block) int {
+	if block.Depth <= 0 {
+		return 1
+	}
+	return block.Depth
+}
+
+// hasSequence - 指定した種類のブロックが連続して並んでいるか
+func hasSequence(blocks []Block, sequence ...string) bool {
+	for i := 0; i+len(sequence) <= len(blocks); i++ {
+		matched := true
+		for j, kind := range sequence {
+			if kindOf(blocks[i+j].Type) != kind {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func countKind(blocks []Block, kind string) int {
+	count := 0
+	for _, block := range blocks {
+		if kindOf(block.Type) == kind {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,114 @@
+package thinking_test
+
+import (
+	"testing"
+
+	"thinking-blocks-backend/thinking"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseDocument(t *testing.T, raw string) *thinking.Document {
+	t.Helper()
+	doc, appErr := thinking.Parse([]byte(raw))
+	if appErr != nil {
+		t.Fatalf("parse: %v", appErr.Fields)
+	}
+	return doc
+}
+
+func TestAnalyzeStats(t *testing.T) {
+	doc := parseDocument(t, `{"thinking_structure": {"blocks": [
+		{"id": "a", "type": "thinking_why", "depth": 3, "connections": ["b", "c"]},
+		{"id": "b", "type": "thinking_why", "connections": ["c"]},
+		{"id": "c", "type": "event_start"}
+	]}}`)
+
+	analysis := thinking.Analyze(doc, "")
+
+	assert.Equal(t, 3, analysis.Stats.Total)
+	assert.Equal(t, map[string]int{"thinking_why": 2, "event_start": 1}, analysis.Stats.ByType)
+	assert.InDelta(t, 5.0/3.0, analysis.Stats.AverageDepth, 1e-9)
+	assert.Equal(t, 3, analysis.Stats.Connections)
+	assert.Equal(t, 3, analysis.Depth.MaxDepth)
+	assert.Equal(t, "中程度", analysis.Depth.Quality)
+	assert.Equal(t, "十分な深さで思考が展開されています", analysis.Depth.Recommendation)
+}
+
+func TestAnalyzeEmptyDocument(t *testing.T) {
+	analysis := thinking.Analyze(parseDocument(t, `{"thinking_structure": {"blocks": []}}`), "")
+
+	assert.Equal(t, 0, analysis.Stats.Total)
+	assert.Equal(t, 0.0, analysis.Stats.AverageDepth)
+	assert.Equal(t, 0, analysis.Depth.MaxDepth)
+	assert.Equal(t, "浅い", analysis.Depth.Quality)
+	assert.Empty(t, analysis.Patterns)
+	assert.Len(t, analysis.Suggestions, 3)
+}
+
+func TestAnalyzePatterns(t *testing.T) {
+	cases := []struct {
+		name     string
+		raw      string
+		expected []string
+	}{
+		{
+			name: "logical sequence",
+			raw: `{"thinking_structure": {"blocks": [
+				{"id": "a", "type": "thinking_why"},
+				{"id": "b", "type": "thinking_how"},
+				{"id": "c", "type": "thinking_what"}
+			]}}`,
+			expected: []string{"論理的展開パターン検出"},
+		},
+		{
+			name:     "legacy type names",
+			raw:      `{"blocks": [{"id": "a", "type": "observe_block"}, {"id": "b", "type": "reflect_block"}]}`,
+			expected: []string{"振り返りサイクルパターン検出"},
+		},
+		{
+			name: "sequence must be consecutive",
+			raw: `{"thinking_structure": {"blocks": [
+				{"id": "a", "type": "thinking_why"},
+				{"id": "b", "type": "event_start"},
+				{"id": "c", "type": "thinking_how"},
+				{"id": "d", "type": "thinking_what"}
+			]}}`,
+			expected: []string{},
+		},
+		{
+			name: "many connect blocks",
+			raw: `{"thinking_structure": {"blocks": [
+				{"id": "a", "type": "thinking_connect"},
+				{"id": "b", "type": "thinking_connect"},
+				{"id": "c", "type": "connect_block"},
+				{"id": "d", "type": "thinking_connect"}
+			]}}`,
+			expected: []string{"多角的思考パターン検出"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			analysis := thinking.Analyze(parseDocument(t, tc.raw), "")
+			assert.Equal(t, tc.expected, analysis.Patterns)
+		})
+	}
+}
+
+func TestAnalyzeSuggestions(t *testing.T) {
+	doc := parseDocument(t, `{"thinking_structure": {"theme": "research", "blocks": [
+		{"id": "a", "type": "thinking_why"},
+		{"id": "b", "type": "thinking_why"},
+		{"id": "c", "type": "thinking_reflect"}
+	]}}`)
+
+	// リクエストでテーマを指定しない場合はドキュメントのテーマを使う
+	assert.Equal(t, []string{
+		"OBSERVEブロックで観察事実を増やすと、より科学的なアプローチになります。",
+	}, thinking.Analyze(doc, "").Suggestions)
+
+	assert.Equal(t, []string{
+		"CONNECTブロックを使って、異なるアイデアを結びつけてみましょう。",
+	}, thinking.Analyze(doc, "creative").Suggestions)
+}
@@ -0,0 +1,163 @@
+package thinking
+
+import "sort"
+
+// Diff - ブロックIDで対応付けた2つのドキュメントの差分
+type Diff struct {
+	Added              []Block       `json:"added"`
+	Removed            []Block       `json:"removed"`
+	Moved              []BlockMove   `json:"moved"`
+	Retyped            []BlockChange `json:"retyped"`
+	Retexted           []BlockChange `json:"retexted"`
+	Reparented         []BlockChange `json:"reparented"`
+	ConnectionsAdded   []Connection  `json:"connections_added"`
+	ConnectionsRemoved []Connection  `json:"connections_removed"`
+	Summary            DiffSummary   `json:"summary"`
+}
+
+// BlockMove - 座標が変わったブロック
+type BlockMove struct {
+	ID   string   `json:"id"`
+	From Position `json:"from"`
+	To   Position `json:"to"`
+}
+
+// BlockChange - 型・テキスト・親が変わったブロック
+type BlockChange struct {
+	ID   string `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Connection - ブロック間の接続（From の connections に To が含まれる）
+type Connection struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DiffSummary - 差分の件数
+type DiffSummary struct {
+	Added              int `json:"added"`
+	Removed            int `json:"removed"`
+	Moved              int `json:"moved"`
+	Retyped            int `json:"retyped"`
+	Retexted           int `json:"retexted"`
+	Reparented         int `json:"reparented"`
+	Unchanged          int `json:"unchanged"`
+	ConnectionsAdded   int `json:"connections_added"`
+	ConnectionsRemoved int `json:"connections_removed"`
+}
+
+// Empty - 差分がないか
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Moved) == 0 &&
+		len(d.Retyped) == 0 && len(d.Retexted) == 0 && len(d.Reparented) == 0 &&
+		len(d.ConnectionsAdded) == 0 && len(d.ConnectionsRemoved) == 0
+}
+
+// Compare - from から to への差分を求める
+// ブロックはドキュメント内の順序、接続は From, To の順に並べる
+func Compare(from, to *Document) *Diff {
+	diff := &Diff{
+		Added:              []Block{},
+		Removed:            []Block{},
+		Moved:              []BlockMove{},
+		Retyped:            []BlockChange{},
+		Retexted:           []BlockChange{},
+		Reparented:         []BlockChange{},
+		ConnectionsAdded:   []Connection{},
+		ConnectionsRemoved: []Connection{},
+	}
+
+	before := indexBlocks(from)
+	after := indexBlocks(to)
+
+	for _, block := range from.Blocks() {
+		if _, ok := after[block.ID]; !ok {
+			diff.Removed = append(diff.Removed, block)
+		}
+	}
+
+	for _, block := range to.Blocks() {
+		old, ok := before[block.ID]
+		if !ok {
+			diff.Added = append(diff.Added, block)
+			continue
+		}
+
+		changed := false
+		if old.Position != block.Position {
+			diff.Moved = append(diff.Moved, BlockMove{ID: block.ID, From: old.Position, To: block.Position})
+			changed = true
+		}
+		if old.Type != block.Type {
+			diff.Retyped = append(diff.Retyped, BlockChange{ID: block.ID, From: old.Type, To: block.Type})
+			changed = true
+		}
+		if old.Text != block.Text {
+			diff.Retexted = append(diff.Retexted, BlockChange{ID: block.ID, From: old.Text, To: block.Text})
+			changed = true
+		}
+		if old.Parent != block.Parent {
+			diff.Reparented = append(diff.Reparented, BlockChange{ID: block.ID, From: old.Parent, To: block.Parent})
+			changed = true
+		}
+		if !changed {
+			diff.Summary.Unchanged++
+		}
+	}
+
+	beforeEdges := connectionSet(from)
+	afterEdges := connectionSet(to)
+	for edge := range afterEdges {
+		if !beforeEdges[edge] {
+			diff.ConnectionsAdded = append(diff.ConnectionsAdded, edge)
+		}
+	}
+	for edge := range beforeEdges {
+		if !afterEdges[edge] {
+			diff.ConnectionsRemoved = append(diff.ConnectionsRemoved, edge)
+		}
+	}
+	sortConnections(diff.ConnectionsAdded)
+	sortConnections(diff.ConnectionsRemoved)
+
+	diff.Summary.Added = len(diff.Added)
+	diff.Summary.Removed = len(diff.Removed)
+	diff.Summary.Moved = len(diff.Moved)
+	diff.Summary.Retyped = len(diff.Retyped)
+	diff.Summary.Retexted = len(diff.Retexted)
+	diff.Summary.Reparented = len(diff.Reparented)
+	diff.Summary.ConnectionsAdded = len(diff.ConnectionsAdded)
+	diff.Summary.ConnectionsRemoved = len(diff.ConnectionsRemoved)
+
+	return diff
+}
+
+func indexBlocks(doc *Document) map[string]Block {
+	index := make(map[string]Block, len(doc.Blocks()))
+	for _, block := range doc.Blocks() {
+		index[block.ID] = block
+	}
+	return index
+}
+
+// connectionSet - ドキュメント内の接続（重複は1つにまとめる）
+func connectionSet(doc *Document) map[Connection]bool {
+	set := map[Connection]bool{}
+	for _, block := range doc.Blocks() {
+		for _, target := range block.Connections {
+			set[Connection{From: block.ID, To: target}] = true
+		}
+	}
+	return set
+}
+
+func sortConnections(edges []Connection) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
@@ -0,0 +1,64 @@
+package thinking_test
+
+import (
+	"testing"
+
+	"thinking-blocks-backend/thinking"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	before := parseDocument(t, `{"thinking_structure": {"blocks": [
+		{"id": "a", "type": "thinking_why", "text": "なぜ", "position": {"x": 0, "y": 0}, "connections": ["b", "c"]},
+		{"id": "b", "type": "thinking_how", "text": "どうやって", "position": {"x": 100, "y": 0}},
+		{"id": "c", "type": "thinking_what", "text": "消える", "position": {"x": 200, "y": 0}},
+		{"id": "d", "type": "thinking_observe", "text": "そのまま", "position": {"x": 300, "y": 0}},
+		{"id": "f", "type": "thinking_reflect", "text": "変わらない", "position": {"x": 400, "y": 0}}
+	]}}`)
+	after := parseDocument(t, `{"thinking_structure": {"blocks": [
+		{"id": "a", "type": "thinking_why", "text": "なぜ？", "position": {"x": 0, "y": 0}, "connections": ["b", "e"]},
+		{"id": "b", "type": "thinking_reflect", "text": "どうやって", "position": {"x": 120, "y": 40}},
+		{"id": "d", "type": "thinking_observe", "text": "そのまま", "position": {"x": 300, "y": 0}, "parent": "a"},
+		{"id": "e", "type": "thinking_what", "text": "新しい", "position": {"x": 200, "y": 100}},
+		{"id": "f", "type": "thinking_reflect", "text": "変わらない", "position": {"x": 400, "y": 0}}
+	]}}`)
+
+	diff := thinking.Compare(before, after)
+
+	if assert.Len(t, diff.Added, 1) {
+		assert.Equal(t, "e", diff.Added[0].ID)
+	}
+	if assert.Len(t, diff.Removed, 1) {
+		assert.Equal(t, "c", diff.Removed[0].ID)
+	}
+	assert.Equal(t, []thinking.BlockMove{
+		{ID: "b", From: thinking.Position{X: 100, Y: 0}, To: thinking.Position{X: 120, Y: 40}},
+	}, diff.Moved)
+	assert.Equal(t, []thinking.BlockChange{{ID: "b", From: "thinking_how", To: "thinking_reflect"}}, diff.Retyped)
+	assert.Equal(t, []thinking.BlockChange{{ID: "a", From: "なぜ", To: "なぜ？"}}, diff.Retexted)
+	assert.Equal(t, []thinking.BlockChange{{ID: "d", From: "", To: "a"}}, diff.Reparented)
+	assert.Equal(t, []thinking.Connection{{From: "a", To: "e"}}, diff.ConnectionsAdded)
+	assert.Equal(t, []thinking.Connection{{From: "a", To: "c"}}, diff.ConnectionsRemoved)
+
+	assert.Equal(t, thinking.DiffSummary{
+		Added: 1, Removed: 1, Moved: 1, Retyped: 1, Retexted: 1, Reparented: 1, Unchanged: 1,
+		ConnectionsAdded: 1, ConnectionsRemoved: 1,
+	}, diff.Summary)
+	assert.False(t, diff.Empty())
+}
+
+func TestCompareIdentical(t *testing.T) {
+	raw := `{"thinking_structure": {"blocks": [
+		{"id": "a", "type": "thinking_why", "connections": ["b", "b"]},
+		{"id": "b", "type": "thinking_how"}
+	]}}`
+
+	diff := thinking.Compare(parseDocument(t, raw), parseDocument(t, raw))
+
+	assert.True(t, diff.Empty())
+	assert.Equal(t, 2, diff.Summary.Unchanged)
+	// 空の配列として返す
+	assert.NotNil(t, diff.Added)
+	assert.NotNil(t, diff.ConnectionsRemoved)
+}
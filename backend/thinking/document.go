@@ -0,0 +1,161 @@
+package thinking
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"thinking-blocks-backend/utils"
+)
+
+// Document - フロントエンドが生成する思考構造ドキュメント
+//
+//	{"thinking_structure": {"created_at": "...", "theme": "...", "blocks": [...]}}
+//
+// AI分析ルートが受け付けていた旧形式 {"blocks": [...]} も読み込める。
+type Document struct {
+	ThinkingStructure Structure `json:"thinking_structure"`
+}
+
+// Structure - thinking_structure の本体
+type Structure struct {
+	CreatedAt string  `json:"created_at,omitempty"`
+	Theme     string  `json:"theme,omitempty"`
+	Blocks    []Block `json:"blocks"`
+}
+
+// Block - 思考ブロック
+type Block struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Text        string   `json:"text"`
+	Position    Position `json:"position"`
+	Connections []string `json:"connections,omitempty"`
+	Parent      string   `json:"parent,omitempty"` // 親ブロックのID（ルートは空）
+	Depth       int      `json:"depth,omitempty"`
+}
+
+// Position - ワークスペース上の座標
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Blocks - ブロック一覧へのショートカット
+func (d *Document) Blocks() []Block {
+	return d.ThinkingStructure.Blocks
+}
+
+// Block - IDでブロックを検索
+func (d *Document) Block(id string) (*Block, bool) {
+	for i := range d.ThinkingStructure.Blocks {
+		if d.ThinkingStructure.Blocks[i].ID == id {
+			return &d.ThinkingStructure.Blocks[i], true
+		}
+	}
+	return nil, false
+}
+
+// Marshal - 正規形式（thinking_structure）でJSONに変換
+func (d *Document) Marshal() ([]byte, error) {
+	if d.ThinkingStructure.Blocks == nil {
+		d.ThinkingStructure.Blocks = []Block{}
+	}
+	return json.Marshal(d)
+}
+
+// Parse - JSONを読み込み、検証する
+// 不正な場合はフィールド単位のエラーを持つ AppError を返す
+func Parse(raw []byte) (*Document, *utils.AppError) {
+	var errs fieldErrors
+
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &top); err != nil || top == nil {
+		errs.add("content", "must be a JSON object")
+		return nil, errs.appError()
+	}
+
+	doc := &Document{}
+	var blocksRaw json.RawMessage
+	blocksPath := "thinking_structure.blocks"
+
+	if structureRaw, ok := top["thinking_structure"]; ok {
+		var structure map[string]json.RawMessage
+		if err := json.Unmarshal(structureRaw, &structure); err != nil || structure == nil {
+			errs.add("thinking_structure", "must be an object")
+			return nil, errs.appError()
+		}
+		if v, ok := structure["created_at"]; ok {
+			errs.decode("thinking_structure.created_at", v, &doc.ThinkingStructure.CreatedAt, "must be a string")
+		}
+		if v, ok := structure["theme"]; ok {
+			errs.decode("thinking_structure.theme", v, &doc.ThinkingStructure.Theme, "must be a string")
+		}
+		blocksRaw = structure["blocks"]
+	} else if legacyBlocks, ok := top["blocks"]; ok {
+		blocksRaw = legacyBlocks
+		blocksPath = "blocks"
+	} else {
+		errs.add("thinking_structure", "is required")
+		return nil, errs.appError()
+	}
+
+	var blocks []json.RawMessage
+	if len(blocksRaw) == 0 || string(blocksRaw) == "null" {
+		blocks = nil
+	} else if err := json.Unmarshal(blocksRaw, &blocks); err != nil {
+		errs.add(blocksPath, "must be an array")
+		return nil, errs.appError()
+	}
+
+	if len(blocks) > MaxBlocks {
+		errs.add(blocksPath, fmt.Sprintf("must not contain more than %d blocks", MaxBlocks))
+		return nil, errs.appError()
+	}
+
+	doc.ThinkingStructure.Blocks = make([]Block, 0, len(blocks))
+	for i, blockRaw := range blocks {
+		var block Block
+		if !errs.decode(fmt.Sprintf("%s[%d]", blocksPath, i), blockRaw, &block, "must be a block object") {
+			continue
+		}
+		doc.ThinkingStructure.Blocks = append(doc.ThinkingStructure.Blocks, block)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs.appError()
+	}
+
+	if appErr := doc.Validate(); appErr != nil {
+		return nil, appErr
+	}
+
+	return doc, nil
+}
+
+// fieldErrors - 検証エラーの収集
+type fieldErrors []utils.FieldError
+
+func (e *fieldErrors) add(field, message string) {
+	*e = append(*e, utils.FieldError{Field: field, Message: message})
+}
+
+// decode - JSONを読み込み、型の不一致をフィールドエラーとして記録する
+func (e *fieldErrors) decode(field string, raw json.RawMessage, dest interface{}, message string) bool {
+	err := json.Unmarshal(raw, dest)
+	if err == nil {
+		return true
+	}
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+		e.add(field+"."+typeErr.Field, "must be a "+typeErr.Type.String())
+		return false
+	}
+	e.add(field, message)
+	return false
+}
+
+func (e fieldErrors) appError() *utils.AppError {
+	if len(e) == 0 {
+		return nil
+	}
+	return utils.NewValidationError("Invalid thinking_structure content", e)
+}
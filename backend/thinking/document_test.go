@@ -0,0 +1,86 @@
+package thinking_test
+
+import (
+	"net/http"
+	"testing"
+
+	"thinking-blocks-backend/thinking"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThinkingStructure(t *testing.T) {
+	raw := []byte(`{
+		"thinking_structure": {
+			"created_at": "2025-10-31",
+			"theme": "creative",
+			"blocks": [
+				{"id": "a", "type": "thinking_why", "text": "なぜ？", "position": {"x": 50, "y": 50}, "connections": ["b"]},
+				{"id": "b", "type": "thinking_how", "text": "どうやって", "position": {"x": 50, "y": 120}},
+				{"id": "c", "type": "event_start", "text": ""}
+			]
+		},
+		"metadata": {"version": "1.0.0"}
+	}`)
+
+	doc, appErr := thinking.Parse(raw)
+	if !assert.Nil(t, appErr) {
+		return
+	}
+	assert.Equal(t, "creative", doc.ThinkingStructure.Theme)
+	assert.Len(t, doc.Blocks(), 3)
+
+	block, ok := doc.Block("b")
+	assert.True(t, ok)
+	assert.Equal(t, 120.0, block.Position.Y)
+}
+
+func TestParseLegacyBlocks(t *testing.T) {
+	doc, appErr := thinking.Parse([]byte(`{"blocks": [{"id": "a", "type": "why_block", "depth": 2}]}`))
+	if !assert.Nil(t, appErr) {
+		return
+	}
+	assert.Equal(t, 2, doc.Blocks()[0].Depth)
+
+	// 正規形式で書き出す
+	out, err := doc.Marshal()
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"thinking_structure"`)
+}
+
+func TestParseRejectsMalformedDocuments(t *testing.T) {
+	cases := []struct {
+		name  string
+		raw   string
+		field string
+	}{
+		{"not an object", `[1, 2]`, "content"},
+		{"missing structure", `{"title": "x"}`, "thinking_structure"},
+		{"blocks not array", `{"thinking_structure": {"blocks": {}}}`, "thinking_structure.blocks"},
+		{"text wrong type", `{"thinking_structure": {"blocks": [{"id": "a", "type": "thinking_why", "text": 3}]}}`, "thinking_structure.blocks[0].text"},
+		{"missing id", `{"thinking_structure": {"blocks": [{"type": "thinking_why"}]}}`, "thinking_structure.blocks[0].id"},
+		{"duplicate id", `{"thinking_structure": {"blocks": [{"id": "a", "type": "thinking_why"}, {"id": "a", "type": "thinking_how"}]}}`, "thinking_structure.blocks[1].id"},
+		{"unknown thinking type", `{"thinking_structure": {"blocks": [{"id": "a", "type": "thinking_maybe"}]}}`, "thinking_structure.blocks[0].type"},
+		{"malformed type", `{"thinking_structure": {"blocks": [{"id": "a", "type": "<script>"}]}}`, "thinking_structure.blocks[0].type"},
+		{"dangling connection", `{"thinking_structure": {"blocks": [{"id": "a", "type": "thinking_why", "connections": ["z"]}]}}`, "thinking_structure.blocks[0].connections[0]"},
+		{"self connection", `{"thinking_structure": {"blocks": [{"id": "a", "type": "thinking_why", "connections": ["a"]}]}}`, "thinking_structure.blocks[0].connections[0]"},
+		{"unknown parent", `{"thinking_structure": {"blocks": [{"id": "a", "type": "thinking_why", "parent": "z"}]}}`, "thinking_structure.blocks[0].parent"},
+		{"parent cycle", `{"thinking_structure": {"blocks": [{"id": "a", "type": "thinking_why", "parent": "b"}, {"id": "b", "type": "thinking_how", "parent": "a"}]}}`, "thinking_structure.blocks[1].parent"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, appErr := thinking.Parse([]byte(tc.raw))
+			if !assert.NotNil(t, appErr) {
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, appErr.Code)
+
+			fields := make([]string, 0, len(appErr.Fields))
+			for _, f := range appErr.Fields {
+				fields = append(fields, f.Field)
+			}
+			assert.Contains(t, fields, tc.field)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package thinking
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"thinking-blocks-backend/utils"
+)
+
+// 思考ブロックの種類
+const (
+	TypeWhy     = "thinking_why"
+	TypeHow     = "thinking_how"
+	TypeWhat    = "thinking_what"
+	TypeObserve = "thinking_observe"
+	TypeReflect = "thinking_reflect"
+	TypeConnect = "thinking_connect"
+)
+
+// ThinkingTypePrefix - 思考ブロックの種類に共通する接頭辞
+const ThinkingTypePrefix = "thinking_"
+
+// KnownThinkingTypes - エディタが定義している思考ブロック
+var KnownThinkingTypes = map[string]bool{
+	TypeWhy:     true,
+	TypeHow:     true,
+	TypeWhat:    true,
+	TypeObserve: true,
+	TypeReflect: true,
+	TypeConnect: true,
+}
+
+// プロジェクトのテーマ
+const (
+	ThemeCreative      = "creative"
+	ThemeIntrospection = "introspection"
+	ThemeResearch      = "research"
+	ThemeEducation     = "education"
+)
+
+// DefaultTheme - テーマ未指定時のテーマ
+const DefaultTheme = ThemeCreative
+
+// KnownThemes - エディタが定義しているテーマ
+var KnownThemes = map[string]bool{
+	ThemeCreative:      true,
+	ThemeIntrospection: true,
+	ThemeResearch:      true,
+	ThemeEducation:     true,
+}
+
+// ドキュメントの上限
+const (
+	MaxBlocks     = 5000
+	MaxTextLength = 10000
+	MaxIDLength   = 128
+)
+
+// エディタのユーティリティブロック（event_start, math_round など）の型名
+var blockTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Validate - ドキュメントの整合性を検証
+// thinking_ で始まる型は既知の思考ブロックのみ、それ以外はエディタのブロック名として妥当な形式のみ許可
+func (d *Document) Validate() *utils.AppError {
+	var errs fieldErrors
+
+	ids := make(map[string]bool, len(d.ThinkingStructure.Blocks))
+	for i, block := range d.ThinkingStructure.Blocks {
+		path := fmt.Sprintf("thinking_structure.blocks[%d]", i)
+		if errs.block(path, block) {
+			if ids[block.ID] {
+				errs.add(path+".id", "duplicate block id "+block.ID)
+			}
+			ids[block.ID] = true
+		}
+	}
+
+	// 接続先は同じドキュメント内の別ブロックであること
+	for i, block := range d.ThinkingStructure.Blocks {
+		for j, target := range block.Connections {
+			path := fmt.Sprintf("thinking_structure.blocks[%d].connections[%d]", i, j)
+			switch {
+			case target == block.ID:
+				errs.add(path, "must not connect a block to itself")
+			case !ids[target]:
+				errs.add(path, "references unknown block "+target)
+			}
+		}
+	}
+
+	// 親は同じドキュメント内の別ブロックで、親をたどって循環しないこと
+	parents := make(map[string]string, len(d.ThinkingStructure.Blocks))
+	for i, block := range d.ThinkingStructure.Blocks {
+		if block.Parent == "" {
+			continue
+		}
+		path := fmt.Sprintf("thinking_structure.blocks[%d].parent", i)
+		switch {
+		case block.Parent == block.ID:
+			errs.add(path, "must not be the block itself")
+		case !ids[block.Parent]:
+			errs.add(path, "references unknown block "+block.Parent)
+		default:
+			parents[block.ID] = block.Parent
+		}
+	}
+	for i, block := range d.ThinkingStructure.Blocks {
+		if inCycle(parents, block.ID) {
+			errs.add(fmt.Sprintf("thinking_structure.blocks[%d].parent", i), "must not form a cycle")
+		}
+	}
+
+	return errs.appError()
+}
+
+// ValidateBlock - 1つのブロックのID・型・テキスト・座標・深さを検証（接続と親は含まない）
+func ValidateBlock(block Block) *utils.AppError {
+	var errs fieldErrors
+	errs.block("block", block)
+	return errs.appError()
+}
+
+// ValidateType - ブロックの型を検証。不正な場合は理由を返す
+func ValidateType(blockType string) string {
+	if blockType == "" {
+		return "is required"
+	}
+	if strings.HasPrefix(blockType, ThinkingTypePrefix) {
+		if !KnownThinkingTypes[blockType] {
+			return "unknown thinking block type " + blockType
+		}
+		return ""
+	}
+	if !blockTypePattern.MatchString(blockType) {
+		return "must be a lowercase block type name"
+	}
+	return ""
+}
+
+// ValidPosition - 座標が有限か
+func ValidPosition(position Position) bool {
+	return finite(position.X) && finite(position.Y)
+}
+
+// block - ブロック単体の検証。IDが妥当なら true
+func (e *fieldErrors) block(path string, block Block) bool {
+	validID := false
+	switch {
+	case block.ID == "":
+		e.add(path+".id", "is required")
+	case len(block.ID) > MaxIDLength:
+		e.add(path+".id", fmt.Sprintf("must be at most %d characters", MaxIDLength))
+	default:
+		validID = true
+	}
+
+	if msg := ValidateType(block.Type); msg != "" {
+		e.add(path+".type", msg)
+	}
+
+	if utf8.RuneCountInString(block.Text) > MaxTextLength {
+		e.add(path+".text", fmt.Sprintf("must be at most %d characters", MaxTextLength))
+	}
+
+	if !ValidPosition(block.Position) {
+		e.add(path+".position", "must be finite coordinates")
+	}
+
+	if block.Depth < 0 {
+		e.add(path+".depth", "must not be negative")
+	}
+	return validID
+}
+
+// inCycle - 親をたどって id 自身に戻るか
+func inCycle(parents map[string]string, id string) bool {
+	seen := map[string]bool{}
+	for current, ok := parents[id]; ok; current, ok = parents[current] {
+		if current == id {
+			return true
+		}
+		if seen[current] {
+			return false
+		}
+		seen[current] = true
+	}
+	return false
+}
+
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
@@ -17,17 +17,31 @@ var (
 	ErrServiceUnavailable = errors.New("service unavailable")
 )
 
+// FieldError - 入力フィールド単位の検証エラー
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
 // AppError - アプリケーションエラー
 type AppError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Code      int          `json:"code"`
+	Message   string       `json:"message"`
+	Details   string       `json:"details,omitempty"`
+	ErrorCode string       `json:"error_code,omitempty"` // クライアントが分岐に使う機械可読なコード
+	Fields    []FieldError `json:"fields,omitempty"`
 }
 
 func (e *AppError) Error() string {
 	return e.Message
 }
 
+// WithErrorCode - 機械可読なエラーコードを付与
+func (e *AppError) WithErrorCode(errorCode string) *AppError {
+	e.ErrorCode = errorCode
+	return e
+}
+
 // NewAppError - 新しいアプリケーションエラーを作成
 func NewAppError(code int, message string, details string) *AppError {
 	return &AppError{
@@ -62,22 +76,33 @@ func NewConflictError(details string) *AppError {
 	return NewAppError(http.StatusConflict, "Resource conflict", details)
 }
 
+// NewValidationError - フィールド単位の検証エラー
+func NewValidationError(details string, fields []FieldError) *AppError {
+	err := NewAppError(http.StatusBadRequest, "Validation failed", details)
+	err.Fields = fields
+	return err
+}
+
 // ErrorResponse - エラーレスポンス構造
 type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
-	Details string `json:"details,omitempty"`
-	Code    int    `json:"code"`
+	Success   bool         `json:"success"`
+	Error     string       `json:"error"`
+	Details   string       `json:"details,omitempty"`
+	Code      int          `json:"code"`
+	ErrorCode string       `json:"error_code,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
 }
 
 // NewErrorResponse - エラーレスポンスを作成
 func NewErrorResponse(err error) *ErrorResponse {
 	if appErr, ok := err.(*AppError); ok {
 		return &ErrorResponse{
-			Success: false,
-			Error:   appErr.Message,
-			Details: appErr.Details,
-			Code:    appErr.Code,
+			Success:   false,
+			Error:     appErr.Message,
+			Details:   appErr.Details,
+			Code:      appErr.Code,
+			ErrorCode: appErr.ErrorCode,
+			Fields:    appErr.Fields,
 		}
 	}
 
@@ -2,10 +2,15 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -23,35 +28,111 @@ const (
 	maxMessageSize = 512 * 1024 // 512KB
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 本番環境では適切なオリジンチェックを実装
-	},
+// newUpgrader returns an upgrader that accepts browser connections only from
+// the allowed origins or the server's own origin. Requests without an Origin
+// header do not come from a browser and are accepted; "*" allows any origin.
+func newUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			return originAllowed(r, allowedOrigins)
+		},
+	}
+}
+
+func originAllowed(r *http.Request, allowedOrigins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
 // Client is a middleman between the websocket connection and the hub.
 type Client struct {
-	hub       *Hub
-	conn      *websocket.Conn
-	send      chan []byte
-	projectID string
+	hub         *Hub
+	conn        *websocket.Conn
+	send        chan []byte
+	id          string
+	projectID   string
+	participant Participant
+	readOnly    bool
+	resume      *Resume
+	authorize   func() (bool, error)
+
+	// closed is closed when the connection is gone.
+	closed chan struct{}
+}
+
+// JoinOptions describes what a connecting client is allowed to do.
+type JoinOptions struct {
+	// ReadOnly clients receive broadcasts but their mutating messages are rejected.
+	ReadOnly bool
+	// Resume is where a reconnecting client left off; nil joins from a snapshot.
+	Resume *Resume
+	// Participant is the authenticated identity, shown to the other clients
+	// of the project and set as the user_id of every message the client sends.
+	Participant Participant
+	// Authorize re-checks access every access interval while the client is
+	// connected. It returns whether the client is read-only now, or an error
+	// once it may no longer see the project. Nil never re-checks.
+	Authorize func() (readOnly bool, err error)
+}
+
+// Resume identifies the last op a reconnecting client applied.
+type Resume struct {
+	Session string
+	Seq     uint64
+}
+
+// ParseResume reads the session and since query parameters of a
+// reconnecting client. It returns nil when session is absent.
+func ParseResume(query url.Values) (*Resume, error) {
+	session := query.Get("session")
+	if session == "" {
+		return nil, nil
+	}
+	seq, err := strconv.ParseUint(query.Get("since"), 10, 64)
+	if err != nil {
+		return nil, errors.New("since must be the seq of the last applied op")
+	}
+	return &Resume{Session: session, Seq: seq}, nil
+}
+
+// readOnlyTypes are the message types a read-only client may send. They
+// only share the client's awareness state and never change the document.
+var readOnlyTypes = map[string]bool{
+	TypeCursor:   true,
+	TypeSelect:   true,
+	TypePresence: true,
 }
 
 // HandleWebSocket handles websocket requests from the peer.
-func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request, projectID string) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request, projectID string, opts JoinOptions) {
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
 	client := &Client{
-		hub:       hub,
-		conn:      conn,
-		send:      make(chan []byte, 256),
-		projectID: projectID,
+		hub:         hub,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		id:          uuid.New().String(),
+		projectID:   projectID,
+		participant: opts.Participant,
+		readOnly:    opts.ReadOnly,
+		resume:      opts.Resume,
+		authorize:   opts.Authorize,
+		closed:      make(chan struct{}),
 	}
 	client.hub.register <- client
 
@@ -59,11 +140,38 @@ func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request, projectID
 	// new goroutines.
 	go client.writePump()
 	go client.readPump()
+	if client.authorize != nil && hub.accessInterval > 0 {
+		go client.watchAccess()
+	}
+}
+
+// watchAccess re-checks the client's access every access interval and
+// reports it to the hub until the client disconnects.
+func (c *Client) watchAccess() {
+	ticker := time.NewTicker(c.hub.accessInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			readOnly, err := c.authorize()
+			select {
+			case c.hub.access <- accessChange{client: c, readOnly: readOnly, err: err}:
+			case <-c.closed:
+				return
+			case <-c.hub.done:
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
 }
 
 // readPump pumps messages from the websocket connection to the hub.
 func (c *Client) readPump() {
 	defer func() {
+		close(c.closed)
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
@@ -90,10 +198,35 @@ func (c *Client) readPump() {
 			continue
 		}
 
+		// Clients cannot speak for another user.
+		message.UserID = c.participant.UserID
 		message.ProjectID = c.projectID
 		message.Timestamp = time.Now().Unix()
+		message.Seq = 0
+
+		c.hub.inbound <- inboundMessage{client: c, message: message}
+	}
+}
+
+// sendMessage queues a message for this client only. It is called from the
+// hub goroutine and drops the message if the client is not keeping up.
+func (c *Client) sendMessage(message Message, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+	message.Data = payload
+
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
 
-		c.hub.broadcast <- message
+	select {
+	case c.send <- messageBytes:
+	default:
 	}
 }
 
@@ -2,15 +2,82 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"time"
+
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/crdt"
+	"thinking-blocks-backend/thinking"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 )
 
-// Hub maintains the set of active clients and broadcasts messages to the clients.
+// Message types handled by the hub itself. Clients may only send the types
+// the hub handles or relays; the others are sent by the hub alone.
+const (
+	TypeOp         = "op"
+	TypeOpRejected = "op_rejected"
+	TypeError      = "error"
+
+	// TypeSnapshot and TypeCatchUp are the first message a client receives
+	// after joining: the whole document, or the ops it missed since the seq
+	// it resumed from.
+	TypeSnapshot = "snapshot"
+	TypeCatchUp  = "catch_up"
+
+	// TypeUpdate is the legacy whole-document message. It is rejected because
+	// relaying it lets replicas diverge; clients send ops instead.
+	TypeUpdate = "update"
+
+	// TypeComment is a chat message relayed as-is to every client of the
+	// project. It is the only type the hub relays without handling it.
+	TypeComment = "comment"
+)
+
+// Store loads and saves the documents edited through the hub, together with
+// the version of the stored document. SaveDocument only writes when the
+// stored version is still the given one and returns the new version;
+// otherwise it returns ErrVersionConflict, so changes saved outside the hub
+// are merged instead of overwritten.
+type Store interface {
+	LoadDocument(projectID string) (*thinking.Document, int, error)
+	SaveDocument(projectID string, content []byte, version int) (int, error)
+}
+
+// ErrVersionConflict is returned by Store.SaveDocument when the document was
+// saved by someone else since the version the hub last loaded or saved.
+var ErrVersionConflict = errors.New("document was modified outside the session")
+
+// maxSaveAttempts bounds how often a session merges changes saved outside
+// it and retries right away; after that it waits for the next persist tick.
+const maxSaveAttempts = 3
+
+// Hub maintains the set of active clients and the document each project is
+// editing. All state is owned by the Run goroutine, which merges operations
+// into a per-project CRDT replica in the order it receives them. Documents
+// are loaded and saved on other goroutines, which report back to Run, so a
+// slow store does not hold up the other projects.
 type Hub struct {
-	// Registered clients.
-	clients map[string]map[*Client]bool
+	// Open editing sessions by project.
+	sessions map[string]*session
+
+	// Clients waiting for their project to load, by project.
+	loading map[string][]*Client
+
+	// Results of loads and saves running in the background.
+	loaded chan loadResult
+	saved  chan saveResult
+
+	// Number of saves running in the background.
+	saving int
 
 	// Inbound messages from the clients.
+	inbound chan inboundMessage
+
+	// Server-originated messages for all clients of a project.
 	broadcast chan Message
 
 	// Register requests from the clients.
@@ -18,6 +85,101 @@ type Hub struct {
 
 	// Unregister requests from clients.
 	unregister chan *Client
+
+	// Results of re-checking the access of connected clients.
+	access chan accessChange
+
+	upgrader        *websocket.Upgrader
+	store           Store
+	persistInterval time.Duration
+	opLogSize       int
+	cursorInterval  time.Duration
+	accessInterval  time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// hubReplica is the replica id of the documents merged by the hub.
+const hubReplica = "hub"
+
+// session is the live state of one project.
+type session struct {
+	// id identifies this session; seq restarts from 0 when a project is
+	// reopened, so clients resume only within the same session.
+	id        string
+	projectID string
+	clients   map[*Client]*presence
+	joins     uint64             // number of clients that have joined, for presence order
+	structure thinking.Structure // metadata of the loaded document, without blocks
+	replica   *crdt.Replica
+	// log holds the latest ops with the replica clock after each, so the CRDT
+	// ops a client had seen at a given seq can be told apart from later ones.
+	log   *opLog
+	seq   uint64 // sequence number of the last accepted op
+	dirty bool   // replica has ops that are not saved yet
+
+	saving    bool // a save is running in the background
+	conflicts int  // saves in a row that found changes saved outside the session
+
+	// stored is the document as last loaded from or saved to the store.
+	stored storedState
+}
+
+// storedState describes the stored document a session is based on, so that
+// changes saved outside the session can be merged into the replica.
+type storedState struct {
+	doc     *thinking.Document
+	version int
+	// clock and ops are the replica ops the stored document contains: all
+	// ops up to clock, plus ops merged in from the store since.
+	clock uint64
+	ops   map[crdt.ID]bool
+}
+
+// seen reports whether the stored document contains a replica op.
+func (st *storedState) seen(id crdt.ID) bool {
+	return id.Counter <= st.clock || st.ops[id]
+}
+
+type inboundMessage struct {
+	client  *Client
+	message Message
+}
+
+// accessChange is the outcome of re-checking a client's access. A non-nil
+// err means the client may no longer see the project.
+type accessChange struct {
+	client   *Client
+	readOnly bool
+	err      error
+}
+
+// loadResult is the outcome of loading a project's document.
+type loadResult struct {
+	projectID string
+	doc       *thinking.Document
+	version   int
+	err       error
+}
+
+// saveJob is a document to save, taken from a session at seq.
+type saveJob struct {
+	session *session
+	doc     *thinking.Document
+	seq     uint64
+	clock   uint64
+	version int
+}
+
+// saveResult is the outcome of a saveJob. When the stored version had moved
+// on, stored and storedVersion hold the document saved outside the session.
+type saveResult struct {
+	saveJob
+	version       int
+	err           error
+	stored        *thinking.Document
+	storedVersion int
 }
 
 type Message struct {
@@ -26,62 +188,504 @@ type Message struct {
 	UserID    string          `json:"user_id"`
 	Data      json.RawMessage `json:"data"`
 	Timestamp int64           `json:"timestamp"`
+	Seq       uint64          `json:"seq,omitempty"`
+}
+
+// snapshot is the payload of snapshot messages.
+// ClientID is the presence id the hub gave the receiving client.
+type snapshot struct {
+	Session  string             `json:"session"`
+	ClientID string             `json:"client_id"`
+	Seq      uint64             `json:"seq"`
+	Document *thinking.Document `json:"document"`
+}
+
+// catchUp is the payload of catch_up messages.
+type catchUp struct {
+	Session  string    `json:"session"`
+	ClientID string    `json:"client_id"`
+	Seq      uint64    `json:"seq"`
+	Ops      []Message `json:"ops"`
 }
 
-func NewHub() *Hub {
+// rejection is the payload of op_rejected and error messages.
+type rejection struct {
+	ClientOpID string `json:"client_op_id,omitempty"`
+	Error      string `json:"error"`
+}
+
+// NewHub creates a hub that loads and saves documents through store. A nil
+// store starts every project from an empty document and never saves. A
+// negative OpLogSize keeps no ops, so rejoining clients get a snapshot.
+func NewHub(store Store, cfg config.CollaborationConfig) *Hub {
 	return &Hub{
-		broadcast:  make(chan Message),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[string]map[*Client]bool),
+		sessions:        make(map[string]*session),
+		loading:         make(map[string][]*Client),
+		loaded:          make(chan loadResult),
+		saved:           make(chan saveResult),
+		access:          make(chan accessChange),
+		inbound:         make(chan inboundMessage),
+		broadcast:       make(chan Message),
+		register:        make(chan *Client),
+		unregister:      make(chan *Client),
+		upgrader:        newUpgrader(cfg.AllowedOrigins),
+		store:           store,
+		persistInterval: cfg.PersistInterval,
+		opLogSize:       max(cfg.OpLogSize, 0),
+		cursorInterval:  cfg.CursorInterval,
+		accessInterval:  cfg.AccessInterval,
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
 	}
 }
 
 func (h *Hub) Run() {
+	defer close(h.done)
+
+	var persist <-chan time.Time
+	if h.persistInterval > 0 {
+		ticker := time.NewTicker(h.persistInterval)
+		defer ticker.Stop()
+		persist = ticker.C
+	}
+
+	var cursors <-chan time.Time
+	if h.cursorInterval > 0 {
+		ticker := time.NewTicker(h.cursorInterval)
+		defer ticker.Stop()
+		cursors = ticker.C
+	}
+
 	for {
 		select {
 		case client := <-h.register:
-			projectClients := h.clients[client.projectID]
-			if projectClients == nil {
-				projectClients = make(map[*Client]bool)
-				h.clients[client.projectID] = projectClients
+			if s, ok := h.sessions[client.projectID]; ok {
+				h.addClient(s, client)
+				continue
 			}
-			projectClients[client] = true
-			log.Printf("Client registered for project %s, total: %d", client.projectID, len(projectClients))
+			waiting, ok := h.loading[client.projectID]
+			h.loading[client.projectID] = append(waiting, client)
+			if !ok {
+				go h.load(client.projectID)
+			}
+
+		case result := <-h.loaded:
+			h.openSession(result)
+
+		case result := <-h.saved:
+			h.finishSave(result)
+
+		case change := <-h.access:
+			h.updateAccess(change)
 
 		case client := <-h.unregister:
-			if projectClients, ok := h.clients[client.projectID]; ok {
-				if _, ok := projectClients[client]; ok {
-					delete(projectClients, client)
-					close(client.send)
-					log.Printf("Client unregistered from project %s, remaining: %d", client.projectID, len(projectClients))
-
-					if len(projectClients) == 0 {
-						delete(h.clients, client.projectID)
-					}
-				}
+			if h.stopWaiting(client) {
+				continue
+			}
+			s, ok := h.sessions[client.projectID]
+			if !ok || s.clients[client] == nil {
+				continue
 			}
+			h.removeClient(s, client)
+			log.Printf("Client unregistered from project %s, remaining: %d", client.projectID, len(s.clients))
+			h.closeSessionIfIdle(s)
 
-		case message := <-h.broadcast:
-			projectClients := h.clients[message.ProjectID]
-			messageBytes, err := json.Marshal(message)
-			if err != nil {
-				log.Printf("Error marshaling message: %v", err)
+		case in := <-h.inbound:
+			s, ok := h.sessions[in.client.projectID]
+			if !ok || s.clients[in.client] == nil {
 				continue
 			}
+			h.handle(s, in.client, in.message)
+
+		case message := <-h.broadcast:
+			if s, ok := h.sessions[message.ProjectID]; ok {
+				h.broadcastTo(s, message)
+			}
+
+		case <-cursors:
+			h.flushCursors()
 
-			for client := range projectClients {
-				select {
-				case client.send <- messageBytes:
-				default:
-					close(client.send)
-					delete(projectClients, client)
-				}
+		case <-persist:
+			for _, s := range h.sessions {
+				h.save(s)
+				h.closeSessionIfIdle(s)
 			}
+
+		case <-h.stop:
+			h.shutdown()
+			return
+		}
+	}
+}
+
+// shutdown saves every session with unsaved ops and waits for the saves.
+// A save that was already running when ops arrived is followed by another.
+func (h *Hub) shutdown() {
+	for _, s := range h.sessions {
+		h.save(s)
+	}
+	for h.saving > 0 {
+		result := <-h.saved
+		h.finishSave(result)
+		if result.err == nil {
+			h.save(result.session)
+		}
+	}
+	for _, s := range h.sessions {
+		if s.dirty && h.store != nil {
+			log.Printf("Project %s closed with unsaved ops up to seq %d", s.projectID, s.seq)
 		}
 	}
 }
 
+// Close stops Run after saving every document with unsaved ops.
+func (h *Hub) Close() {
+	close(h.stop)
+	<-h.done
+}
+
 func (h *Hub) BroadcastMessage(message Message) {
 	h.broadcast <- message
 }
+
+// load reads a project's document for openSession.
+func (h *Hub) load(projectID string) {
+	result := loadResult{projectID: projectID, doc: &thinking.Document{}}
+	if h.store != nil {
+		result.doc, result.version, result.err = h.store.LoadDocument(projectID)
+	}
+	select {
+	case h.loaded <- result:
+	case <-h.done:
+	}
+}
+
+// openSession starts the session of a loaded project and adds the clients
+// that were waiting for it. If the load failed they are told and dropped.
+func (h *Hub) openSession(result loadResult) {
+	projectID := result.projectID
+	clients := h.loading[projectID]
+	delete(h.loading, projectID)
+
+	if result.err != nil {
+		log.Printf("Failed to load project %s: %v", projectID, result.err)
+		for _, client := range clients {
+			client.sendMessage(Message{ProjectID: projectID, Type: TypeError, Timestamp: time.Now().Unix()},
+				rejection{Error: "project could not be loaded"})
+			close(client.send)
+		}
+		return
+	}
+	if len(clients) == 0 {
+		return
+	}
+
+	doc, version := result.doc, result.version
+	replica := crdt.NewReplica(hubReplica)
+	replica.Load(doc)
+	structure := doc.ThinkingStructure
+	structure.Blocks = nil
+
+	s := &session{
+		id:        uuid.New().String(),
+		projectID: projectID,
+		clients:   make(map[*Client]*presence),
+		structure: structure,
+		replica:   replica,
+		log:       newOpLog(h.opLogSize, replica.Clock()),
+		stored:    storedState{doc: doc, version: version, clock: replica.Clock()},
+	}
+	h.sessions[projectID] = s
+	for _, client := range clients {
+		h.addClient(s, client)
+	}
+}
+
+// addClient joins client to the session and announces it to the others.
+func (h *Hub) addClient(s *session, client *Client) {
+	s.joins++
+	s.clients[client] = &presence{
+		ClientID:    client.id,
+		Participant: client.participant,
+		JoinedAt:    time.Now().Unix(),
+		joinOrder:   s.joins,
+	}
+	h.join(s, client)
+	h.announceJoin(s, client)
+	log.Printf("Client registered for project %s, total: %d", client.projectID, len(s.clients))
+}
+
+// updateAccess applies the re-checked access of a connected client. A client
+// that lost access is told and disconnected; otherwise it becomes read-only
+// or editable as its role now allows.
+func (h *Hub) updateAccess(change accessChange) {
+	client := change.client
+	s, ok := h.sessions[client.projectID]
+	if !ok || s.clients[client] == nil {
+		return
+	}
+	if change.err != nil {
+		log.Printf("Client of project %s lost access: %v", client.projectID, change.err)
+		client.sendMessage(Message{ProjectID: s.projectID, Type: TypeError, Timestamp: time.Now().Unix()},
+			rejection{Error: "access to the project was revoked"})
+		h.removeClient(s, client)
+		h.closeSessionIfIdle(s)
+		return
+	}
+	client.readOnly = change.readOnly
+}
+
+// stopWaiting drops a client that is still waiting for its project to load.
+func (h *Hub) stopWaiting(client *Client) bool {
+	waiting, ok := h.loading[client.projectID]
+	if !ok {
+		return false
+	}
+	for i, c := range waiting {
+		if c == client {
+			h.loading[client.projectID] = append(waiting[:i], waiting[i+1:]...)
+			close(client.send)
+			return true
+		}
+	}
+	return false
+}
+
+// join sends a new client the ops it missed when it resumes from a seq still
+// in the op log of the same session, and the whole document otherwise.
+func (h *Hub) join(s *session, client *Client) {
+	message := Message{ProjectID: s.projectID, Timestamp: time.Now().Unix()}
+
+	if resume := client.resume; resume != nil && resume.Session == s.id {
+		if ops, ok := s.log.since(resume.Seq); ok {
+			message.Type = TypeCatchUp
+			client.sendMessage(message, catchUp{Session: s.id, ClientID: client.id, Seq: s.seq, Ops: ops})
+			return
+		}
+	}
+
+	message.Type = TypeSnapshot
+	client.sendMessage(message, snapshot{Session: s.id, ClientID: client.id, Seq: s.seq, Document: s.document()})
+}
+
+// closeSessionIfIdle saves and drops a session once its last client leaves.
+// A session with a save running is dropped when the save finishes.
+func (h *Hub) closeSessionIfIdle(s *session) {
+	if len(s.clients) > 0 {
+		return
+	}
+	h.save(s)
+	if !s.dirty && !s.saving {
+		delete(h.sessions, s.projectID)
+	}
+}
+
+func (h *Hub) handle(s *session, client *Client, message Message) {
+	if client.readOnly && !readOnlyTypes[message.Type] {
+		var op Operation
+		if message.Type == TypeOp {
+			json.Unmarshal(message.Data, &op)
+		}
+		client.sendMessage(Message{ProjectID: s.projectID, Type: TypeOpRejected, Timestamp: time.Now().Unix()},
+			rejection{ClientOpID: op.ClientOpID, Error: "read-only access; only cursor, select and presence messages are allowed"})
+		return
+	}
+
+	switch message.Type {
+	case TypeOp:
+		h.applyOperation(s, client, message)
+	case TypeUpdate:
+		client.sendMessage(Message{ProjectID: s.projectID, Type: TypeOpRejected, Timestamp: time.Now().Unix()},
+			rejection{Error: "whole-document updates are not supported; send op messages"})
+	case TypeJoin, TypeLeave:
+		// Presence is tracked by the hub from the connection itself.
+	case TypeCursor:
+		h.updateCursor(s, client, message)
+	case TypeSelect:
+		h.updateSelection(s, client, message)
+	case TypePresence:
+		h.answerPresence(s, client)
+	case TypeComment:
+		h.broadcastTo(s, message)
+	default:
+		// snapshot, catch_up, op_rejected, error and unknown types: clients
+		// cannot speak for the server or relay arbitrary payloads.
+		client.sendMessage(Message{ProjectID: s.projectID, Type: TypeOpRejected, Timestamp: time.Now().Unix()},
+			rejection{Error: fmt.Sprintf("message type %q is not accepted", message.Type)})
+	}
+}
+
+// applyOperation merges an op into the session replica, assigns it the next
+// sequence number and broadcasts it to every client, including the sender as
+// its acknowledgement. Invalid ops are rejected to the sender only.
+func (h *Hub) applyOperation(s *session, client *Client, message Message) {
+	var op Operation
+	err := json.Unmarshal(message.Data, &op)
+	if err == nil {
+		var seen func(crdt.ID) bool
+		seen, err = s.seenAt(op.BaseSeq)
+		if err == nil {
+			_, err = h.commit(s, &op, seen, message)
+		}
+	}
+	if err != nil {
+		client.sendMessage(Message{ProjectID: s.projectID, Type: TypeOpRejected, Timestamp: message.Timestamp},
+			rejection{ClientOpID: op.ClientOpID, Error: err.Error()})
+	}
+}
+
+// commit merges op into the session replica and broadcasts it with the next
+// sequence number. message carries the sender and timestamp of the op.
+func (h *Hub) commit(s *session, op *Operation, seen func(crdt.ID) bool, message Message) ([]crdt.Op, error) {
+	applied, err := op.Apply(s.replica, seen)
+	if err != nil {
+		return nil, err
+	}
+
+	s.seq++
+	s.dirty = true
+	op.BaseSeq = nil
+
+	data, err := json.Marshal(op)
+	if err != nil {
+		log.Printf("Error marshaling op: %v", err)
+		return applied, nil
+	}
+	message.Type = TypeOp
+	message.Data = data
+	message.Seq = s.seq
+	s.log.append(message, s.replica.Clock())
+	h.broadcastTo(s, message)
+	return applied, nil
+}
+
+// seenAt reports which CRDT ops a client had seen when it had applied the op
+// with seq base. A nil base means every op.
+func (s *session) seenAt(base *uint64) (func(crdt.ID) bool, error) {
+	if base == nil {
+		return nil, nil
+	}
+	if *base > s.seq {
+		return nil, fmt.Errorf("base_seq %d is ahead of the session (seq %d)", *base, s.seq)
+	}
+	// All ops are made by the hub replica, so counters grow with seq.
+	limit, ok := s.log.clockAt(*base)
+	if !ok {
+		return nil, fmt.Errorf("base_seq %d is older than the op log; rejoin to get a snapshot", *base)
+	}
+	return func(id crdt.ID) bool { return id.Counter <= limit }, nil
+}
+
+// document materializes the replica with the metadata of the loaded document.
+func (s *session) document() *thinking.Document {
+	doc := s.replica.Document()
+	blocks := doc.ThinkingStructure.Blocks
+	doc.ThinkingStructure = s.structure
+	doc.ThinkingStructure.Blocks = blocks
+	return doc
+}
+
+func (h *Hub) broadcastTo(s *session, message Message) {
+	h.broadcastExcept(s, message, nil)
+}
+
+// broadcastExcept sends message to every client of the session except skip.
+// Clients that are not keeping up are dropped.
+func (h *Hub) broadcastExcept(s *session, message Message, skip *Client) {
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+
+	var dropped []*Client
+	for client := range s.clients {
+		if client == skip {
+			continue
+		}
+		select {
+		case client.send <- messageBytes:
+		default:
+			dropped = append(dropped, client)
+		}
+	}
+	for _, client := range dropped {
+		h.removeClient(s, client)
+	}
+}
+
+// save starts writing the document in the background if it has unsaved ops
+// and no save is running. finishSave handles the outcome.
+func (h *Hub) save(s *session) {
+	if h.store == nil {
+		s.dirty = false
+		return
+	}
+	if !s.dirty || s.saving {
+		return
+	}
+
+	job := saveJob{session: s, doc: s.document(), seq: s.seq, clock: s.replica.Clock(), version: s.stored.version}
+	s.saving = true
+	h.saving++
+	go func() {
+		result := h.write(job)
+		select {
+		case h.saved <- result:
+		case <-h.done:
+		}
+	}()
+}
+
+// write saves a job's document. When the document was saved outside the
+// session since the job's version, it reads that document instead so
+// finishSave can merge it.
+func (h *Hub) write(job saveJob) saveResult {
+	result := saveResult{saveJob: job}
+	content, err := job.doc.Marshal()
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.version, result.err = h.store.SaveDocument(job.session.projectID, content, job.version)
+	if errors.Is(result.err, ErrVersionConflict) {
+		stored, version, err := h.store.LoadDocument(job.session.projectID)
+		if err != nil {
+			result.err = fmt.Errorf("reload after conflict: %w", err)
+			return result
+		}
+		result.stored, result.storedVersion = stored, version
+	}
+	return result
+}
+
+// finishSave records the outcome of a save. Changes saved outside the
+// session are merged into the replica and saved again right away, a few
+// times at most; on other failures the session stays dirty so the next tick
+// retries.
+func (h *Hub) finishSave(result saveResult) {
+	s := result.session
+	s.saving = false
+	h.saving--
+
+	switch {
+	case result.err == nil:
+		s.stored = storedState{doc: result.doc, version: result.version, clock: result.clock}
+		s.conflicts = 0
+		if s.seq == result.seq {
+			s.dirty = false
+		}
+	case result.stored != nil:
+		h.mergeStored(s, result.stored, result.storedVersion)
+		s.conflicts++
+		if s.conflicts < maxSaveAttempts {
+			h.save(s)
+		}
+	default:
+		log.Printf("Failed to save project %s at seq %d: %v", s.projectID, result.seq, result.err)
+	}
+
+	if h.sessions[s.projectID] == s {
+		h.closeSessionIfIdle(s)
+	}
+}
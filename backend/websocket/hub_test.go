@@ -0,0 +1,453 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"thinking-blocks-backend/config"
+	"thinking-blocks-backend/thinking"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a Store that keeps the last saved content per project.
+type memoryStore struct {
+	mu       sync.Mutex
+	saved    map[string][]byte
+	versions map[string]int
+	saves    int
+}
+
+func (s *memoryStore) LoadDocument(projectID string) (*thinking.Document, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if content, ok := s.saved[projectID]; ok {
+		doc, appErr := thinking.Parse(content)
+		if appErr != nil {
+			return nil, 0, appErr
+		}
+		return doc, s.versions[projectID], nil
+	}
+	return &thinking.Document{}, s.versions[projectID], nil
+}
+
+func (s *memoryStore) SaveDocument(projectID string, content []byte, version int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.versions[projectID] != version {
+		return 0, ErrVersionConflict
+	}
+	s.saves++
+	return s.write(projectID, content), nil
+}
+
+// write stores content as a save from outside the hub would.
+func (s *memoryStore) write(projectID string, content []byte) int {
+	if s.versions == nil {
+		s.versions = map[string]int{}
+	}
+	s.saved[projectID] = content
+	s.versions[projectID]++
+	return s.versions[projectID]
+}
+
+func (s *memoryStore) content(projectID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return string(s.saved[projectID])
+}
+
+// testPeer is a websocket client that splits batched frames into messages.
+type testPeer struct {
+	t       *testing.T
+	conn    *gorilla.Conn
+	pending []Message
+	joined  Message // snapshot or catch_up received on join
+}
+
+func dialPeer(t *testing.T, server *httptest.Server) *testPeer {
+	return dialPeerWithQuery(t, server, "")
+}
+
+func dialPeerWithQuery(t *testing.T, server *httptest.Server, query string) *testPeer {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + query
+	conn, _, err := gorilla.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	p := &testPeer{t: t, conn: conn}
+	p.joined = p.next()
+	return p
+}
+
+func (p *testPeer) send(messageType string, data interface{}) {
+	p.t.Helper()
+	payload, _ := json.Marshal(data)
+	require.NoError(p.t, p.conn.WriteJSON(Message{Type: messageType, Data: payload}))
+}
+
+func (p *testPeer) next() Message {
+	p.t.Helper()
+	for len(p.pending) == 0 {
+		p.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, frame, err := p.conn.ReadMessage()
+		require.NoError(p.t, err)
+		for _, line := range bytes.Split(frame, []byte{'\n'}) {
+			var message Message
+			require.NoError(p.t, json.Unmarshal(line, &message))
+			p.pending = append(p.pending, message)
+		}
+	}
+	message := p.pending[0]
+	p.pending = p.pending[1:]
+	return message
+}
+
+func startHub(t *testing.T, store Store, projectID string) (*Hub, *httptest.Server) {
+	return startHubWithConfig(t, store, projectID, config.CollaborationConfig{PersistInterval: time.Hour, OpLogSize: 3})
+}
+
+func startHubWithConfig(t *testing.T, store Store, projectID string, cfg config.CollaborationConfig) (*Hub, *httptest.Server) {
+	t.Helper()
+	hub := NewHub(store, cfg)
+	go hub.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resume, err := ParseResume(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user := r.URL.Query().Get("user")
+		HandleWebSocket(hub, w, r, projectID, JoinOptions{
+			ReadOnly:    r.URL.Query().Get("read_only") == "true",
+			Resume:      resume,
+			Participant: Participant{UserID: user, Name: user, Color: "#E57373"},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return hub, server
+}
+
+func TestHubSequencesOperations(t *testing.T) {
+	store := &memoryStore{saved: map[string][]byte{}}
+	hub, server := startHub(t, store, "p1")
+
+	alice := dialPeer(t, server)
+	bob := dialPeer(t, server)
+	assert.Equal(t, TypeJoin, alice.next().Type)
+
+	alice.send(TypeOp, Operation{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy}, ClientOpID: "c1"})
+	for _, peer := range []*testPeer{alice, bob} {
+		message := peer.next()
+		assert.Equal(t, TypeOp, message.Type)
+		assert.Equal(t, uint64(1), message.Seq)
+		assert.Contains(t, string(message.Data), `"client_op_id":"c1"`)
+	}
+
+	// 不正な操作は送信者にだけ拒否を返し、シーケンス番号を進めない
+	bob.send(TypeOp, Operation{Op: OpMove, BlockID: "missing", Position: &thinking.Position{}, ClientOpID: "c2"})
+	rejected := bob.next()
+	assert.Equal(t, TypeOpRejected, rejected.Type)
+	assert.Contains(t, string(rejected.Data), `"client_op_id":"c2"`)
+
+	bob.send(TypeUpdate, map[string]interface{}{"blocks": []interface{}{}})
+	assert.Equal(t, TypeOpRejected, bob.next().Type)
+
+	bob.send(TypeOp, Operation{Op: OpSetText, BlockID: "a", Text: strPtr("共同編集")})
+	for _, peer := range []*testPeer{alice, bob} {
+		message := peer.next()
+		assert.Equal(t, TypeOp, message.Type)
+		assert.Equal(t, uint64(2), message.Seq)
+	}
+
+	// 終了時に編集中のドキュメントを保存する
+	hub.Close()
+	assert.Contains(t, store.content("p1"), "共同編集")
+	assert.Equal(t, 1, store.saves)
+}
+
+func TestHubWithoutOpLog(t *testing.T) {
+	_, server := startHubWithConfig(t, nil, "p1", config.CollaborationConfig{PersistInterval: time.Hour, OpLogSize: -1})
+
+	alice := dialPeer(t, server)
+	var joined snapshot
+	require.NoError(t, json.Unmarshal(alice.joined.Data, &joined))
+	alice.send(TypeOp, Operation{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy}})
+	assert.Equal(t, uint64(1), alice.next().Seq)
+
+	// 操作を保持しないので、再接続は差分ではなくスナップショットになる
+	bob := dialPeerWithQuery(t, server, fmt.Sprintf("?session=%s&since=0", joined.Session))
+	assert.Equal(t, TypeSnapshot, bob.joined.Type)
+}
+
+func TestHubPersistsWhenLastClientLeaves(t *testing.T) {
+	store := &memoryStore{saved: map[string][]byte{}}
+	_, server := startHub(t, store, "p1")
+
+	alice := dialPeer(t, server)
+	alice.send(TypeOp, Operation{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy, Text: "保存"}})
+	assert.Equal(t, uint64(1), alice.next().Seq)
+	alice.conn.Close()
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(store.content("p1"), "保存")
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// 次の参加者は保存済みの内容から編集を始める
+	bob := dialPeer(t, server)
+	bob.send(TypeOp, Operation{Op: OpConnect, BlockID: "a", Target: "a"})
+	assert.Equal(t, TypeOpRejected, bob.next().Type)
+	bob.send(TypeOp, Operation{Op: OpSetText, BlockID: "a", Text: strPtr("続き")})
+	assert.Equal(t, TypeOp, bob.next().Type)
+}
+
+func TestHubMergesTextEditsFromStaleClients(t *testing.T) {
+	_, server := startHub(t, nil, "p1")
+
+	alice := dialPeer(t, server)
+	alice.send(TypeOp, Operation{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy, Text: "考える"}})
+	assert.Equal(t, uint64(1), alice.next().Seq)
+	alice.send(TypeOp, Operation{Op: OpSetText, BlockID: "a", Text: strPtr("なぜ考える")})
+	assert.Equal(t, uint64(2), alice.next().Seq)
+
+	// seq 1 の時点のテキストを編集した変更は、seq 2 の挿入を残して取り込む
+	alice.send(TypeOp, Operation{Op: OpSetText, BlockID: "a", Text: strPtr("考えるのか"), BaseSeq: uint64Ptr(1)})
+	merged := alice.next()
+	assert.Equal(t, uint64(3), merged.Seq)
+	var op Operation
+	require.NoError(t, json.Unmarshal(merged.Data, &op))
+	assert.Equal(t, "なぜ考えるのか", *op.Text)
+	assert.Nil(t, op.BaseSeq)
+
+	alice.send(TypeOp, Operation{Op: OpSetText, BlockID: "a", Text: strPtr("x"), BaseSeq: uint64Ptr(9)})
+	assert.Equal(t, TypeOpRejected, alice.next().Type)
+}
+
+func TestHubSnapshotAndCatchUpOnJoin(t *testing.T) {
+	store := &memoryStore{saved: map[string][]byte{
+		"p1": []byte(`{"thinking_structure": {"theme": "research", "blocks": [{"id": "a", "type": "thinking_why", "text": "保存済み"}]}}`),
+	}}
+	_, server := startHub(t, store, "p1")
+
+	// 参加直後に現在のドキュメントとシーケンス番号を受け取る
+	alice := dialPeer(t, server)
+	assert.Equal(t, TypeSnapshot, alice.joined.Type)
+	var joined snapshot
+	require.NoError(t, json.Unmarshal(alice.joined.Data, &joined))
+	assert.NotEmpty(t, joined.Session)
+	assert.Equal(t, uint64(0), joined.Seq)
+	assert.Equal(t, "research", joined.Document.ThinkingStructure.Theme)
+	assert.Equal(t, "保存済み", joined.Document.Blocks()[0].Text)
+
+	for i, text := range []string{"一", "二", "三", "四"} {
+		alice.send(TypeOp, Operation{Op: OpSetText, BlockID: "a", Text: strPtr(text)})
+		assert.Equal(t, uint64(i+1), alice.next().Seq)
+	}
+
+	// ログに残っている位置から再接続すると、取りこぼした操作だけを受け取る
+	bob := dialPeerWithQuery(t, server, fmt.Sprintf("?session=%s&since=2", joined.Session))
+	assert.Equal(t, TypeCatchUp, bob.joined.Type)
+	var caught catchUp
+	require.NoError(t, json.Unmarshal(bob.joined.Data, &caught))
+	assert.Equal(t, uint64(4), caught.Seq)
+	if assert.Len(t, caught.Ops, 2) {
+		assert.Equal(t, uint64(3), caught.Ops[0].Seq)
+		assert.Equal(t, uint64(4), caught.Ops[1].Seq)
+	}
+
+	// ログから外れた位置や別のセッションからはスナップショットを受け取る
+	for _, query := range []string{
+		fmt.Sprintf("?session=%s&since=0", joined.Session),
+		fmt.Sprintf("?session=%s&since=9", joined.Session),
+		"?session=old&since=4",
+	} {
+		peer := dialPeerWithQuery(t, server, query)
+		assert.Equal(t, TypeSnapshot, peer.joined.Type, query)
+		require.NoError(t, json.Unmarshal(peer.joined.Data, &joined))
+		assert.Equal(t, uint64(4), joined.Seq)
+		assert.Equal(t, "四", joined.Document.Blocks()[0].Text)
+	}
+}
+
+func TestHubTracksPresence(t *testing.T) {
+	_, server := startHubWithConfig(t, nil, "p1", config.CollaborationConfig{CursorInterval: time.Hour})
+
+	alice := dialPeerWithQuery(t, server, "?user=alice")
+	var aliceJoined snapshot
+	require.NoError(t, json.Unmarshal(alice.joined.Data, &aliceJoined))
+	bob := dialPeerWithQuery(t, server, "?user=bob")
+
+	// 参加はサーバーが通知し、クライアントが送った join は配信しない
+	joined := alice.next()
+	assert.Equal(t, TypeJoin, joined.Type)
+	assert.Equal(t, "bob", joined.UserID)
+	var bobPresence presence
+	require.NoError(t, json.Unmarshal(joined.Data, &bobPresence))
+	assert.Equal(t, "bob", bobPresence.Name)
+	assert.Equal(t, "#E57373", bobPresence.Color)
+	assert.NotEmpty(t, bobPresence.ClientID)
+	bob.send(TypeJoin, map[string]string{"user_id": "mallory"})
+
+	// カーソルは間隔内の更新をまとめ、最初の更新だけをすぐに配信する
+	bob.send(TypeCursor, thinking.Position{X: 1, Y: 1})
+	bob.send(TypeCursor, thinking.Position{X: 2, Y: 2})
+	bob.send(TypeSelect, selection{BlockID: "a"})
+	cursor := alice.next()
+	assert.Equal(t, TypeCursor, cursor.Type)
+	assert.JSONEq(t, fmt.Sprintf(`{"client_id": %q, "x": 1, "y": 1}`, bobPresence.ClientID), string(cursor.Data))
+	assert.Equal(t, TypeSelect, alice.next().Type)
+
+	alice.send(TypePresence, nil)
+	here := alice.next()
+	assert.Equal(t, TypePresence, here.Type)
+	var list presenceList
+	require.NoError(t, json.Unmarshal(here.Data, &list))
+	if assert.Len(t, list.Clients, 2) {
+		assert.Equal(t, aliceJoined.ClientID, list.Clients[0].ClientID)
+		assert.Equal(t, "bob", list.Clients[1].Name)
+		assert.Equal(t, &thinking.Position{X: 2, Y: 2}, list.Clients[1].Cursor)
+		assert.Equal(t, "a", list.Clients[1].SelectedBlock)
+	}
+
+	// 切断したクライアントの退出もサーバーが通知する
+	bob.conn.Close()
+	left := alice.next()
+	assert.Equal(t, TypeLeave, left.Type)
+	assert.JSONEq(t, fmt.Sprintf(`{"client_id": %q, "user_id": "bob"}`, bobPresence.ClientID), string(left.Data))
+}
+
+func TestHubRelaysOnlyClientMessageTypes(t *testing.T) {
+	_, server := startHub(t, nil, "p1")
+
+	editor := dialPeer(t, server)
+	viewer := dialPeerWithQuery(t, server, "?read_only=true")
+	assert.Equal(t, TypeJoin, editor.next().Type)
+
+	// サーバーだけが送るメッセージは誰も送れない
+	for _, peer := range []*testPeer{viewer, editor} {
+		peer.send(TypeSnapshot, map[string]string{"content": "forged"})
+		assert.Equal(t, TypeOpRejected, peer.next().Type)
+	}
+
+	// 読み取り専用のクライアントはコメントも送れない
+	viewer.send(TypeComment, map[string]string{"text": "hi"})
+	assert.Equal(t, TypeOpRejected, viewer.next().Type)
+	viewer.send(TypeSelect, selection{BlockID: "a"})
+
+	// 編集者には偽のスナップショットもコメントも届かず、選択だけが届く
+	assert.Equal(t, TypeSelect, editor.next().Type)
+	editor.send(TypeComment, map[string]string{"text": "hi"})
+	assert.Equal(t, TypeComment, editor.next().Type)
+	assert.Equal(t, TypeComment, viewer.next().Type)
+}
+
+func TestHubFlushesThrottledCursors(t *testing.T) {
+	_, server := startHubWithConfig(t, nil, "p1", config.CollaborationConfig{CursorInterval: 20 * time.Millisecond})
+
+	alice := dialPeer(t, server)
+	bob := dialPeer(t, server)
+	assert.Equal(t, TypeJoin, alice.next().Type)
+
+	for i := 1; i <= 5; i++ {
+		bob.send(TypeCursor, thinking.Position{X: float64(i)})
+	}
+	var last cursorUpdate
+	for last.X != 5 {
+		message := alice.next()
+		require.Equal(t, TypeCursor, message.Type)
+		require.NoError(t, json.Unmarshal(message.Data, &last))
+	}
+}
+
+func TestHubMergesChangesSavedOutsideTheSession(t *testing.T) {
+	store := &memoryStore{saved: map[string][]byte{}}
+	store.write("p1", []byte(`{"thinking_structure": {"blocks": [{"id": "a", "type": "thinking_why", "text": "なぜ考える"}]}}`))
+	hub, server := startHub(t, store, "p1")
+
+	alice := dialPeer(t, server)
+	alice.send(TypeOp, Operation{Op: OpSetText, BlockID: "a", Text: strPtr("なぜ深く考える")})
+	assert.Equal(t, uint64(1), alice.next().Seq)
+
+	// セッション中にREST APIなどで保存された変更
+	store.mu.Lock()
+	store.write("p1", []byte(`{"thinking_structure": {"theme": "research", "blocks": [
+		{"id": "a", "type": "thinking_how", "text": "なぜ考えるのか", "position": {"x": 10, "y": 20}, "connections": ["b"]},
+		{"id": "b", "type": "thinking_what", "text": "追加", "parent": "a"}
+	]}}`))
+	store.mu.Unlock()
+
+	// 保存時に上書きせず、外部の変更をセッションの編集とマージしてから保存する
+	hub.Close()
+	doc, version, err := store.LoadDocument("p1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+	assert.Equal(t, "research", doc.ThinkingStructure.Theme)
+	a, ok := doc.Block("a")
+	require.True(t, ok)
+	assert.Equal(t, "なぜ深く考えるのか", a.Text)
+	assert.Equal(t, thinking.TypeHow, a.Type)
+	assert.Equal(t, thinking.Position{X: 10, Y: 20}, a.Position)
+	assert.Equal(t, []string{"b"}, a.Connections)
+	b, ok := doc.Block("b")
+	require.True(t, ok)
+	assert.Equal(t, "a", b.Parent)
+	assert.Equal(t, "追加", b.Text)
+
+	// マージした変更は操作として参加者にも届く
+	for seq := uint64(2); ; seq++ {
+		message := alice.next()
+		require.Equal(t, TypeOp, message.Type)
+		require.Equal(t, seq, message.Seq)
+		var op Operation
+		require.NoError(t, json.Unmarshal(message.Data, &op))
+		if op.Op == OpSetText {
+			assert.Equal(t, "なぜ深く考えるのか", *op.Text)
+			break
+		}
+	}
+}
+
+// blockingStore is a memoryStore whose saves wait until release is closed.
+type blockingStore struct {
+	*memoryStore
+	release chan struct{}
+}
+
+func (s *blockingStore) SaveDocument(projectID string, content []byte, version int) (int, error) {
+	<-s.release
+	return s.memoryStore.SaveDocument(projectID, content, version)
+}
+
+func TestHubKeepsServingWhileSaving(t *testing.T) {
+	store := &blockingStore{memoryStore: &memoryStore{saved: map[string][]byte{}}, release: make(chan struct{})}
+	hub, server := startHub(t, store, "p1")
+
+	alice := dialPeer(t, server)
+	alice.send(TypeOp, Operation{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy, Text: "保存中"}})
+	assert.Equal(t, uint64(1), alice.next().Seq)
+	alice.conn.Close()
+
+	// 保存が終わらなくても参加と編集を受け付ける
+	bob := dialPeer(t, server)
+	assert.Contains(t, string(bob.joined.Data), "保存中")
+	bob.send(TypeOp, Operation{Op: OpSetText, BlockID: "a", Text: strPtr("保存後")})
+	message := bob.next()
+	for message.Type != TypeOp {
+		message = bob.next() // alice の退出通知が先に届くことがある
+	}
+	assert.Equal(t, uint64(2), message.Seq)
+
+	close(store.release)
+	hub.Close()
+	assert.Contains(t, store.content("p1"), "保存後")
+}
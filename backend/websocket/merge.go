@@ -0,0 +1,84 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"thinking-blocks-backend/crdt"
+	"thinking-blocks-backend/thinking"
+)
+
+// mergeStored brings changes saved outside the session, such as REST
+// updates and restores, into the replica. The changes between the stored
+// document the session is based on and stored are committed as ops, so
+// clients receive them like any other edit. Text is merged against the text
+// the session had stored, keeping live edits made since; other fields take
+// the stored value. Changes to blocks deleted live are dropped.
+func (h *Hub) mergeStored(s *session, stored *thinking.Document, version int) {
+	message := Message{ProjectID: s.projectID, Timestamp: time.Now().Unix()}
+	for _, op := range storedOperations(s.stored.doc, stored) {
+		op := op
+		applied, err := h.commit(s, &op, s.stored.seen, message)
+		if err != nil {
+			log.Printf("Dropped stored change to project %s: %s %s: %v", s.projectID, op.Op, op.BlockID, err)
+			continue
+		}
+		if s.stored.ops == nil {
+			s.stored.ops = make(map[crdt.ID]bool)
+		}
+		for _, o := range applied {
+			s.stored.ops[o.ID] = true
+		}
+	}
+
+	s.structure = stored.ThinkingStructure
+	s.structure.Blocks = nil
+	s.stored.doc = stored
+	s.stored.version = version
+	s.dirty = true
+}
+
+// storedOperations returns the operations that turn from into to. Blocks are
+// created before they are linked and deleted last, so that every operation
+// refers to blocks that exist.
+func storedOperations(from, to *thinking.Document) []Operation {
+	diff := thinking.Compare(from, to)
+	var ops []Operation
+
+	for _, block := range diff.Added {
+		block.Parent = ""
+		block.Connections = nil
+		ops = append(ops, Operation{Op: OpCreate, BlockID: block.ID, Block: &block})
+	}
+	for _, move := range diff.Moved {
+		position := move.To
+		ops = append(ops, Operation{Op: OpMove, BlockID: move.ID, Position: &position})
+	}
+	for _, change := range diff.Retyped {
+		ops = append(ops, Operation{Op: OpSetType, BlockID: change.ID, Type: change.To})
+	}
+	for _, change := range diff.Retexted {
+		text := change.To
+		ops = append(ops, Operation{Op: OpSetText, BlockID: change.ID, Text: &text})
+	}
+	for _, block := range diff.Added {
+		if block.Parent != "" {
+			parent := block.Parent
+			ops = append(ops, Operation{Op: OpSetParent, BlockID: block.ID, Parent: &parent})
+		}
+	}
+	for _, change := range diff.Reparented {
+		parent := change.To
+		ops = append(ops, Operation{Op: OpSetParent, BlockID: change.ID, Parent: &parent})
+	}
+	for _, edge := range diff.ConnectionsRemoved {
+		ops = append(ops, Operation{Op: OpDisconnect, BlockID: edge.From, Target: edge.To})
+	}
+	for _, edge := range diff.ConnectionsAdded {
+		ops = append(ops, Operation{Op: OpConnect, BlockID: edge.From, Target: edge.To})
+	}
+	for _, block := range diff.Removed {
+		ops = append(ops, Operation{Op: OpDelete, BlockID: block.ID})
+	}
+	return ops
+}
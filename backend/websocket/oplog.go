@@ -0,0 +1,62 @@
+package websocket
+
+// opLog keeps the most recent accepted ops of a session so that reconnecting
+// clients can catch up without reloading the whole document.
+type opLog struct {
+	size    int
+	entries []loggedOp // oldest first, at most size
+
+	// startSeq and startClock describe the session just before entries[0].
+	startSeq   uint64
+	startClock uint64
+}
+
+type loggedOp struct {
+	message Message
+	clock   uint64 // replica clock after the op
+}
+
+func newOpLog(size int, clock uint64) *opLog {
+	return &opLog{size: size, startClock: clock}
+}
+
+// lastSeq is the seq of the last op appended.
+func (l *opLog) lastSeq() uint64 {
+	return l.startSeq + uint64(len(l.entries))
+}
+
+// append records an accepted op, dropping the oldest one when the log is full.
+func (l *opLog) append(message Message, clock uint64) {
+	l.entries = append(l.entries, loggedOp{message: message, clock: clock})
+	for len(l.entries) > l.size {
+		l.startSeq++
+		l.startClock = l.entries[0].clock
+		copy(l.entries, l.entries[1:])
+		l.entries = l.entries[:len(l.entries)-1]
+	}
+}
+
+// since returns the ops after seq. ok is false when seq is not covered by the
+// log, either because older ops were dropped or because seq is in the future.
+func (l *opLog) since(seq uint64) (ops []Message, ok bool) {
+	if seq < l.startSeq || seq > l.lastSeq() {
+		return nil, false
+	}
+	ops = make([]Message, 0, l.lastSeq()-seq)
+	for _, entry := range l.entries[seq-l.startSeq:] {
+		ops = append(ops, entry.message)
+	}
+	return ops, true
+}
+
+// clockAt returns the replica clock right after the op with the given seq.
+func (l *opLog) clockAt(seq uint64) (uint64, bool) {
+	switch {
+	case seq < l.startSeq || seq > l.lastSeq():
+		return 0, false
+	case seq == l.startSeq:
+		return l.startClock, true
+	default:
+		return l.entries[seq-l.startSeq-1].clock, true
+	}
+}
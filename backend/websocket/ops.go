@@ -0,0 +1,169 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+
+	"thinking-blocks-backend/crdt"
+	"thinking-blocks-backend/thinking"
+	"thinking-blocks-backend/utils"
+)
+
+// Operation kinds accepted in "op" messages.
+const (
+	OpCreate     = "create"
+	OpMove       = "move"
+	OpDelete     = "delete"
+	OpSetText    = "set_text"
+	OpSetType    = "set_type"
+	OpSetParent  = "set_parent"
+	OpConnect    = "connect"
+	OpDisconnect = "disconnect"
+)
+
+// Operation is a typed edit to a project's thinking_structure.
+type Operation struct {
+	Op      string `json:"op"`
+	BlockID string `json:"block_id"`
+
+	// Block is the new block for create.
+	Block *thinking.Block `json:"block,omitempty"`
+	// Position is the new position for move.
+	Position *thinking.Position `json:"position,omitempty"`
+	// Text is the new text for set_text. Accepted ops carry the merged text.
+	Text *string `json:"text,omitempty"`
+	// Type is the new block type for set_type.
+	Type string `json:"type,omitempty"`
+	// Parent is the new parent for set_parent; empty makes the block a root.
+	Parent *string `json:"parent,omitempty"`
+	// Target is the other end of the connection for connect and disconnect.
+	Target string `json:"target,omitempty"`
+
+	// BaseSeq is the seq of the last op the sender had applied when it made
+	// a set_text edit. Only the text it saw is replaced, so concurrent edits
+	// to other parts of the text are kept. Absent means the current text.
+	BaseSeq *uint64 `json:"base_seq,omitempty"`
+
+	// ClientOpID is an opaque id chosen by the sender and echoed back so it
+	// can match the accepted or rejected op to its local edit.
+	ClientOpID string `json:"client_op_id,omitempty"`
+}
+
+// Apply merges the operation into r. seen reports whether the sender had
+// observed a CRDT op when it made the edit; nil means it saw everything.
+// The operation is checked against r before it is applied, so invalid
+// operations return an error and leave r unchanged and the merged document
+// is always valid.
+func (op *Operation) Apply(r *crdt.Replica, seen func(crdt.ID) bool) ([]crdt.Op, error) {
+	if op.Op == OpCreate && op.BlockID == "" && op.Block != nil {
+		op.BlockID = op.Block.ID
+	}
+	if op.BlockID == "" {
+		return nil, errors.New("block_id is required")
+	}
+
+	if op.Op == OpCreate {
+		if op.Block == nil {
+			return nil, errors.New("block is required")
+		}
+		if r.Exists(op.BlockID) || r.Deleted(op.BlockID) {
+			return nil, fmt.Errorf("block %s already exists", op.BlockID)
+		}
+		block := *op.Block
+		block.ID = op.BlockID
+		if appErr := thinking.ValidateBlock(block); appErr != nil {
+			return nil, fieldError(appErr)
+		}
+		if block.Parent != "" && !r.Exists(block.Parent) {
+			return nil, fmt.Errorf("parent %s does not exist", block.Parent)
+		}
+		for _, target := range block.Connections {
+			if target == block.ID || !r.Exists(target) {
+				return nil, fmt.Errorf("cannot connect to block %s", target)
+			}
+		}
+		return r.CreateBlock(block), nil
+	}
+
+	if !r.Exists(op.BlockID) {
+		return nil, fmt.Errorf("block %s does not exist", op.BlockID)
+	}
+
+	switch op.Op {
+	case OpMove:
+		switch {
+		case op.Position == nil:
+			return nil, errors.New("position is required")
+		case !thinking.ValidPosition(*op.Position):
+			return nil, errors.New("position must be finite coordinates")
+		}
+		return []crdt.Op{r.Move(op.BlockID, *op.Position)}, nil
+	case OpSetText:
+		if op.Text == nil {
+			return nil, errors.New("text is required")
+		}
+		if r.TextLength(op.BlockID, *op.Text, seen) > thinking.MaxTextLength {
+			return nil, fmt.Errorf("text must be at most %d characters", thinking.MaxTextLength)
+		}
+		ops := r.EditText(op.BlockID, *op.Text, seen)
+		text := r.Text(op.BlockID)
+		op.Text = &text
+		return ops, nil
+	case OpSetType:
+		if msg := thinking.ValidateType(op.Type); msg != "" {
+			return nil, fmt.Errorf("type %s", msg)
+		}
+		return []crdt.Op{r.SetType(op.BlockID, op.Type)}, nil
+	case OpSetParent:
+		switch {
+		case op.Parent == nil:
+			return nil, errors.New("parent is required")
+		case *op.Parent == op.BlockID:
+			return nil, errors.New("a block cannot be its own parent")
+		case *op.Parent != "" && !r.Exists(*op.Parent):
+			return nil, fmt.Errorf("parent %s does not exist", *op.Parent)
+		case isAncestor(r, op.BlockID, *op.Parent):
+			return nil, errors.New("parent would form a cycle")
+		}
+		return []crdt.Op{r.SetParent(op.BlockID, *op.Parent)}, nil
+	case OpConnect:
+		switch {
+		case op.Target == "":
+			return nil, errors.New("target is required")
+		case op.Target == op.BlockID:
+			return nil, errors.New("cannot connect a block to itself")
+		case !r.Exists(op.Target):
+			return nil, fmt.Errorf("block %s does not exist", op.Target)
+		}
+		return []crdt.Op{r.Connect(op.BlockID, op.Target)}, nil
+	case OpDisconnect:
+		if op.Target == "" {
+			return nil, errors.New("target is required")
+		}
+		return []crdt.Op{r.Disconnect(op.BlockID, op.Target)}, nil
+	case OpDelete:
+		return []crdt.Op{r.DeleteBlock(op.BlockID)}, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// isAncestor reports whether id is on the parent chain starting at block.
+func isAncestor(r *crdt.Replica, id, block string) bool {
+	visited := map[string]bool{}
+	for current := block; current != "" && !visited[current]; current = r.Parent(current) {
+		if current == id {
+			return true
+		}
+		visited[current] = true
+	}
+	return false
+}
+
+// fieldError reports the first field of a validation error.
+func fieldError(appErr *utils.AppError) error {
+	if len(appErr.Fields) > 0 {
+		return fmt.Errorf("%s %s", appErr.Fields[0].Field, appErr.Fields[0].Message)
+	}
+	return appErr
+}
@@ -0,0 +1,138 @@
+package websocket
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"thinking-blocks-backend/crdt"
+	"thinking-blocks-backend/thinking"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func strPtr(s string) *string { return &s }
+
+func uint64Ptr(n uint64) *uint64 { return &n }
+
+func TestOperationApply(t *testing.T) {
+	r := crdt.NewReplica(hubReplica)
+
+	ops := []Operation{
+		{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy, Text: "なぜ"}},
+		{Op: OpCreate, BlockID: "b", Block: &thinking.Block{Type: thinking.TypeHow}},
+		{Op: OpMove, BlockID: "b", Position: &thinking.Position{X: 10, Y: 20}},
+		{Op: OpSetText, BlockID: "b", Text: strPtr("どうやって")},
+		{Op: OpSetParent, BlockID: "b", Parent: strPtr("a")},
+		{Op: OpConnect, BlockID: "a", Target: "b"},
+		{Op: OpConnect, BlockID: "a", Target: "b"},
+	}
+	for _, op := range ops {
+		op := op
+		_, err := op.Apply(r, nil)
+		assert.NoError(t, err, op.Op)
+	}
+
+	doc := r.Document()
+	b, _ := doc.Block("b")
+	assert.Equal(t, thinking.Position{X: 10, Y: 20}, b.Position)
+	assert.Equal(t, "どうやって", b.Text)
+	assert.Equal(t, "a", b.Parent)
+	a, _ := doc.Block("a")
+	assert.Equal(t, []string{"b"}, a.Connections)
+
+	// 削除したブロックへの接続と親も取り除く
+	_, err := (&Operation{Op: OpDelete, BlockID: "a"}).Apply(r, nil)
+	require.NoError(t, err)
+	doc = r.Document()
+	assert.Len(t, doc.Blocks(), 1)
+	b, _ = doc.Block("b")
+	assert.Empty(t, b.Parent)
+
+	// 削除したIDは再利用できない
+	_, err = (&Operation{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy}}).Apply(r, nil)
+	assert.Error(t, err)
+}
+
+func TestOperationApplyMergesConcurrentText(t *testing.T) {
+	r := crdt.NewReplica(hubReplica)
+	_, err := (&Operation{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy, Text: "考える"}}).Apply(r, nil)
+	require.NoError(t, err)
+	base := r.Clock()
+
+	_, err = (&Operation{Op: OpSetText, BlockID: "a", Text: strPtr("なぜ考える")}).Apply(r, nil)
+	require.NoError(t, err)
+
+	// 先頭への挿入を観測していない編集者の変更も、その挿入を残して取り込む
+	op := Operation{Op: OpSetText, BlockID: "a", Text: strPtr("考えるのか")}
+	_, err = op.Apply(r, func(id crdt.ID) bool { return id.Counter <= base })
+	require.NoError(t, err)
+	assert.Equal(t, "なぜ考えるのか", *op.Text)
+}
+
+func TestOperationApplyRejectsInvalidOps(t *testing.T) {
+	base := func() *crdt.Replica {
+		r := crdt.NewReplica(hubReplica)
+		r.CreateBlock(thinking.Block{ID: "a", Type: thinking.TypeWhy, Text: "なぜ"})
+		r.CreateBlock(thinking.Block{ID: "b", Type: thinking.TypeHow, Parent: "a"})
+		r.CreateBlock(thinking.Block{ID: "c", Type: thinking.TypeWhat, Parent: "b"})
+		return r
+	}
+
+	cases := []struct {
+		name string
+		op   Operation
+	}{
+		{"duplicate create", Operation{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy}}},
+		{"create without block", Operation{Op: OpCreate, BlockID: "c"}},
+		{"create under unknown parent", Operation{Op: OpCreate, Block: &thinking.Block{ID: "c", Type: thinking.TypeWhy, Parent: "z"}}},
+		{"unknown type", Operation{Op: OpCreate, Block: &thinking.Block{ID: "c", Type: "thinking_nope"}}},
+		{"missing block", Operation{Op: OpMove, BlockID: "z", Position: &thinking.Position{}}},
+		{"move without position", Operation{Op: OpMove, BlockID: "a"}},
+		{"move to infinity", Operation{Op: OpMove, BlockID: "a", Position: &thinking.Position{X: math.Inf(1)}}},
+		{"text too long", Operation{Op: OpSetText, BlockID: "a", Text: strPtr(strings.Repeat("あ", thinking.MaxTextLength+1))}},
+		{"unknown set_type", Operation{Op: OpSetType, BlockID: "a", Type: "thinking_nope"}},
+		{"create with long id", Operation{Op: OpCreate, Block: &thinking.Block{ID: strings.Repeat("x", thinking.MaxIDLength+1), Type: thinking.TypeWhy}}},
+		{"connect to unknown block", Operation{Op: OpConnect, BlockID: "a", Target: "z"}},
+		{"connect to itself", Operation{Op: OpConnect, BlockID: "a", Target: "a"}},
+		{"parent without value", Operation{Op: OpSetParent, BlockID: "a"}},
+		{"parent to itself", Operation{Op: OpSetParent, BlockID: "a", Parent: strPtr("a")}},
+		{"parent cycle", Operation{Op: OpSetParent, BlockID: "a", Parent: strPtr("b")}},
+		{"parent cycle through grandchild", Operation{Op: OpSetParent, BlockID: "a", Parent: strPtr("c")}},
+		{"unknown op", Operation{Op: "rotate", BlockID: "a"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := base()
+			_, err := tc.op.Apply(r, nil)
+			assert.Error(t, err)
+			assert.Equal(t, base().Document(), r.Document())
+			assert.Equal(t, base().Clock(), r.Clock())
+		})
+	}
+}
+
+func TestOperationApplyLimitsMergedText(t *testing.T) {
+	r := crdt.NewReplica(hubReplica)
+	_, err := (&Operation{Op: OpCreate, Block: &thinking.Block{ID: "a", Type: thinking.TypeWhy}}).Apply(r, nil)
+	require.NoError(t, err)
+	base := r.Clock()
+
+	half := strings.Repeat("あ", thinking.MaxTextLength/2+1)
+	_, err = (&Operation{Op: OpSetText, BlockID: "a", Text: strPtr(half)}).Apply(r, nil)
+	require.NoError(t, err)
+
+	// 送信者のテキストは上限内でも、同時編集とマージした結果が上限を超える編集は拒否する
+	stale := func(id crdt.ID) bool { return id.Counter <= base }
+	_, err = (&Operation{Op: OpSetText, BlockID: "a", Text: strPtr(half)}).Apply(r, stale)
+	assert.Error(t, err)
+	assert.Equal(t, half, r.Text("a"))
+
+	// マージしても上限内に収まる編集は受け付ける
+	op := Operation{Op: OpSetText, BlockID: "a", Text: strPtr("い")}
+	_, err = op.Apply(r, stale)
+	require.NoError(t, err)
+	assert.Equal(t, "い"+half, *op.Text)
+}
@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"thinking-blocks-backend/thinking"
+)
+
+// Presence message types. join and leave are generated by the hub when a
+// client registers and unregisters; clients cannot send them.
+const (
+	TypeJoin   = "join"
+	TypeLeave  = "leave"
+	TypeCursor = "cursor"
+	TypeSelect = "select"
+
+	// TypePresence asks who is here. The hub answers the sender only.
+	TypePresence = "presence"
+)
+
+// Participant is who a client is, as shown to the other clients of a project.
+type Participant struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Color  string `json:"color"`
+}
+
+// presence is the awareness state of one connected client.
+type presence struct {
+	ClientID string `json:"client_id"`
+	Participant
+	Cursor        *thinking.Position `json:"cursor,omitempty"`
+	SelectedBlock string             `json:"selected_block,omitempty"`
+	JoinedAt      int64              `json:"joined_at"`
+
+	joinOrder     uint64
+	cursorSent    time.Time // last time the cursor was broadcast
+	cursorPending bool      // cursor changed since it was last broadcast
+}
+
+// cursorUpdate is the payload of cursor messages.
+type cursorUpdate struct {
+	ClientID string  `json:"client_id"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+}
+
+// selection is the payload of select messages; an empty block id clears it.
+type selection struct {
+	ClientID string `json:"client_id"`
+	BlockID  string `json:"block_id"`
+}
+
+// departure is the payload of leave messages.
+type departure struct {
+	ClientID string `json:"client_id"`
+	UserID   string `json:"user_id"`
+}
+
+// presenceList is the payload of presence answers.
+type presenceList struct {
+	Clients []*presence `json:"clients"`
+}
+
+func (h *Hub) presenceMessage(s *session, p *presence, messageType string) Message {
+	return Message{ProjectID: s.projectID, Type: messageType, UserID: p.UserID, Timestamp: time.Now().Unix()}
+}
+
+// announceJoin tells the other clients that client has joined.
+func (h *Hub) announceJoin(s *session, client *Client) {
+	p := s.clients[client]
+	h.broadcastData(s, h.presenceMessage(s, p, TypeJoin), p, client)
+}
+
+// removeClient drops client from the session and tells the others it left.
+func (h *Hub) removeClient(s *session, client *Client) {
+	p, ok := s.clients[client]
+	if !ok {
+		return
+	}
+	delete(s.clients, client)
+	close(client.send)
+	h.broadcastData(s, h.presenceMessage(s, p, TypeLeave), departure{ClientID: p.ClientID, UserID: p.UserID}, nil)
+}
+
+// updateCursor records the cursor of client. Updates are broadcast at most
+// once per cursor interval; later ones within the interval are sent by
+// flushCursors with the latest position.
+func (h *Hub) updateCursor(s *session, client *Client, message Message) {
+	var position thinking.Position
+	if err := json.Unmarshal(message.Data, &position); err != nil {
+		return
+	}
+	p := s.clients[client]
+	p.Cursor = &position
+	p.cursorPending = true
+	if time.Since(p.cursorSent) >= h.cursorInterval {
+		h.sendCursor(s, client, p)
+	}
+}
+
+func (h *Hub) sendCursor(s *session, client *Client, p *presence) {
+	p.cursorPending = false
+	p.cursorSent = time.Now()
+	update := cursorUpdate{ClientID: p.ClientID, X: p.Cursor.X, Y: p.Cursor.Y}
+	h.broadcastData(s, h.presenceMessage(s, p, TypeCursor), update, client)
+}
+
+// flushCursors broadcasts the cursors held back by throttling.
+func (h *Hub) flushCursors() {
+	for _, s := range h.sessions {
+		for client, p := range s.clients {
+			if p.cursorPending && time.Since(p.cursorSent) >= h.cursorInterval {
+				h.sendCursor(s, client, p)
+			}
+		}
+	}
+}
+
+func (h *Hub) updateSelection(s *session, client *Client, message Message) {
+	var selected selection
+	if err := json.Unmarshal(message.Data, &selected); err != nil {
+		return
+	}
+	p := s.clients[client]
+	p.SelectedBlock = selected.BlockID
+	selected.ClientID = p.ClientID
+	h.broadcastData(s, h.presenceMessage(s, p, TypeSelect), selected, client)
+}
+
+// answerPresence sends client everyone connected to the project, in the
+// order they joined.
+func (h *Hub) answerPresence(s *session, client *Client) {
+	list := presenceList{Clients: make([]*presence, 0, len(s.clients))}
+	for _, p := range s.clients {
+		list.Clients = append(list.Clients, p)
+	}
+	sort.Slice(list.Clients, func(i, j int) bool {
+		return list.Clients[i].joinOrder < list.Clients[j].joinOrder
+	})
+	client.sendMessage(Message{ProjectID: s.projectID, Type: TypePresence, Timestamp: time.Now().Unix()}, list)
+}
+
+// broadcastData sends message with data to every client of the session
+// except skip.
+func (h *Hub) broadcastData(s *session, message Message, data interface{}, skip *Client) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+	message.Data = payload
+	h.broadcastExcept(s, message, skip)
+}
@@ -165,11 +165,13 @@ class APIClient {
   }
 
   // AI分析
-  async analyzeThinking(content: any, theme: string, analysisType: string = 'comprehensive'): Promise<AIAnalysis> {
+  // content のブロックには id が必要（id のないブロックは 400 になる）
+  // projectId を渡すと分析履歴に保存され、content を省略すると保存済みの内容を分析する
+  async analyzeThinking(content: any, theme: string, analysisType: string = 'comprehensive', projectId?: string): Promise<AIAnalysis> {
     const response = await fetch(`${this.baseUrl}/api/ai/analyze`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ content, theme, analysisType })
+      body: JSON.stringify({ content, theme, analysisType, projectId })
     });
     
     const result = await response.json();